@@ -4,6 +4,9 @@ package bluetooth
 
 import (
 	"machine"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"log/slog"
 
@@ -54,6 +57,7 @@ func (a *Adapter) Enable() error {
 	}
 
 	transport := &hciSPI{dev: dev}
+	go transport.receive()
 
 	a.hci, a.att = newBLEStack(transport)
 	if debug {
@@ -69,8 +73,87 @@ func (a *Adapter) Enable() error {
 	return nil
 }
 
+// hciSPI is the HCI transport for the CYW43439.
+//
+// Data from the controller is read by a separate goroutine (see receive) into
+// a lock-free ring buffer, from which the HCI event loop reads. This keeps
+// draining the controller while the goroutine that runs the event loop is busy
+// with application logic, and lets the reader run on the second core when the
+// scheduler supports it.
 type hciSPI struct {
+	// mu serializes the SPI transactions of receive and Write
+	mu  sync.Mutex
 	dev *cyw43439.Device
+	rx  hciRxRing
+}
+
+// receive reads data from the controller into the receive ring buffer. It never
+// returns.
+func (h *hciSPI) receive() {
+	// large enough for most HCI packets, rounded up for the SPI bus.
+	var buf [260]byte
+
+	for {
+		p, err := h.readPacket(buf[:])
+		if err != nil {
+			if debug {
+				println("error reading from CYW43439:", err.Error())
+			}
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if len(p) == 0 {
+			// the controller has been drained
+			time.Sleep(time.Millisecond)
+			continue
+		}
+
+		// pass the packet on as room is made by the event loop
+		for len(p) > 0 {
+			n := h.rx.free()
+			if n == 0 {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			if n > len(p) {
+				n = len(p)
+			}
+
+			h.rx.write(p[:n])
+			p = p[n:]
+		}
+	}
+}
+
+// readPacket reads the next packet buffered by the controller into buf, or
+// into a larger buffer if it doesn't fit. It returns an empty slice if there is
+// no data.
+func (h *hciSPI) readPacket(buf []byte) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.dev.BufferedHCI()
+	if n == 0 {
+		return nil, nil
+	}
+
+	// reads are done in words
+	n = (n + 3) &^ 3
+	if n > len(buf) {
+		buf = make([]byte, n)
+	}
+
+	r, err := h.dev.HCIReadWriter()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err = r.Read(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
 }
 
 func (h *hciSPI) startRead() {
@@ -80,33 +163,26 @@ func (h *hciSPI) endRead() {
 }
 
 func (h *hciSPI) Buffered() int {
-	return h.dev.BufferedHCI()
+	return h.rx.buffered()
 }
 
 func (h *hciSPI) ReadByte() (byte, error) {
 	var buf [1]byte
-
-	r, err := h.dev.HCIReadWriter()
-	if err != nil {
-		return 0, err
-	}
-	if _, err := r.Read(buf[:]); err != nil {
-		return 0, err
+	for h.rx.read(buf[:]) == 0 {
+		time.Sleep(time.Millisecond)
 	}
 
 	return buf[0], nil
 }
 
 func (h *hciSPI) Read(buf []byte) (int, error) {
-	r, err := h.dev.HCIReadWriter()
-	if err != nil {
-		return 0, err
-	}
-
-	return r.Read(buf)
+	return h.rx.read(buf), nil
 }
 
 func (h *hciSPI) Write(buf []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	w, err := h.dev.HCIReadWriter()
 	if err != nil {
 		return 0, err
@@ -114,3 +190,61 @@ func (h *hciSPI) Write(buf []byte) (int, error) {
 
 	return w.Write(buf)
 }
+
+// size of the receive ring buffer, must be a power of two.
+const hciRxRingSize = 1024
+
+// hciRxRing is a lock-free single-producer, single-consumer ring buffer for
+// data received from the controller.
+//
+// Memory model: the producer only ever writes the buffer and tail, the
+// consumer only ever writes head. The producer copies data into the buffer
+// before publishing it with an atomic store of tail, and the consumer loads
+// tail atomically before reading the buffer, so everything written before the
+// store is visible to the consumer (sync/atomic operations are sequentially
+// consistent). The same holds in the other direction for head, which releases
+// space back to the producer. This makes the ring safe to use between
+// goroutines running on different cores, or between an interrupt handler and
+// a goroutine, as long as there is only one producer and one consumer.
+type hciRxRing struct {
+	buf  [hciRxRingSize]byte
+	head atomic.Uint32 // next byte to read, only written by the consumer
+	tail atomic.Uint32 // next byte to write, only written by the producer
+}
+
+// buffered returns the number of bytes available for reading.
+func (r *hciRxRing) buffered() int {
+	return int(r.tail.Load() - r.head.Load())
+}
+
+// free returns the number of bytes available for writing.
+func (r *hciRxRing) free() int {
+	return hciRxRingSize - r.buffered()
+}
+
+// write copies p into the ring. It must only be called by the producer, and p
+// must fit in the free space.
+func (r *hciRxRing) write(p []byte) {
+	tail := r.tail.Load()
+	for i, b := range p {
+		r.buf[(tail+uint32(i))%hciRxRingSize] = b
+	}
+	r.tail.Store(tail + uint32(len(p)))
+}
+
+// read copies up to len(p) bytes from the ring into p and returns the number of
+// bytes copied. It must only be called by the consumer.
+func (r *hciRxRing) read(p []byte) int {
+	head := r.head.Load()
+	n := int(r.tail.Load() - head)
+	if n > len(p) {
+		n = len(p)
+	}
+
+	for i := 0; i < n; i++ {
+		p[i] = r.buf[(head+uint32(i))%hciRxRingSize]
+	}
+	r.head.Store(head + uint32(n))
+
+	return n
+}
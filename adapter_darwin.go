@@ -25,6 +25,8 @@ type Adapter struct {
 	connectMap sync.Map
 
 	connectHandler func(device Device, connected bool)
+
+	attTimeout time.Duration
 }
 
 // DefaultAdapter is the default adapter on the system.
@@ -34,6 +36,7 @@ var DefaultAdapter = &Adapter{
 	cm:         cbgo.NewCentralManager(nil),
 	pm:         cbgo.NewPeripheralManager(nil),
 	connectMap: sync.Map{},
+	attTimeout: defaultATTTimeout,
 
 	connectHandler: func(device Device, connected bool) {
 		return
@@ -73,6 +76,14 @@ func (a *Adapter) Enable() error {
 	return nil
 }
 
+// SetATTTimeout sets how long to wait for a peripheral to respond to a GATT
+// request, such as a read or a service discovery, before giving up with
+// ErrTimeout. It applies to devices connected afterwards. The default is 10
+// seconds.
+func (a *Adapter) SetATTTimeout(timeout time.Duration) {
+	a.attTimeout = timeout
+}
+
 // CentralManager delegate functions
 
 type centralManagerDelegate struct {
@@ -169,10 +180,16 @@ func makeScanResult(prph cbgo.Peripheral, advFields cbgo.AdvFields, rssi int) Sc
 		})
 	}
 
+	var txPower int8
+	if advFields.TxPowerLevel != nil {
+		txPower = int8(*advFields.TxPowerLevel)
+	}
+
 	// Peripheral UUID is randomized on macOS, which means to
 	// different centrals it will appear to have a different UUID.
 	return ScanResult{
-		RSSI: int16(rssi),
+		RSSI:      int16(rssi),
+		Timestamp: time.Now(),
 		Address: Address{
 			UUID: uuid,
 		},
@@ -182,6 +199,8 @@ func makeScanResult(prph cbgo.Peripheral, advFields cbgo.AdvFields, rssi int) Sc
 				ServiceUUIDs:     serviceUUIDs,
 				ManufacturerData: manufacturerData,
 				ServiceData:      serviceData,
+				TxPower:          txPower,
+				HasTxPower:       advFields.TxPowerLevel != nil,
 			},
 		},
 	}
@@ -3,8 +3,8 @@
 package bluetooth
 
 import (
-	"runtime"
-
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,16 +15,79 @@ type hciAdapter struct {
 	att     *att
 
 	isDefault bool
-	scanning  bool
+
+	// scanning is read by the scan loop and written by StopScan, which may
+	// be called from the scan callback or from another goroutine.
+	scanning atomic.Bool
 
 	connectHandler func(device Device, connected bool)
 
 	connectedDevices     []Device
 	notificationsStarted bool
+	eventLoopStarted     bool
 	charWriteHandlers    []charWriteHandler
+
+	pollMin, pollMax time.Duration
+	attTimeout       time.Duration
+	powerProfile     PowerProfile
+
+	notificationQueueSize int
+	notificationPolicy    NotificationOverflowPolicy
+
+	autoPair bool
+
+	// see SetWriteChunking
+	strictWriteBoundaries bool
+
+	// range of local handles that changed and that the clients weren't told
+	// about yet, and whether a client ever enabled the indications, see
+	// indicateServiceChanged
+	serviceChangedStart, serviceChangedEnd uint16
+	serviceChangedSubscribed               bool
+
+	// see SetMaxPeripheralConnections
+	maxPeripheralConnections int
+
+	// see SetServerMTU
+	serverMTU uint16
+
+	// fast reconnect, see SetFastReconnect. The caches are also used by the
+	// notification goroutine, see checkServiceChanged.
+	fastReconnect bool
+	gattCacheMu   sync.Mutex
+	gattCaches    []*gattCache
+
+	// static allocation, see SetResourceLimits
+	limits      *ResourceLimits
+	deviceSlots []deviceInternal
+
+	// advertising watchdog, see SetAdvertisingWatchdog
+	advertisement      *Advertisement
+	advWatchdog        bool
+	advWatchdogHandler func(reason AdvertisingRestartReason, err error)
+	advRetryAt         time.Time
+
+	// time at which the advertisement stops by itself, see checkAdvertising
+	advStopAt time.Time
+
+	// address to advertise with, see SetAdvertisingAddress
+	advAddress MACAddress
+
+	// set by event handlers when the advertising data has to be sent again,
+	// see checkAdvertising
+	advDataChanged bool
+
+	// periodic advertising syncs, see SyncPeriodicAdvertising
+	periodicMu             sync.Mutex
+	periodicSyncs          []*PeriodicAdvertisingSync
+	periodicReportsStarted bool
 }
 
 func (a *hciAdapter) enable() error {
+	if a.limits != nil {
+		a.allocateResources()
+	}
+
 	if err := a.hci.start(); err != nil {
 		if debug {
 			println("error starting HCI:", err.Error())
@@ -32,6 +95,32 @@ func (a *hciAdapter) enable() error {
 		return err
 	}
 
+	if a.pollMin != 0 {
+		a.hci.setPollInterval(a.pollMin, a.pollMax)
+	}
+
+	if a.attTimeout != 0 {
+		a.att.timeout = a.attTimeout
+	}
+
+	// each queued notification holds a notification buffer
+	queueSize := a.hci.notificationPool.size()
+	if a.notificationQueueSize > 0 && a.notificationQueueSize < queueSize {
+		queueSize = a.notificationQueueSize
+	}
+	a.att.notifications = make(chan rawNotification, queueSize)
+	a.att.notificationPolicy = a.notificationPolicy
+
+	a.hci.advWatchdog = a.advWatchdog
+	a.hci.maxPeripheralConnections = a.maxPeripheralConnections
+	a.att.serverMTU = a.serverMTU
+
+	return a.resetController()
+}
+
+// resetController resets the controller and sets it up for use by the
+// adapter.
+func (a *hciAdapter) resetController() error {
 	if err := a.hci.reset(); err != nil {
 		if debug {
 			println("error resetting HCI:", err.Error())
@@ -46,7 +135,91 @@ func (a *hciAdapter) enable() error {
 		return err
 	}
 
-	return a.hci.setLeEventMask(0x00000000000003FF)
+	if err := a.hci.setLeEventMask(0x000000000000F3FF); err != nil {
+		return err
+	}
+
+	if err := a.hci.readLeBufferSize(); err != nil {
+		return err
+	}
+
+	if err := a.hci.readLeLocalFeatures(); err != nil {
+		return err
+	}
+
+	// the own address is part of the pairing, see smp_hci.go
+	if err := a.hci.readBdAddr(); err != nil {
+		return err
+	}
+
+	return a.hci.readLeSupportedStates()
+}
+
+// SetPollInterval sets the interval at which the HCI controller is polled for
+// new events while waiting, for example while scanning or advertising. Shorter
+// intervals reduce latency, longer intervals reduce CPU and power use. The
+// default is 5ms.
+func (a *hciAdapter) SetPollInterval(interval time.Duration) {
+	a.SetAdaptivePollInterval(interval, interval)
+}
+
+// SetAdaptivePollInterval enables adaptive polling of the HCI controller: the
+// poll interval backs off towards max while the controller is idle, and
+// tightens towards min while traffic is flowing.
+func (a *hciAdapter) SetAdaptivePollInterval(min, max time.Duration) {
+	a.pollMin, a.pollMax = min, max
+	if a.hci != nil {
+		a.hci.setPollInterval(min, max)
+	}
+}
+
+// SetATTTimeout sets how long to wait for a peripheral to respond to a GATT
+// request, such as a read or a service discovery, before giving up with
+// ErrTimeout. The default is 10 seconds. It can be overridden for a single
+// call with the WithTimeout variants, such as ReadWithTimeout and
+// WriteWithTimeout.
+func (a *hciAdapter) SetATTTimeout(timeout time.Duration) {
+	a.attTimeout = timeout
+	if a.att != nil {
+		a.att.timeout = timeout
+	}
+}
+
+// SetNotificationQueue sets the number of notifications that can wait for
+// their callback, and which notification to drop when one arrives while the
+// queue is full. Callbacks are called one at a time from a dedicated
+// goroutine, so a slow callback doesn't stall the processing of other events,
+// and notifications are never waited for, so callbacks may make GATT
+// requests. Each queued notification holds one of the notification buffers,
+// so the queue is at most as long as there are buffers, 8 unless set with
+// ResourceLimits.NotificationBuffers.
+//
+// It must be called before Enable. The default is a queue as long as there
+// are notification buffers, dropping new notifications when it is full.
+func (a *hciAdapter) SetNotificationQueue(size int, policy NotificationOverflowPolicy) {
+	a.notificationQueueSize = size
+	a.notificationPolicy = policy
+}
+
+// DroppedNotifications returns the number of notifications that were dropped
+// because the queue of notifications waiting for their callback was full, or
+// all notification buffers were in use.
+func (a *hciAdapter) DroppedNotifications() uint32 {
+	return a.att.droppedNotifications.Load()
+}
+
+// SetAutoPair sets whether to automatically pair with a peripheral and retry
+// the operation once when a read or write fails because the link is not
+// sufficiently authenticated or encrypted.
+func (a *hciAdapter) SetAutoPair(enabled bool) {
+	a.autoPair = enabled
+}
+
+// SetWriteChunking sets whether WriteWithoutResponse splits values longer than
+// MTU-3 bytes into several writes, which is the default. Protocols that depend
+// on packet boundaries can disable it, so that such writes fail instead.
+func (a *hciAdapter) SetWriteChunking(enabled bool) {
+	a.strictWriteBoundaries = !enabled
 }
 
 func (a *hciAdapter) Address() (MACAddress, error) {
@@ -65,6 +238,8 @@ func newBLEStack(port hciTransport) (*hci, *att) {
 	l := newL2CAP(h)
 	h.l2cap = l
 
+	h.smp = newSMP(h)
+
 	return h, a
 }
 
@@ -92,70 +267,94 @@ func makeNINAAddress(mac MAC) [6]uint8 {
 	}
 }
 
-func (a *hciAdapter) startNotifications() {
-	if a.notificationsStarted {
+// startEventLoop starts the goroutine that polls the controller for events,
+// unless it is already running. There is a single event loop per adapter: the
+// events are processed by the HCI and ATT layers, which hand them over to
+// whoever registered for them, such as the scan report queue, the connect
+// waiter or the notification channel.
+func (a *hciAdapter) startEventLoop() {
+	if a.eventLoopStarted {
 		return
 	}
 
 	if debug {
-		println("starting notifications...")
+		println("starting event loop...")
 	}
 
-	a.notificationsStarted = true
+	a.eventLoopStarted = true
 
-	// go routine to poll for HCI events for ATT notifications
 	go func() {
 		for {
-			if err := a.att.poll(); err != nil {
+			if err := a.hci.poll(); err != nil {
 				// TODO: handle error
 				if debug {
-					println("error polling for notifications:", err.Error())
+					println("error polling for HCI events:", err.Error())
 				}
 			}
 
-			time.Sleep(5 * time.Millisecond)
+			a.checkAdvertising()
+
+			a.hci.pollWait()
 		}
 	}()
+}
+
+func (a *hciAdapter) startNotifications() {
+	if a.notificationsStarted {
+		return
+	}
+
+	if debug {
+		println("starting notifications...")
+	}
+
+	a.notificationsStarted = true
+
+	a.startEventLoop()
 
 	// go routine to handle characteristic notifications
 	go func() {
-		for {
-			select {
-			case not := <-a.att.notifications:
-				if debug {
-					println("notification received", not.connectionHandle, not.handle, not.data)
-				}
+		for not := range a.att.notifications {
+			if debug {
+				println("notification received", not.connectionHandle, not.handle, not.data)
+			}
 
-				d := a.findConnection(not.connectionHandle)
-				if d.deviceInternal == nil {
-					if debug {
-						println("no device found for handle", not.connectionHandle)
-					}
-					continue
+			d := a.findConnection(not.connectionHandle)
+			if d.deviceInternal == nil {
+				if debug {
+					println("no device found for handle", not.connectionHandle)
 				}
+				a.hci.notificationPool.put(not.data)
+				continue
+			}
 
-				n := d.findNotificationRegistration(not.handle)
-				if n == nil {
-					if debug {
-						println("no notification registered for handle", not.handle)
-					}
-					continue
-				}
+			d.checkServiceChanged(not.handle)
 
-				if n.callback != nil {
-					n.callback(not.data)
+			n := d.findNotificationRegistration(not.handle)
+			if n == nil {
+				if debug {
+					println("no notification registered for handle", not.handle)
 				}
-
-			default:
+				a.hci.notificationPool.put(not.data)
+				continue
 			}
 
-			runtime.Gosched()
+			if n.callback != nil {
+				n.callback(not.data)
+			}
+			a.hci.notificationPool.put(not.data)
 		}
 	}()
 }
 
-func (a *hciAdapter) addConnection(d Device) {
+func (a *hciAdapter) addConnection(d Device) error {
+	if !a.hci.hasRoom(len(a.connectedDevices), cap(a.connectedDevices)) {
+		return ErrNoResources
+	}
+
 	a.connectedDevices = append(a.connectedDevices, d)
+
+	return nil
 }
 
 func (a *hciAdapter) removeConnection(d Device) {
@@ -164,6 +363,7 @@ func (a *hciAdapter) removeConnection(d Device) {
 			a.connectedDevices[i] = a.connectedDevices[len(a.connectedDevices)-1]
 			a.connectedDevices[len(a.connectedDevices)-1] = Device{}
 			a.connectedDevices = a.connectedDevices[:len(a.connectedDevices)-1]
+			d.used = false
 
 			return
 		}
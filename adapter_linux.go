@@ -6,8 +6,10 @@
 package bluetooth
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 )
@@ -24,6 +26,8 @@ type Adapter struct {
 	defaultAdvertisement *Advertisement
 
 	connectHandler func(device Device, connected bool)
+
+	attTimeout time.Duration
 }
 
 // DefaultAdapter is the default adapter on the system. On Linux, it is the
@@ -58,6 +62,37 @@ func (a *Adapter) Enable() (err error) {
 	return nil
 }
 
+// SetATTTimeout sets how long to wait for a peripheral to respond to a GATT
+// request, such as a read or a write, before giving up with ErrTimeout. The
+// default is 10 seconds.
+func (a *Adapter) SetATTTimeout(timeout time.Duration) {
+	a.attTimeout = timeout
+}
+
+// timeout returns the ATT timeout set by SetATTTimeout, or the default.
+func (a *Adapter) timeout() time.Duration {
+	if a.attTimeout <= 0 {
+		return defaultATTTimeout
+	}
+
+	return a.attTimeout
+}
+
+// callWithTimeout calls a method of a BlueZ object that involves the
+// peripheral, and fails with ErrTimeout if it doesn't return within the ATT
+// timeout.
+func (a *Adapter) callWithTimeout(object dbus.BusObject, method string, args ...interface{}) *dbus.Call {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout())
+	defer cancel()
+
+	call := object.CallWithContext(ctx, method, 0, args...)
+	if errors.Is(call.Err, context.DeadlineExceeded) {
+		call.Err = ErrTimeout
+	}
+
+	return call
+}
+
 func (a *Adapter) Address() (MACAddress, error) {
 	if a.address == "" {
 		return MACAddress{}, errors.New("adapter not enabled")
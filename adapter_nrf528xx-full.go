@@ -35,6 +35,7 @@ func handleEvent() {
 					println("evt: connected in peripheral role")
 				}
 				currentConnection.handle.Reg = uint16(gapEvent.conn_handle)
+				defaultAdvertisement.connected(device)
 				DefaultAdapter.connectHandler(device, true)
 			case C.BLE_GAP_ROLE_CENTRAL:
 				if debug {
@@ -55,20 +56,18 @@ func handleEvent() {
 				}
 			}
 			currentConnection.handle.Reg = C.BLE_CONN_HANDLE_INVALID
-			// Auto-restart advertisement if needed.
-			if defaultAdvertisement.isAdvertising.Get() != 0 {
-				// The advertisement was running but was automatically stopped
-				// by the connection event.
-				// Note that it cannot be restarted during connect like this,
-				// because it would need to be reconfigured as a non-connectable
-				// advertisement. That's left as a future addition, if
-				// necessary.
-				C.sd_ble_gap_adv_start(defaultAdvertisement.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
-			}
+			// Auto-restart advertisement if needed: it was running but was
+			// automatically stopped by the connection event.
+			defaultAdvertisement.resume()
 			device := Device{
 				connectionHandle: gapEvent.conn_handle,
 			}
 			DefaultAdapter.connectHandler(device, false)
+		case C.BLE_GAP_EVT_ADV_SET_TERMINATED:
+			if debug {
+				println("evt: advertising set terminated")
+			}
+			defaultAdvertisement.terminated()
 		case C.BLE_GAP_EVT_CONN_PARAM_UPDATE:
 			if debug {
 				// Print connection parameters for easy debugging.
@@ -33,26 +33,25 @@ func handleEvent() {
 				Address:          Address{makeMACAddress(connectEvent.peer_addr)},
 				connectionHandle: gapEvent.conn_handle,
 			}
+			defaultAdvertisement.connected(device)
 			DefaultAdapter.connectHandler(device, true)
 		case C.BLE_GAP_EVT_DISCONNECTED:
 			if debug {
 				println("evt: disconnected")
 			}
 			currentConnection.handle.Reg = C.BLE_CONN_HANDLE_INVALID
-			// Auto-restart advertisement if needed.
-			if defaultAdvertisement.isAdvertising.Get() != 0 {
-				// The advertisement was running but was automatically stopped
-				// by the connection event.
-				// Note that it cannot be restarted during connect like this,
-				// because it would need to be reconfigured as a non-connectable
-				// advertisement. That's left as a future addition, if
-				// necessary.
-				C.sd_ble_gap_adv_start(defaultAdvertisement.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
-			}
+			// Auto-restart advertisement if needed: it was running but was
+			// automatically stopped by the connection event.
+			defaultAdvertisement.resume()
 			device := Device{
 				connectionHandle: gapEvent.conn_handle,
 			}
 			DefaultAdapter.connectHandler(device, false)
+		case C.BLE_GAP_EVT_ADV_SET_TERMINATED:
+			if debug {
+				println("evt: advertising set terminated")
+			}
+			defaultAdvertisement.terminated()
 		case C.BLE_GAP_EVT_DATA_LENGTH_UPDATE_REQUEST:
 			// We need to respond with sd_ble_gap_data_length_update. Setting
 			// both parameters to nil will make sure we send the default values.
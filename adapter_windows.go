@@ -3,6 +3,7 @@ package bluetooth
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-ole/go-ole"
 	"github.com/saltosystems/winrt-go"
@@ -16,6 +17,8 @@ type Adapter struct {
 	connectHandler func(device Device, connected bool)
 
 	defaultAdvertisement *Advertisement
+
+	attTimeout time.Duration
 }
 
 // DefaultAdapter is the default adapter on the system.
@@ -34,6 +37,13 @@ func (a *Adapter) Enable() error {
 }
 
 func awaitAsyncOperation(asyncOperation *foundation.IAsyncOperation, genericParamSignature string) error {
+	return awaitAsyncOperationTimeout(asyncOperation, genericParamSignature, 0)
+}
+
+// awaitAsyncOperationTimeout waits for an async operation like
+// awaitAsyncOperation, but fails with ErrTimeout if it doesn't complete within
+// the timeout. A zero timeout waits forever.
+func awaitAsyncOperationTimeout(asyncOperation *foundation.IAsyncOperation, genericParamSignature string, timeout time.Duration) error {
 	var status foundation.AsyncStatus
 
 	// We need to obtain the GUID of the AsyncOperationCompletedHandler, but its a generic delegate
@@ -52,7 +62,18 @@ func awaitAsyncOperation(asyncOperation *foundation.IAsyncOperation, genericPara
 	asyncOperation.SetCompleted(handler)
 
 	// Wait until async operation has stopped, and finish.
-	<-waitChan
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-waitChan:
+		case <-timer.C:
+			return ErrTimeout
+		}
+	} else {
+		<-waitChan
+	}
 
 	if status != foundation.AsyncStatusCompleted {
 		return fmt.Errorf("async operation failed with status %d", status)
@@ -60,6 +81,14 @@ func awaitAsyncOperation(asyncOperation *foundation.IAsyncOperation, genericPara
 	return nil
 }
 
+// SetATTTimeout sets how long to wait for a peripheral to respond to a GATT
+// request, such as a read or a service discovery, before giving up with
+// ErrTimeout. It applies to devices connected afterwards. The default is 10
+// seconds.
+func (a *Adapter) SetATTTimeout(timeout time.Duration) {
+	a.attTimeout = timeout
+}
+
 func (a *Adapter) Address() (MACAddress, error) {
 	// TODO: get mac address
 	return MACAddress{}, errors.New("not implemented")
@@ -0,0 +1,190 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"encoding/binary"
+)
+
+// maximum length of the data of an extended advertisement. The controller
+// accepts up to 251 bytes in a single command, but the command has to fit in
+// the transmit buffer.
+const maxExtAdvDataLength = 248
+
+// handles of the advertising sets used by Advertisement and
+// PeriodicAdvertisement.
+const (
+	advHandle         = 0x00
+	periodicAdvHandle = 0x01
+)
+
+// transmit power of the extended advertising parameters that lets the
+// controller choose.
+const txPowerNoPreference = 0x7f
+
+// advertising event properties of the extended advertising parameters.
+const (
+	advPropConnectable = 0x0001
+	advPropScannable   = 0x0002
+	advPropLegacy      = 0x0010
+)
+
+// advertisingPayload is advertising data that may be longer than a legacy
+// advertising packet, for extended advertising. If limit is set, the data is
+// kept within limit bytes, for example for a legacy packet.
+type advertisingPayload struct {
+	data  [maxExtAdvDataLength]byte
+	len   int
+	limit int
+}
+
+// Bytes returns the advertising data.
+func (p *advertisingPayload) Bytes() []byte {
+	return p.data[:p.len]
+}
+
+// add appends the field that add puts in an empty legacy payload, so that the
+// encoders of rawAdvertisementPayload can be used. It returns false if the
+// field doesn't fit.
+func (p *advertisingPayload) add(add func(field *rawAdvertisementPayload) bool) bool {
+	var field rawAdvertisementPayload
+	if !add(&field) || p.len+int(field.len) > p.size() {
+		return false
+	}
+
+	p.len += copy(p.data[p.len:], field.Bytes())
+
+	return true
+}
+
+// addLocalName appends the local name, shortened if it doesn't fit completely.
+func (p *advertisingPayload) addLocalName(name []byte) {
+	room := p.size() - p.len - 2
+	if len(name) == 0 || room <= 0 {
+		return
+	}
+
+	typ := byte(0x09) // complete local name
+	if len(name) > room {
+		typ = 0x08 // shortened local name
+		name = name[:room]
+	}
+
+	p.data[p.len] = byte(len(name) + 1)
+	p.data[p.len+1] = typ
+	p.len += 2 + copy(p.data[p.len+2:], name)
+}
+
+// size returns the maximum length of the data.
+func (p *advertisingPayload) size() int {
+	if p.limit > 0 {
+		return p.limit
+	}
+
+	return len(p.data)
+}
+
+// place adds the field that add puts in an empty legacy payload to adv or to
+// rsp, depending on placement. If rsp is nil, the field is always added to adv.
+// It returns false if the field doesn't fit.
+func place(placement AdvertisingPlacement, adv, rsp *advertisingPayload, add func(field *rawAdvertisementPayload) bool) bool {
+	switch {
+	case rsp == nil || placement == AdvertisingPlacementData:
+		return adv.add(add)
+	case placement == AdvertisingPlacementScanResponse:
+		return rsp.add(add)
+	default:
+		return adv.add(add) || rsp.add(add)
+	}
+}
+
+// leSetExtAdvParameters sets the parameters of an advertising set, on the 1M
+// PHY. txPower is the preferred transmit power in dBm, or txPowerNoPreference,
+// and the transmit power selected by the controller is returned with the
+// status of the command.
+func (h *hci) leSetExtAdvParameters(handle uint8, properties uint16, minInterval, maxInterval uint32, chanMap, ownBdaddrType, sid uint8, txPower int8) (int8, uint8, error) {
+	var b [25]byte
+	b[0] = handle
+	binary.LittleEndian.PutUint16(b[1:], properties)
+	putUint24(b[3:], minInterval)
+	putUint24(b[6:], maxInterval)
+	b[9] = chanMap
+	b[10] = ownBdaddrType
+	b[11] = 0x00 // no peer address
+	b[18] = 0x00 // filter policy: accept all
+	b[19] = byte(txPower)
+	b[20] = 0x01 // primary PHY: 1M
+	b[21] = 0x00 // secondary max skip
+	b[22] = 0x01 // secondary PHY: 1M
+	b[23] = sid
+	b[24] = 0x00 // no scan request notifications
+
+	var rsp [6]byte
+	status, n, err := h.sendCommandWithResponse(ogfLECtrl<<ogfCommandPos|ocfLESetExtAdvParameters, b[:], rsp[:])
+	if err != nil {
+		return 0, status, err
+	}
+
+	// skip event length, number of commands, opcode and status
+	if n < 6 {
+		return 0, status, ErrHCIInvalidPacket
+	}
+
+	return int8(rsp[5]), status, nil
+}
+
+// leSetExtAdvData sets the advertising data or the scan response data of an
+// advertising set, depending on ocf, in a single operation.
+func (h *hci) leSetExtAdvData(handle uint8, ocf uint16, data []byte) error {
+	if len(data) > maxExtAdvDataLength {
+		return errAdvertisementPacketTooBig
+	}
+
+	var b [4 + maxExtAdvDataLength]byte
+	b[0] = handle
+	b[1] = 0x03 // operation: complete data
+	b[2] = 0x01 // no fragmentation preference
+	b[3] = byte(len(data))
+	n := copy(b[4:], data)
+
+	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocf, b[:4+n])
+}
+
+// leSetExtAdvEnable enables or disables an advertising set. It doesn't wait
+// for the controller, so it may be called from event handlers.
+func (h *hci) leSetExtAdvEnable(handle uint8, enabled bool) error {
+	var b [6]byte
+	if enabled {
+		b[0] = 1
+	}
+	b[1] = 1 // number of sets
+	b[2] = handle
+	// no duration and no maximum number of events
+
+	return h.sendWithoutResponse(ogfLECtrl<<ogfCommandPos|ocfLESetExtAdvEnable, b[:])
+}
+
+// leSetAdvRandomAddress sets the random address to advertise with. It must be
+// called after the advertising parameters have been set.
+func (h *hci) leSetAdvRandomAddress(address [6]byte) error {
+	if !h.extendedAdvertising {
+		return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLESetRandomAddress, address[:])
+	}
+
+	return h.leSetAdvSetRandomAddress(advHandle, address)
+}
+
+// leSetAdvSetRandomAddress sets the random address of an advertising set.
+func (h *hci) leSetAdvSetRandomAddress(handle uint8, address [6]byte) error {
+	var b [7]byte
+	b[0] = handle
+	copy(b[1:], address[:])
+
+	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLESetAdvSetRandomAddress, b[:])
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
@@ -0,0 +1,48 @@
+package bluetooth
+
+// Standard appearance values, as advertised in the Appearance AD field and in
+// the Appearance characteristic of the GAP service. The full list is in the
+// assigned numbers of the Bluetooth SIG:
+// https://www.bluetooth.com/specifications/assigned-numbers/
+const (
+	AppearanceUnknown               uint16 = 0x0000
+	AppearanceGenericPhone          uint16 = 0x0040
+	AppearanceGenericComputer       uint16 = 0x0080
+	AppearanceGenericWatch          uint16 = 0x00c0
+	AppearanceSportsWatch           uint16 = 0x00c1
+	AppearanceGenericClock          uint16 = 0x0100
+	AppearanceGenericDisplay        uint16 = 0x0140
+	AppearanceGenericRemoteControl  uint16 = 0x0180
+	AppearanceGenericEyeGlasses     uint16 = 0x01c0
+	AppearanceGenericTag            uint16 = 0x0200
+	AppearanceGenericKeyring        uint16 = 0x0240
+	AppearanceGenericMediaPlayer    uint16 = 0x0280
+	AppearanceGenericBarcodeScanner uint16 = 0x02c0
+	AppearanceGenericThermometer    uint16 = 0x0300
+	AppearanceEarThermometer        uint16 = 0x0301
+	AppearanceGenericHeartRate      uint16 = 0x0340
+	AppearanceHeartRateBelt         uint16 = 0x0341
+	AppearanceGenericBloodPressure  uint16 = 0x0380
+	AppearanceGenericHID            uint16 = 0x03c0
+	AppearanceKeyboard              uint16 = 0x03c1
+	AppearanceMouse                 uint16 = 0x03c2
+	AppearanceJoystick              uint16 = 0x03c3
+	AppearanceGamepad               uint16 = 0x03c4
+	AppearanceGenericGlucoseMeter   uint16 = 0x0400
+	AppearanceGenericRunningWalking uint16 = 0x0440
+	AppearanceGenericCycling        uint16 = 0x0480
+	AppearanceCyclingComputer       uint16 = 0x0481
+	AppearanceCyclingSpeedSensor    uint16 = 0x0482
+	AppearanceCyclingCadenceSensor  uint16 = 0x0483
+	AppearanceCyclingPowerSensor    uint16 = 0x0484
+	AppearanceGenericControlDevice  uint16 = 0x04c0
+	AppearanceGenericNetworkDevice  uint16 = 0x0500
+	AppearanceGenericSensor         uint16 = 0x0540
+	AppearanceTemperatureSensor     uint16 = 0x0543
+	AppearanceHumiditySensor        uint16 = 0x0544
+	AppearanceGenericLightFixtures  uint16 = 0x0580
+	AppearanceGenericFan            uint16 = 0x05c0
+	AppearanceGenericPulseOximeter  uint16 = 0x0c40
+	AppearanceGenericWeightScale    uint16 = 0x0c80
+	AppearanceGenericOutdoorSports  uint16 = 0x1440
+)
@@ -3,11 +3,13 @@
 package bluetooth
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -41,6 +43,9 @@ const (
 	attOpHandleCNF           = 0x1e
 	attOpSignedWriteCmd      = 0xd2
 
+	attOpReadMultiVarReq      = 0x20
+	attOpReadMultiVarResponse = 0x21
+
 	attErrorInvalidHandle          = 0x01
 	attErrorReadNotPermitted       = 0x02
 	attErrorWriteNotPermitted      = 0x03
@@ -61,21 +66,21 @@ const (
 
 	gattUnknownUUID                    = 0x0000
 	gattServiceUUID                    = 0x2800
+	gattIncludeUUID                    = 0x2802
 	gattCharacteristicUUID             = 0x2803
 	gattDescriptorUUID                 = 0x2900
 	gattClientCharacteristicConfigUUID = 0x2902
 )
 
 var (
-	ErrATTTimeout           = errors.New("bluetooth: ATT timeout")
+	// ErrATTTimeout is the same error as ErrTimeout.
+	ErrATTTimeout           = ErrTimeout
 	ErrATTUnknownEvent      = errors.New("bluetooth: ATT unknown event")
 	ErrATTUnknown           = errors.New("bluetooth: ATT unknown error")
 	ErrATTOp                = errors.New("bluetooth: ATT OP error")
 	ErrATTUnknownConnection = errors.New("bluetooth: ATT unknown connection")
 )
 
-const defaultTimeoutSeconds = 10
-
 type rawService struct {
 	startHandle uint16
 	endHandle   uint16
@@ -180,6 +185,21 @@ func (d *rawDescriptor) Write(buf []byte) (int, error) {
 	return len(d.data) + 2, nil
 }
 
+// uuid returns the UUID of the descriptor, from a Find Information response.
+func (d *rawDescriptor) uuid() UUID {
+	switch len(d.data) {
+	case 2:
+		return New16BitUUID(binary.LittleEndian.Uint16(d.data))
+	case 16:
+		var uuid [16]byte
+		copy(uuid[:], d.data)
+		slices.Reverse(uuid[:])
+		return NewUUID(uuid)
+	}
+
+	return UUID{}
+}
+
 func (d *rawDescriptor) Read(p []byte) (int, error) {
 	binary.LittleEndian.PutUint16(p[0:], d.handle)
 	copy(p[2:], d.data)
@@ -193,6 +213,19 @@ type rawNotification struct {
 	data             []byte
 }
 
+// NotificationOverflowPolicy sets what happens to a notification that arrives
+// while the queue of notifications waiting for their callback is full.
+type NotificationOverflowPolicy uint8
+
+const (
+	// NotificationDropNewest drops the notification that just arrived.
+	NotificationDropNewest NotificationOverflowPolicy = iota
+
+	// NotificationDropOldest drops the oldest queued notification to make
+	// room for the one that just arrived.
+	NotificationDropOldest
+)
+
 type attributeType int
 
 const (
@@ -200,6 +233,7 @@ const (
 	attributeTypeCharacteristic
 	attributeTypeCharacteristicValue
 	attributeTypeDescriptor
+	attributeTypeInclude
 )
 
 type rawAttribute struct {
@@ -238,6 +272,13 @@ func (a *rawAttribute) Read(p []byte) (int, error) {
 	return sz, nil
 }
 
+// isCCCD returns whether the attribute is a Client Characteristic
+// Configuration descriptor, of which the value is kept by the characteristic.
+func (a *rawAttribute) isCCCD() bool {
+	return a.typ == attributeTypeDescriptor &&
+		a.uuid == shortUUID(gattClientCharacteristicConfigUUID).UUID()
+}
+
 func (a *rawAttribute) length() int {
 	switch a.typ {
 	case attributeTypeCharacteristicValue, attributeTypeDescriptor:
@@ -260,42 +301,67 @@ type connectData struct {
 	lastErrorCode   uint8
 	mtu             uint16
 	maxMTU          uint16
+	mtuExchanged    bool
 	services        []rawService
 	characteristics []rawCharacteristic
 	descriptors     []rawDescriptor
 	value           []byte
+	used            bool
+
+	// pending is set while a request is waiting for its response
+	pending bool
+
+	// confirmed is set when the client confirms an indication
+	confirmed bool
+
+	// long writes of the client waiting to be executed
+	prepared []preparedWrite
+
+	// set while the link is encrypted
+	encrypted bool
 }
 
 type att struct {
 	hci           *hci
 	busy          sync.Mutex
-	mtu           uint16
+	timeout       time.Duration
 	maxMTU        uint16
 	notifications chan rawNotification
 
+	// MTU of the local server, or 0 for maxMTU, see SetServerMTU
+	serverMTU uint16
+
+	notificationPolicy   NotificationOverflowPolicy
+	droppedNotifications atomic.Uint32
+
 	connections          []uint16
 	connectionsData      map[uint16]*connectData
 	lastHandle           uint16
 	localServices        []rawService
 	localCharacteristics []rawCharacteristic
 	attributes           []rawAttribute
+
+	// preallocated storage used in static allocation mode
+	values          []byte
+	connectionSlots []connectData
 }
 
 func newATT(hci *hci) *att {
 	return &att{
 		hci:                  hci,
 		localCharacteristics: []rawCharacteristic{},
-		notifications:        make(chan rawNotification, 32),
+		notifications:        make(chan rawNotification, notificationBufferCount),
 		connections:          []uint16{},
 		connectionsData:      make(map[uint16]*connectData),
 		lastHandle:           0x0001,
+		timeout:              defaultATTTimeout,
 		attributes:           []rawAttribute{},
 		localServices:        []rawService{},
 		maxMTU:               248,
 	}
 }
 
-func (a *att) readByGroupReq(connectionHandle, startHandle, endHandle uint16, uuid shortUUID) error {
+func (a *att) readByGroupReq(connectionHandle, startHandle, endHandle uint16, uuid shortUUID, timeout time.Duration) error {
 	if debug {
 		println("att.readByGroupReq:", connectionHandle, startHandle, endHandle, uuid)
 	}
@@ -313,10 +379,10 @@ func (a *att) readByGroupReq(connectionHandle, startHandle, endHandle uint16, uu
 		return err
 	}
 
-	return a.waitUntilResponse(connectionHandle)
+	return a.waitUntilResponse(connectionHandle, timeout)
 }
 
-func (a *att) readByTypeReq(connectionHandle, startHandle, endHandle uint16, typ uint16) error {
+func (a *att) readByTypeReq(connectionHandle, startHandle, endHandle uint16, typ uint16, timeout time.Duration) error {
 	if debug {
 		println("att.readByTypeReq:", connectionHandle, startHandle, endHandle, typ)
 	}
@@ -334,10 +400,10 @@ func (a *att) readByTypeReq(connectionHandle, startHandle, endHandle uint16, typ
 		return err
 	}
 
-	return a.waitUntilResponse(connectionHandle)
+	return a.waitUntilResponse(connectionHandle, timeout)
 }
 
-func (a *att) findInfoReq(connectionHandle, startHandle, endHandle uint16) error {
+func (a *att) findInfoReq(connectionHandle, startHandle, endHandle uint16, timeout time.Duration) error {
 	if debug {
 		println("att.findInfoReq:", connectionHandle, startHandle, endHandle)
 	}
@@ -354,10 +420,12 @@ func (a *att) findInfoReq(connectionHandle, startHandle, endHandle uint16) error
 		return err
 	}
 
-	return a.waitUntilResponse(connectionHandle)
+	return a.waitUntilResponse(connectionHandle, timeout)
 }
 
-func (a *att) readReq(connectionHandle, valueHandle uint16) error {
+// readReq reads an attribute value. The request is aborted after timeout, or
+// after the default ATT timeout if it is zero.
+func (a *att) readReq(connectionHandle, valueHandle uint16, timeout time.Duration) error {
 	if debug {
 		println("att.readReq:", connectionHandle, valueHandle)
 	}
@@ -373,7 +441,30 @@ func (a *att) readReq(connectionHandle, valueHandle uint16) error {
 		return err
 	}
 
-	return a.waitUntilResponse(connectionHandle)
+	return a.waitUntilResponse(connectionHandle, timeout)
+}
+
+// readBlobReq reads the part of a long attribute value starting at offset. The
+// request is aborted after timeout, or after the default ATT timeout if it is
+// zero.
+func (a *att) readBlobReq(connectionHandle, valueHandle, offset uint16, timeout time.Duration) error {
+	if debug {
+		println("att.readBlobReq:", connectionHandle, valueHandle, offset)
+	}
+
+	a.busy.Lock()
+	defer a.busy.Unlock()
+
+	var b [5]byte
+	b[0] = attOpReadBlobReq
+	binary.LittleEndian.PutUint16(b[1:], valueHandle)
+	binary.LittleEndian.PutUint16(b[3:], offset)
+
+	if err := a.sendReq(connectionHandle, b[:]); err != nil {
+		return err
+	}
+
+	return a.waitUntilResponse(connectionHandle, timeout)
 }
 
 func (a *att) writeCmd(connectionHandle, valueHandle uint16, data []byte) error {
@@ -384,18 +475,20 @@ func (a *att) writeCmd(connectionHandle, valueHandle uint16, data []byte) error
 	a.busy.Lock()
 	defer a.busy.Unlock()
 
-	var b [3]byte
-	b[0] = attOpWriteCmd
-	binary.LittleEndian.PutUint16(b[1:], valueHandle)
+	b, err := a.buildPDU(attOpWriteCmd, valueHandle, data)
+	if err != nil {
+		return err
+	}
+	defer a.hci.pool.put(b)
 
-	if err := a.sendReq(connectionHandle, append(b[:], data...)); err != nil {
+	if err := a.sendReq(connectionHandle, b); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (a *att) writeReq(connectionHandle, valueHandle uint16, data []byte) error {
+func (a *att) writeReq(connectionHandle, valueHandle uint16, data []byte, timeout time.Duration) error {
 	if debug {
 		println("att.writeReq:", connectionHandle, valueHandle, hex.EncodeToString(data))
 	}
@@ -403,20 +496,123 @@ func (a *att) writeReq(connectionHandle, valueHandle uint16, data []byte) error
 	a.busy.Lock()
 	defer a.busy.Unlock()
 
-	var b [3]byte
-	b[0] = attOpWriteReq
+	b, err := a.buildPDU(attOpWriteReq, valueHandle, data)
+	if err != nil {
+		return err
+	}
+	defer a.hci.pool.put(b)
+
+	if err := a.sendReq(connectionHandle, b); err != nil {
+		return err
+	}
+
+	return a.waitUntilResponse(connectionHandle, timeout)
+}
+
+// prepWriteReq queues part of a long write at offset, to be written by
+// execWriteReq. The server echoes the part, which is checked.
+func (a *att) prepWriteReq(connectionHandle, valueHandle, offset uint16, data []byte, timeout time.Duration) error {
+	if debug {
+		println("att.prepWriteReq:", connectionHandle, valueHandle, offset, hex.EncodeToString(data))
+	}
+
+	if 5+len(data) > poolBufferSize {
+		return ErrHCIPDUTooLarge
+	}
+
+	b, err := a.hci.pool.get()
+	if err != nil {
+		return err
+	}
+	defer a.hci.pool.put(b)
+
+	b[0] = attOpPrepWriteReq
 	binary.LittleEndian.PutUint16(b[1:], valueHandle)
+	binary.LittleEndian.PutUint16(b[3:], offset)
+	b = b[:5+copy(b[5:], data)]
+
+	a.busy.Lock()
+	defer a.busy.Unlock()
 
-	if err := a.sendReq(connectionHandle, append(b[:], data...)); err != nil {
+	if err := a.sendReq(connectionHandle, b); err != nil {
 		return err
 	}
 
-	return a.waitUntilResponse(connectionHandle)
+	if err := a.waitUntilResponse(connectionHandle, timeout); err != nil {
+		return err
+	}
+
+	cd, err := a.findConnectionData(connectionHandle)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(cd.value, b[1:]) {
+		return errWriteFailed
+	}
+
+	return nil
 }
 
-func (a *att) mtuReq(connectionHandle uint16) error {
+// execWriteReq writes the queued parts of a long write, or discards them if
+// execute is false.
+func (a *att) execWriteReq(connectionHandle uint16, execute bool, timeout time.Duration) error {
 	if debug {
-		println("att.mtuReq:", connectionHandle)
+		println("att.execWriteReq:", connectionHandle, execute)
+	}
+
+	a.busy.Lock()
+	defer a.busy.Unlock()
+
+	var b [2]byte
+	b[0] = attOpExecWriteReq
+	if execute {
+		b[1] = 0x01
+	}
+
+	if err := a.sendReq(connectionHandle, b[:]); err != nil {
+		return err
+	}
+
+	return a.waitUntilResponse(connectionHandle, timeout)
+}
+
+// writeLong writes a value that doesn't fit in a write request, in parts that
+// are written together at the end.
+func (a *att) writeLong(connectionHandle, valueHandle uint16, data []byte, timeout time.Duration) error {
+	if err := a.prepWrite(connectionHandle, valueHandle, data, timeout); err != nil {
+		return err
+	}
+
+	return a.execWriteReq(connectionHandle, true, timeout)
+}
+
+// prepWrite queues a whole value with prepare write requests. If one fails, the
+// queue of the server is discarded.
+func (a *att) prepWrite(connectionHandle, valueHandle uint16, data []byte, timeout time.Duration) error {
+	part := int(a.connectionMTU(connectionHandle)) - 5
+	for offset := 0; offset == 0 || offset < len(data); offset += part {
+		end := offset + part
+		if end > len(data) {
+			end = len(data)
+		}
+
+		if err := a.prepWriteReq(connectionHandle, valueHandle, uint16(offset), data[offset:end], timeout); err != nil {
+			// keep the error of the failed part
+			a.execWriteReq(connectionHandle, false, timeout)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mtuReq exchanges the MTU of the connection, offering mtu or the maximum MTU
+// supported, whichever is lower. The MTU of the connection is then the lower of
+// the offer and the MTU of the server.
+func (a *att) mtuReq(connectionHandle, mtu uint16, timeout time.Duration) error {
+	if debug {
+		println("att.mtuReq:", connectionHandle, mtu)
 	}
 
 	cd, err := a.findConnectionData(connectionHandle)
@@ -424,18 +620,88 @@ func (a *att) mtuReq(connectionHandle uint16) error {
 		return err
 	}
 
+	if mtu > a.maxMTU {
+		mtu = a.maxMTU
+	}
+	if mtu < defaultMTU {
+		mtu = defaultMTU
+	}
+
 	a.busy.Lock()
 	defer a.busy.Unlock()
 
 	var b [3]byte
 	b[0] = attOpMTUReq
-	binary.LittleEndian.PutUint16(b[1:], cd.mtu)
+	binary.LittleEndian.PutUint16(b[1:], mtu)
 
 	if err := a.sendReq(connectionHandle, b[:]); err != nil {
 		return err
 	}
 
-	return a.waitUntilResponse(connectionHandle)
+	if err := a.waitUntilResponse(connectionHandle, timeout); err != nil {
+		return err
+	}
+
+	// cd.mtu is the MTU of the server
+	if cd.mtu > mtu {
+		cd.mtu = mtu
+	}
+	if cd.mtu < defaultMTU {
+		cd.mtu = defaultMTU
+	}
+	cd.mtuExchanged = true
+
+	return nil
+}
+
+// connectionMTU returns the MTU of the connection, which is the default MTU
+// until it has been exchanged.
+func (a *att) connectionMTU(connectionHandle uint16) uint16 {
+	cd, err := a.findConnectionData(connectionHandle)
+	if err != nil || cd.mtu < defaultMTU {
+		return defaultMTU
+	}
+
+	return cd.mtu
+}
+
+// responseLimit returns the maximum length of a response on the connection,
+// which is its MTU unless the response buffer is shorter.
+func (a *att) responseLimit(connectionHandle uint16, size int) int {
+	if mtu := int(a.connectionMTU(connectionHandle)); mtu < size {
+		return mtu
+	}
+
+	return size
+}
+
+// buildPDU assembles an ATT PDU consisting of an opcode, an attribute handle
+// and a value in a buffer from the pool. The caller must return the buffer to
+// the pool once the PDU has been sent.
+func (a *att) buildPDU(opcode uint8, handle uint16, data []byte) ([]byte, error) {
+	if 3+len(data) > poolBufferSize {
+		return nil, ErrHCIPDUTooLarge
+	}
+
+	b, err := a.hci.pool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	b[0] = opcode
+	binary.LittleEndian.PutUint16(b[1:], handle)
+	n := copy(b[3:], data)
+
+	return b[:3+n], nil
+}
+
+// localMTU returns the MTU supported by the local server.
+func (a *att) localMTU() uint16 {
+	if a.serverMTU != 0 && a.serverMTU < a.maxMTU {
+		return a.serverMTU
+	}
+
+	return a.maxMTU
 }
 
 func (a *att) setMaxMTU(mtu uint16) error {
@@ -449,6 +715,12 @@ func (a *att) sendReq(handle uint16, data []byte) error {
 		return err
 	}
 
+	cd, err := a.findConnectionData(handle)
+	if err != nil {
+		return err
+	}
+	cd.pending = true
+
 	if debug {
 		println("att.sendReq:", handle, "data:", hex.EncodeToString(data))
 	}
@@ -460,31 +732,158 @@ func (a *att) sendReq(handle uint16, data []byte) error {
 	return nil
 }
 
-func (a *att) sendNotification(handle uint16, data []byte) error {
+// sendNotificationTo sends a notification to a single connection.
+func (a *att) sendNotificationTo(connection, handle uint16, data []byte) error {
 	if debug {
-		println("att.sendNotifications:", handle, "data:", hex.EncodeToString(data))
+		println("att.sendNotificationTo:", connection, handle, "data:", hex.EncodeToString(data))
+	}
+
+	if _, err := a.findConnectionData(connection); err != nil {
+		return err
 	}
 
 	a.busy.Lock()
 	defer a.busy.Unlock()
 
-	var b [3]byte
-	b[0] = attOpHandleNotify
-	binary.LittleEndian.PutUint16(b[1:], handle)
+	b, err := a.buildPDU(attOpHandleNotify, handle, data)
+	if err != nil {
+		return err
+	}
+	defer a.hci.pool.put(b)
 
-	for connection := range a.connections {
-		if debug {
-			println("att.sendNotifications: sending to", connection)
-		}
+	return a.hci.sendAclPkt(connection, attCID, b)
+}
+
+// sendIndicationTo sends an indication to a single connection, and waits for
+// it to be confirmed.
+func (a *att) sendIndicationTo(connection, handle uint16, data []byte) error {
+	if debug {
+		println("att.sendIndicationTo:", connection, handle, "data:", hex.EncodeToString(data))
+	}
+
+	cd, err := a.findConnectionData(connection)
+	if err != nil {
+		return err
+	}
+
+	a.busy.Lock()
+	defer a.busy.Unlock()
+
+	b, err := a.buildPDU(attOpHandleInd, handle, data)
+	if err != nil {
+		return err
+	}
+	defer a.hci.pool.put(b)
+
+	cd.confirmed = false
+	if err := a.hci.sendAclPkt(connection, attCID, b); err != nil {
+		return err
+	}
+
+	return a.waitUntilConfirmed(cd)
+}
+
+// sendIndicationNoWait sends an indication to a single connection, without
+// waiting for its confirmation. It can be called from the event loop.
+func (a *att) sendIndicationNoWait(connection, handle uint16, data []byte) error {
+	if debug {
+		println("att.sendIndicationNoWait:", connection, handle, "data:", hex.EncodeToString(data))
+	}
+
+	cd, err := a.findConnectionData(connection)
+	if err != nil {
+		return err
+	}
+	cd.confirmed = false
 
-		if err := a.hci.sendAclPkt(uint16(connection), attCID, append(b[:], data...)); err != nil {
+	b, err := a.buildPDU(attOpHandleInd, handle, data)
+	if err != nil {
+		return err
+	}
+	defer a.hci.pool.put(b)
+
+	return a.hci.sendAclPkt(connection, attCID, b)
+}
+
+// waitUntilConfirmed waits for the client to confirm the indication that was
+// sent on the connection, or for the ATT timeout.
+func (a *att) waitUntilConfirmed(cd *connectData) error {
+	start := time.Now().UnixNano()
+	for !cd.confirmed {
+		if err := a.hci.poll(); err != nil && err != ErrATTOp {
 			return err
 		}
+
+		if time.Now().UnixNano()-start > int64(a.timeout) {
+			return ErrTimeout
+		}
+
+		if !cd.confirmed {
+			a.hci.pollWait()
+		}
 	}
 
 	return nil
 }
 
+// queueNotification queues a notification for the notification worker, which
+// calls the callback. If the queue is full, or all notification buffers are in
+// use, the overflow policy decides which notification is dropped. It never
+// waits, as it is called from the event loop, which the callbacks may need to
+// make requests.
+func (a *att) queueNotification(connectionHandle, handle uint16, value []byte) {
+	data, err := a.hci.notificationPool.get()
+	for err != nil {
+		if a.notificationPolicy != NotificationDropOldest {
+			a.droppedNotifications.Add(1)
+			return
+		}
+
+		select {
+		case old := <-a.notifications:
+			a.hci.notificationPool.put(old.data)
+		default:
+			// all buffers are held by running callbacks
+			a.droppedNotifications.Add(1)
+			return
+		}
+
+		a.droppedNotifications.Add(1)
+		data, err = a.hci.notificationPool.get()
+	}
+
+	not := rawNotification{
+		connectionHandle: connectionHandle,
+		handle:           handle,
+		data:             data[:copy(data, value)],
+	}
+
+	switch a.notificationPolicy {
+	case NotificationDropOldest:
+		for {
+			select {
+			case a.notifications <- not:
+				return
+			default:
+			}
+
+			select {
+			case old := <-a.notifications:
+				a.hci.notificationPool.put(old.data)
+				a.droppedNotifications.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case a.notifications <- not:
+		default:
+			a.hci.notificationPool.put(data)
+			a.droppedNotifications.Add(1)
+		}
+	}
+}
+
 func (a *att) sendError(handle uint16, opcode uint8, hdl uint16, code uint8) error {
 	if err := a.clearResponse(handle); err != nil {
 		return err
@@ -517,6 +916,15 @@ func (a *att) handleData(handle uint16, buf []byte) error {
 		return err
 	}
 
+	if isATTResponse(buf[0]) && !cd.pending {
+		// late response to a request that has timed out
+		if debug {
+			println("att.handleData: dropping response without pending request", buf[0])
+		}
+
+		return nil
+	}
+
 	switch buf[0] {
 	case attOpError:
 		cd.errored = true
@@ -535,12 +943,16 @@ func (a *att) handleData(handle uint16, buf []byte) error {
 			println("att.handleData: attOpMTUReq", hex.EncodeToString(buf))
 		}
 		mtu := binary.LittleEndian.Uint16(buf[1:])
-		if mtu > a.maxMTU {
-			mtu = a.maxMTU
+		if mtu > a.localMTU() {
+			mtu = a.localMTU()
+		}
+		if mtu < defaultMTU {
+			mtu = defaultMTU
 		}
 
 		// save mtu for connection
 		cd.mtu = mtu
+		cd.mtuExchanged = true
 
 		var b [3]byte
 		b[0] = attOpMTUResponse
@@ -608,6 +1020,10 @@ func (a *att) handleData(handle uint16, buf []byte) error {
 		}
 		cd.responded = true
 
+		// the raw response is kept for values other than characteristic
+		// declarations, such as the Database Hash
+		cd.value = append(cd.value, buf[1:]...)
+
 		lengthPerCharacteristic := int(buf[1])
 
 		for i := 2; i < len(buf); i += lengthPerCharacteristic {
@@ -668,13 +1084,24 @@ func (a *att) handleData(handle uint16, buf []byte) error {
 			println("att.handleData: attOpReadBlobReq")
 		}
 
-	case attOpReadResponse:
+		attrHandle := binary.LittleEndian.Uint16(buf[1:])
+		offset := binary.LittleEndian.Uint16(buf[3:])
+		return a.handleReadBlobReq(handle, attrHandle, offset)
+
+	case attOpReadResponse, attOpReadBlobResponse:
 		if debug {
 			println("att.handleData: attOpReadResponse")
 		}
 		cd.responded = true
 		cd.value = append(cd.value, buf[1:]...)
 
+	case attOpReadMultiResponse, attOpReadMultiVarResponse:
+		if debug {
+			println("att.handleData: attOpReadMultiResponse")
+		}
+		cd.responded = true
+		cd.value = append(cd.value, buf[1:]...)
+
 	case attOpWriteReq:
 		if debug {
 			println("att.handleData: attOpWriteReq")
@@ -688,49 +1115,63 @@ func (a *att) handleData(handle uint16, buf []byte) error {
 			println("att.handleData: attOpWriteCmd")
 		}
 
+		a.handleWriteCmd(handle, binary.LittleEndian.Uint16(buf[1:]), buf[3:])
+
 	case attOpWriteResponse:
 		if debug {
 			println("att.handleData: attOpWriteResponse")
 		}
 		cd.responded = true
 
+	case attOpPrepWriteResponse:
+		if debug {
+			println("att.handleData: attOpPrepWriteResponse")
+		}
+		cd.responded = true
+		cd.value = append(cd.value, buf[1:]...)
+
+	case attOpExecWriteResponse:
+		if debug {
+			println("att.handleData: attOpExecWriteResponse")
+		}
+		cd.responded = true
+
 	case attOpPrepWriteReq:
 		if debug {
 			println("att.handleData: attOpPrepWriteReq")
 		}
 
+		return a.handlePrepWriteReq(handle, cd, buf)
+
 	case attOpExecWriteReq:
 		if debug {
 			println("att.handleData: attOpExecWriteReq")
 		}
 
+		return a.handleExecWriteReq(handle, cd, buf[1])
+
 	case attOpHandleNotify:
 		if debug {
 			println("att.handleData: attOpHandleNotify")
 		}
 
-		not := rawNotification{
-			connectionHandle: handle,
-			handle:           binary.LittleEndian.Uint16(buf[1:]),
-			data:             []byte{},
-		}
-		not.data = append(not.data, buf[3:]...)
-
-		select {
-		case a.notifications <- not:
-		default:
-			// out of space, drop notification :(
-		}
+		a.queueNotification(handle, binary.LittleEndian.Uint16(buf[1:]), buf[3:])
 
 	case attOpHandleInd:
 		if debug {
 			println("att.handleData: attOpHandleInd")
 		}
 
+		a.queueNotification(handle, binary.LittleEndian.Uint16(buf[1:]), buf[3:])
+
+		// the server waits for the confirmation before the next indication
+		return a.hci.sendAclPkt(handle, attCID, []byte{attOpHandleCNF})
+
 	case attOpHandleCNF:
 		if debug {
 			println("att.handleData: attOpHandleCNF")
 		}
+		cd.confirmed = true
 
 	case attOpReadMultiReq:
 		if debug {
@@ -780,7 +1221,7 @@ func (a *att) handleReadByGroupReq(handle, start, end uint16, uuid shortUUID) er
 				s.Read(response[pos : pos+length])
 				pos += length
 
-				if uint16(pos+length) > a.mtu {
+				if pos+length > a.responseLimit(handle, len(response)) {
 					break
 				}
 			}
@@ -846,7 +1287,7 @@ func (a *att) handleReadByTypeReq(handle, start, end uint16, uuid shortUUID) err
 				c.Read(response[pos : pos+length])
 				pos += length
 
-				if uint16(pos+length) > a.mtu {
+				if pos+length > a.responseLimit(handle, len(response)) {
 					break
 				}
 			}
@@ -864,6 +1305,38 @@ func (a *att) handleReadByTypeReq(handle, start, end uint16, uuid shortUUID) err
 
 		return nil
 
+	case shortUUID(gattIncludeUUID):
+		pos = 2
+		response[1] = 0
+
+		for i := range a.attributes {
+			attr := &a.attributes[i]
+			if attr.typ != attributeTypeInclude || attr.handle < start || attr.handle > end {
+				continue
+			}
+
+			length := 2 + len(attr.value)
+			if response[1] == 0 {
+				response[1] = byte(length)
+			} else if response[1] != byte(length) {
+				// change of UUID size
+				break
+			}
+
+			attr.Read(response[pos : pos+length])
+			pos += length
+
+			if pos+length > a.responseLimit(handle, len(response)) {
+				break
+			}
+		}
+		switch {
+		case pos > 2:
+			return a.hci.sendAclPkt(handle, attCID, response[:pos])
+		default:
+			return a.sendError(handle, attOpReadByTypeReq, start, attErrorAttrNotFound)
+		}
+
 	default:
 		if debug {
 			println("handleReadByTypeReq: unknown uuid", New16BitUUID(uint16(uuid)).String())
@@ -912,7 +1385,7 @@ func (a *att) handleFindInfoReq(handle, start, end uint16) error {
 			attr.Read(response[pos : pos+length])
 			pos += length
 
-			if uint16(pos+length) >= a.mtu {
+			if pos+length > a.responseLimit(handle, len(response)) {
 				break
 			}
 		}
@@ -932,65 +1405,107 @@ func (a *att) handleFindInfoReq(handle, start, end uint16) error {
 }
 
 func (a *att) handleReadReq(handle, attrHandle uint16) error {
+	return a.handleRead(handle, attOpReadReq, attrHandle, 0)
+}
+
+func (a *att) handleReadBlobReq(handle, attrHandle, offset uint16) error {
+	return a.handleRead(handle, attOpReadBlobReq, attrHandle, offset)
+}
+
+// handleRead answers a Read or Read Blob request with the value of the
+// attribute from the offset, up to the MTU of the connection.
+func (a *att) handleRead(handle uint16, opcode uint8, attrHandle, offset uint16) error {
 	attr := a.findAttribute(attrHandle)
 	if attr == nil {
 		if debug {
-			println("att.handleReadReq: attribute not found", attrHandle)
+			println("att.handleRead: attribute not found", attrHandle)
 		}
-		return a.sendError(handle, attOpReadReq, attrHandle, attErrorAttrNotFound)
+		return a.sendError(handle, opcode, attrHandle, attErrorAttrNotFound)
 	}
 
-	var response [64]byte
-	response[0] = attOpReadResponse
-	pos := 1
+	var cccd [2]byte
+	value, code := a.readAttribute(handle, attr, cccd[:])
+	if code != 0 {
+		return a.sendError(handle, opcode, attrHandle, code)
+	}
+
+	if int(offset) > len(value) {
+		return a.sendError(handle, opcode, attrHandle, attErrorInvalidOffset)
+	}
+
+	b, err := a.hci.pool.get()
+	if err != nil {
+		return a.sendError(handle, opcode, attrHandle, attErrorInsufficientResources)
+	}
+	defer a.hci.pool.put(b)
+
+	n := int(a.connectionMTU(handle))
+	if n > len(b) {
+		n = len(b)
+	}
+
+	// the response opcode follows the request opcode
+	b[0] = opcode + 1
+	pos := 1 + copy(b[1:n], value[offset:])
 
+	return a.hci.sendAclPkt(handle, attCID, b[:pos])
+}
+
+// readAttribute returns the value of a local attribute as read by a client,
+// or the ATT error code to send if it can't be read. The value of a CCCD is
+// stored in cccd.
+func (a *att) readAttribute(handle uint16, attr *rawAttribute, cccd []byte) ([]byte, uint8) {
 	switch attr.typ {
 	case attributeTypeCharacteristicValue:
 		if debug {
-			println("att.handleReadReq: reading characteristic value", attrHandle)
+			println("att.readAttribute: reading characteristic value", attr.handle)
 		}
 
 		c := a.findCharacteristic(attr.parent)
 		if c != nil && c.chr != nil {
-			value, err := c.chr.readValue()
-			if err != nil {
-				return a.sendError(handle, attOpReadReq, attrHandle, attErrorReadNotPermitted)
+			if c.chr.authorize != nil {
+				if err := c.chr.authorize(Connection(handle), a.security(handle), false); err != nil {
+					return nil, uint8(authorizeErrorCode(err))
+				}
 			}
 
-			copy(response[pos:], value)
-			pos += len(value)
-
-			if err := a.hci.sendAclPkt(handle, attCID, response[:pos]); err != nil {
-				return err
+			value, err := c.chr.readValue(Connection(handle))
+			if err != nil {
+				return nil, attErrorReadNotPermitted
 			}
 
-			return nil
+			return value, 0
 		}
 
+	case attributeTypeInclude:
+		return attr.value, 0
+
 	case attributeTypeDescriptor:
 		if debug {
-			println("att.handleReadReq: reading descriptor", attrHandle)
+			println("att.readAttribute: reading descriptor", attr.handle)
 		}
 
-		c := a.findCharacteristic(attr.parent)
-		if c != nil && c.chr != nil {
-			cccd, err := c.chr.readCCCD()
-			if err != nil {
-				return a.sendError(handle, attOpReadReq, attrHandle, attErrorReadNotPermitted)
+		if !attr.isCCCD() {
+			if !attr.permissions.Read() {
+				return nil, attErrorReadNotPermitted
 			}
 
-			binary.LittleEndian.PutUint16(response[pos:], cccd)
-			pos += 2
+			return attr.value, 0
+		}
 
-			if err := a.hci.sendAclPkt(handle, attCID, response[:pos]); err != nil {
-				return err
+		c := a.findCharacteristic(attr.parent)
+		if c != nil && c.chr != nil {
+			value, err := c.chr.readCCCD(handle)
+			if err != nil {
+				return nil, attErrorReadNotPermitted
 			}
 
-			return nil
+			binary.LittleEndian.PutUint16(cccd, value)
+			return cccd, 0
 		}
 	}
 
-	return a.sendError(handle, attOpReadReq, attrHandle, attErrorReadNotPermitted)
+	return nil, attErrorReadNotPermitted
 }
 
 func (a *att) handleWriteReq(handle, attrHandle uint16, data []byte) error {
@@ -1002,46 +1517,209 @@ func (a *att) handleWriteReq(handle, attrHandle uint16, data []byte) error {
 		return a.sendError(handle, attOpWriteReq, attrHandle, attErrorAttrNotFound)
 	}
 
+	if code := a.writeAttribute(handle, attr, data, false); code != 0 {
+		return a.sendError(handle, attOpWriteReq, attrHandle, code)
+	}
+
+	if err := a.hci.sendAclPkt(handle, attCID, []byte{attOpWriteResponse}); err != nil {
+		return err
+	}
+
+	if attr.isCCCD() {
+		if c := a.findCharacteristic(attr.parent); c != nil && c.chr != nil {
+			return c.chr.cccdWritten(handle)
+		}
+	}
+
+	return nil
+}
+
+// handleWriteCmd writes the value of a local attribute for a Write Command.
+// Nothing is sent back, even if the write fails.
+func (a *att) handleWriteCmd(handle, attrHandle uint16, data []byte) {
+	attr := a.findAttribute(attrHandle)
+	if attr == nil {
+		if debug {
+			println("att.handleWriteCmd: attribute not found", attrHandle)
+		}
+		return
+	}
+
+	if code := a.writeAttribute(handle, attr, data, true); code != 0 {
+		if debug {
+			println("att.handleWriteCmd: write failed with error", code)
+		}
+		return
+	}
+
+	if attr.isCCCD() {
+		if c := a.findCharacteristic(attr.parent); c != nil && c.chr != nil {
+			c.chr.cccdWritten(handle)
+		}
+	}
+}
+
+// writeAttribute writes the value of a local attribute for a client, with a
+// Write Command if command is set or else a write request. It returns the ATT
+// error code to send to the client, or 0 on success.
+func (a *att) writeAttribute(handle uint16, attr *rawAttribute, data []byte, command bool) uint8 {
 	switch attr.typ {
 	case attributeTypeCharacteristicValue:
 		if debug {
-			println("att.handleWriteReq: writing characteristic value", attrHandle, hex.EncodeToString(data))
+			println("att.writeAttribute: writing characteristic value", attr.handle, hex.EncodeToString(data))
 		}
 
 		c := a.findCharacteristic(attr.parent)
 		if c != nil && c.chr != nil {
-			if _, err := c.chr.Write(data); err != nil {
-				return a.sendError(handle, attOpWriteReq, attrHandle, attErrorWriteNotPermitted)
+			if c.chr.authorize != nil {
+				if err := c.chr.authorize(Connection(handle), a.security(handle), true); err != nil {
+					return uint8(authorizeErrorCode(err))
+				}
 			}
 
-			if err := a.hci.sendAclPkt(handle, attCID, []byte{attOpWriteResponse}); err != nil {
-				return err
+			if command && !c.chr.permissions.WriteWithoutResponse() || !command && !c.chr.permissions.Write() {
+				return attErrorWriteNotPermitted
 			}
 
-			return nil
+			if c.chr.writeHandler != nil {
+				if err := c.chr.writeHandler(Connection(handle), 0, data); err != nil {
+					return uint8(attErrorCode(err))
+				}
+			}
+
+			if _, err := c.chr.Write(data); err != nil {
+				return attErrorWriteNotPermitted
+			}
+
+			return 0
 		}
 
 	case attributeTypeDescriptor:
 		if debug {
-			println("att.handleWriteReq: writing descriptor", attrHandle, hex.EncodeToString(data))
+			println("att.writeAttribute: writing descriptor", attr.handle, hex.EncodeToString(data))
+		}
+
+		if !attr.isCCCD() {
+			if !attr.permissions.Write() {
+				return attErrorWriteNotPermitted
+			}
+
+			if a.hci.static && len(data) > cap(attr.value) {
+				// no room in the preallocated value storage
+				return attErrorInvalidAttrValueLength
+			}
+			attr.value = append(attr.value[:0], data...)
+
+			return 0
+		}
+
+		if len(data) != 2 {
+			return attErrorInvalidAttrValueLength
 		}
 
 		c := a.findCharacteristic(attr.parent)
 		if c != nil && c.chr != nil {
-			if err := c.chr.writeCCCD(binary.LittleEndian.Uint16(data)); err != nil {
-				return a.sendError(handle, attOpWriteReq, attrHandle, attErrorWriteNotPermitted)
+			if err := c.chr.writeCCCD(handle, binary.LittleEndian.Uint16(data)); err != nil {
+				return attErrorWriteNotPermitted
 			}
 
-			if err := a.hci.sendAclPkt(handle, attCID, []byte{attOpWriteResponse}); err != nil {
-				return err
-			}
+			return 0
+		}
+	}
 
-			return nil
+	return attErrorWriteNotPermitted
+}
+
+// maximum length of an attribute value, and so of a prepared write
+const maxAttributeLength = 512
+
+// preparedWrite is a long write of an attribute value by a client, put
+// together from Prepare Write requests until it is executed.
+type preparedWrite struct {
+	handle uint16
+	value  []byte
+}
+
+// handlePrepWriteReq adds a part of a long write to the queue of the
+// connection. Writes are only checked for permissions here, the value is
+// written when the queue is executed.
+func (a *att) handlePrepWriteReq(handle uint16, cd *connectData, buf []byte) error {
+	attrHandle := binary.LittleEndian.Uint16(buf[1:])
+	offset := binary.LittleEndian.Uint16(buf[3:])
+	part := buf[5:]
+
+	if a.hci.static {
+		// the queue can't be allocated
+		return a.sendError(handle, attOpPrepWriteReq, attrHandle, attErrorRequestNotSupported)
+	}
 
+	attr := a.findAttribute(attrHandle)
+	if attr == nil {
+		return a.sendError(handle, attOpPrepWriteReq, attrHandle, attErrorAttrNotFound)
+	}
+
+	writable := attr.permissions.Write()
+	if attr.typ == attributeTypeCharacteristicValue {
+		c := a.findCharacteristic(attr.parent)
+		writable = c != nil && c.chr != nil && c.chr.permissions.Write()
+	}
+	if !writable {
+		return a.sendError(handle, attOpPrepWriteReq, attrHandle, attErrorWriteNotPermitted)
+	}
+
+	var pw *preparedWrite
+	for i := range cd.prepared {
+		if cd.prepared[i].handle == attrHandle {
+			pw = &cd.prepared[i]
+			break
 		}
 	}
+	if pw == nil {
+		cd.prepared = append(cd.prepared, preparedWrite{handle: attrHandle})
+		pw = &cd.prepared[len(cd.prepared)-1]
+	}
 
-	return a.sendError(handle, attOpWriteReq, attrHandle, attErrorWriteNotPermitted)
+	switch {
+	case int(offset) > len(pw.value):
+		return a.sendError(handle, attOpPrepWriteReq, attrHandle, attErrorInvalidOffset)
+	case int(offset)+len(part) > maxAttributeLength:
+		return a.sendError(handle, attOpPrepWriteReq, attrHandle, attErrorInvalidAttrValueLength)
+	}
+	pw.value = append(pw.value[:offset], part...)
+
+	b, err := a.hci.pool.get()
+	if err != nil {
+		return err
+	}
+	defer a.hci.pool.put(b)
+
+	// the response echoes the request
+	n := copy(b, buf)
+	b[0] = attOpPrepWriteResponse
+
+	return a.hci.sendAclPkt(handle, attCID, b[:n])
+}
+
+// handleExecWriteReq writes the values of the queue of the connection, or
+// drops them if the client cancelled the long write.
+func (a *att) handleExecWriteReq(handle uint16, cd *connectData, flags uint8) error {
+	prepared := cd.prepared
+	cd.prepared = nil
+
+	if flags&0x01 != 0 {
+		for _, pw := range prepared {
+			attr := a.findAttribute(pw.handle)
+			if attr == nil {
+				return a.sendError(handle, attOpExecWriteReq, pw.handle, attErrorAttrNotFound)
+			}
+
+			if code := a.writeAttribute(handle, attr, pw.value, false); code != 0 {
+				return a.sendError(handle, attOpExecWriteReq, pw.handle, code)
+			}
+		}
+	}
+
+	return a.hci.sendAclPkt(handle, attCID, []byte{attOpExecWriteResponse})
 }
 
 func (a *att) clearResponse(handle uint16) error {
@@ -1060,57 +1738,101 @@ func (a *att) clearResponse(handle uint16) error {
 	return nil
 }
 
-func (a *att) waitUntilResponse(handle uint16) error {
+// waitUntilResponse waits for the response to the pending request on the
+// connection. If no response arrives before timeout, or before the default ATT
+// timeout if it is zero, the request is abandoned so that the next one can be
+// sent, and a response that still arrives later is dropped.
+func (a *att) waitUntilResponse(handle uint16, timeout time.Duration) error {
 	cd, err := a.findConnectionData(handle)
 	if err != nil {
 		return err
 	}
 
+	if timeout <= 0 {
+		timeout = a.timeout
+	}
+
 	start := time.Now().UnixNano()
 	for {
-		if err := a.hci.poll(); err != nil {
+		if err := a.hci.poll(); err != nil && err != ErrATTOp {
+			cd.pending = false
 			return err
 		}
 
 		switch {
 		case cd.responded:
+			cd.pending = false
 			return nil
 
-		case (time.Now().UnixNano()-start)/int64(time.Second) > defaultTimeoutSeconds:
-			return ErrATTTimeout
+		case cd.errored:
+			cd.pending = false
+			return ErrATTOp
+
+		case time.Now().UnixNano()-start > int64(timeout):
+			if debug {
+				println("att.waitUntilResponse: timeout", handle)
+			}
+
+			cd.pending = false
+			return ErrTimeout
 
 		default:
-			// check for timeout
-			time.Sleep(5 * time.Millisecond)
+			a.hci.pollWait()
 		}
 	}
-
-	return ErrATTTimeout
 }
 
-func (a *att) poll() error {
-	a.busy.Lock()
-	defer a.busy.Unlock()
-
-	if err := a.hci.poll(); err != nil {
-		return err
+// isATTResponse returns whether the opcode is that of a response to a request
+// sent by the client.
+func isATTResponse(opcode uint8) bool {
+	switch opcode {
+	case attOpError, attOpMTUResponse, attOpFindInfoResponse, attOpFindByTypeResponse,
+		attOpReadByTypeResponse, attOpReadResponse, attOpReadBlobResponse,
+		attOpReadMultiResponse, attOpReadByGroupResponse, attOpWriteResponse,
+		attOpPrepWriteResponse, attOpExecWriteResponse, attOpReadMultiVarResponse:
+		return true
 	}
 
-	return nil
+	return false
 }
 
 func (a *att) addConnection(handle uint16) error {
 	if debug {
 		println("att.addConnection:", handle)
 	}
-	a.connections = append(a.connections, handle)
-	a.connectionsData[handle] = &connectData{
-		services:        []rawService{},
-		characteristics: []rawCharacteristic{},
-		value:           []byte{},
+	if !a.hci.static {
+		a.connections = append(a.connections, handle)
+		a.connectionsData[handle] = &connectData{
+			services:        []rawService{},
+			characteristics: []rawCharacteristic{},
+			value:           []byte{},
+		}
+
+		return nil
 	}
 
-	return nil
+	if len(a.connections) == cap(a.connections) {
+		return ErrNoResources
+	}
+
+	for i := range a.connectionSlots {
+		cd := &a.connectionSlots[i]
+		if !cd.used {
+			*cd = connectData{
+				services:        cd.services[:0],
+				characteristics: cd.characteristics[:0],
+				descriptors:     cd.descriptors[:0],
+				value:           cd.value[:0],
+				used:            true,
+			}
+			a.connections = append(a.connections, handle)
+			a.connectionsData[handle] = cd
+
+			return nil
+		}
+	}
+
+	return ErrNoResources
 }
 
 func (a *att) removeConnection(handle uint16) error {
@@ -1118,9 +1840,18 @@ func (a *att) removeConnection(handle uint16) error {
 		println("att.removeConnection:", handle)
 	}
 
+	for i := range a.localCharacteristics {
+		if chr := a.localCharacteristics[i].chr; chr != nil {
+			chr.removeSubscriber(handle)
+		}
+	}
+
 	for i := range a.connections {
 		if a.connections[i] == handle {
 			a.connections = append(a.connections[:i], a.connections[i+1:]...)
+			if cd, ok := a.connectionsData[handle]; ok {
+				cd.used = false
+			}
 			delete(a.connectionsData, handle)
 			break
 		}
@@ -1129,7 +1860,16 @@ func (a *att) removeConnection(handle uint16) error {
 	return nil
 }
 
-func (a *att) addLocalAttribute(typ attributeType, parent uint16, uuid UUID, permissions CharacteristicPermissions, value []byte) uint16 {
+func (a *att) addLocalAttribute(typ attributeType, parent uint16, uuid UUID, permissions CharacteristicPermissions, value []byte) (uint16, error) {
+	if !a.hci.hasRoom(len(a.attributes), cap(a.attributes)) {
+		return 0, ErrNoResources
+	}
+
+	v, err := a.storeValue(value)
+	if err != nil {
+		return 0, err
+	}
+
 	handle := a.lastHandle
 	a.attributes = append(a.attributes,
 		rawAttribute{
@@ -1138,22 +1878,108 @@ func (a *att) addLocalAttribute(typ attributeType, parent uint16, uuid UUID, per
 			handle:      handle,
 			uuid:        uuid,
 			permissions: permissions,
-			value:       append([]byte{}, value...),
+			value:       v,
 		})
 	a.lastHandle++
 
-	return handle
+	return handle, nil
+}
+
+// storeValue returns a copy of an attribute value. In static allocation mode,
+// the copy is taken from the preallocated value storage.
+func (a *att) storeValue(value []byte) ([]byte, error) {
+	if !a.hci.static {
+		return append([]byte{}, value...), nil
+	}
+
+	if len(a.values)+len(value) > cap(a.values) {
+		return nil, ErrNoResources
+	}
+
+	start := len(a.values)
+	a.values = append(a.values, value...)
+
+	return a.values[start:len(a.values):len(a.values)], nil
 }
 
-func (a *att) addLocalService(start, end uint16, uuid UUID) {
+func (a *att) addLocalService(start, end uint16, uuid UUID) error {
+	if !a.hci.hasRoom(len(a.localServices), cap(a.localServices)) {
+		return ErrNoResources
+	}
+
 	a.localServices = append(a.localServices, rawService{
 		startHandle: start,
 		endHandle:   end,
 		uuid:        uuid,
 	})
+
+	return nil
 }
 
-func (a *att) addLocalCharacteristic(startHandle uint16, properties CharacteristicPermissions, valueHandle uint16, uuid UUID, chr *Characteristic) {
+// security returns the security level of the connection.
+func (a *att) security(handle uint16) SecurityLevel {
+	cd, err := a.findConnectionData(handle)
+	if err != nil || !cd.encrypted {
+		return SecurityNone
+	}
+
+	return SecurityEncrypted
+}
+
+// findLocalService returns the range of handles of the local service that
+// starts at the handle.
+func (a *att) findLocalService(start uint16) (uint16, uint16, bool) {
+	for _, s := range a.localServices {
+		if s.startHandle == start && start != 0 {
+			return s.startHandle, s.endHandle, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// removeLocalService removes the service that starts at the handle, and all its
+// attributes. It returns the range of handles that were removed.
+func (a *att) removeLocalService(start uint16) (uint16, uint16, bool) {
+	end := uint16(0)
+	services := a.localServices[:0]
+	for _, s := range a.localServices {
+		if s.startHandle == start {
+			end = s.endHandle
+			continue
+		}
+		services = append(services, s)
+	}
+	a.localServices = services
+
+	if end == 0 {
+		return 0, 0, false
+	}
+
+	characteristics := a.localCharacteristics[:0]
+	for _, c := range a.localCharacteristics {
+		if c.startHandle < start || c.startHandle > end {
+			characteristics = append(characteristics, c)
+		}
+	}
+	a.localCharacteristics = characteristics
+
+	attributes := a.attributes[:0]
+	for _, attr := range a.attributes {
+		if attr.handle < start || attr.handle > end {
+			attributes = append(attributes, attr)
+		}
+	}
+	a.attributes = attributes
+
+	return start, end, true
+}
+
+func (a *att) addLocalCharacteristic(startHandle uint16, properties CharacteristicPermissions, valueHandle uint16, uuid UUID, chr *Characteristic) error {
+	if !a.hci.hasRoom(len(a.localCharacteristics), cap(a.localCharacteristics)) {
+		return ErrNoResources
+	}
+
 	a.localCharacteristics = append(a.localCharacteristics,
 		rawCharacteristic{
 			startHandle: startHandle,
@@ -1162,6 +1988,8 @@ func (a *att) addLocalCharacteristic(startHandle uint16, properties Characterist
 			uuid:        uuid,
 			chr:         chr,
 		})
+
+	return nil
 }
 
 func (a *att) findAttribute(hdl uint16) *rawAttribute {
@@ -0,0 +1,140 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// newTestCharacteristic returns an ATT server with a single local
+// characteristic, and the attribute of its value.
+func newTestCharacteristic(permissions CharacteristicPermissions, authorize AuthorizeHandler) (*att, *rawAttribute, *Characteristic) {
+	a := newATT(newHCI(&fakeTransport{}))
+
+	chr := &Characteristic{
+		adapter:     &Adapter{},
+		handle:      2,
+		permissions: permissions,
+		value:       []byte{0x00, 0x00},
+		authorize:   authorize,
+	}
+	a.addLocalCharacteristic(1, permissions, 2, New16BitUUID(0x2a37), chr)
+
+	return a, &rawAttribute{typ: attributeTypeCharacteristicValue, parent: 1, handle: 2}, chr
+}
+
+// denyAll is an authorization hook that denies every access and records the
+// last one.
+type denyAll struct {
+	calls int
+	write bool
+}
+
+func (d *denyAll) authorize(client Connection, security SecurityLevel, write bool) error {
+	d.calls++
+	d.write = write
+	return errors.New("denied")
+}
+
+func TestAuthorizeNotifyOnly(t *testing.T) {
+	deny := &denyAll{}
+	a, attr, chr := newTestCharacteristic(CharacteristicNotifyPermission, deny.authorize)
+
+	var cccd [2]byte
+	if _, code := a.readAttribute(1, attr, cccd[:]); code != uint8(ATTErrorInsufficientAuthorization) {
+		t.Errorf("expected Insufficient Authorization on read, got %#x", code)
+	}
+	if deny.calls != 1 || deny.write {
+		t.Errorf("expected the hook to be called for a read, got %d calls", deny.calls)
+	}
+
+	if code := a.writeAttribute(1, attr, []byte{0x01, 0x02}, false); code != uint8(ATTErrorInsufficientAuthorization) {
+		t.Errorf("expected Insufficient Authorization on write request, got %#x", code)
+	}
+	if deny.calls != 2 || !deny.write {
+		t.Errorf("expected the hook to be called for a write, got %d calls", deny.calls)
+	}
+
+	if !bytes.Equal(chr.value, []byte{0x00, 0x00}) {
+		t.Errorf("expected the value to be unchanged, got %x", chr.value)
+	}
+
+	// without a hook, the properties still don't allow it
+	a, attr, chr = newTestCharacteristic(CharacteristicNotifyPermission, nil)
+	if _, code := a.readAttribute(1, attr, cccd[:]); code != attErrorReadNotPermitted {
+		t.Errorf("expected Read Not Permitted, got %#x", code)
+	}
+	if code := a.writeAttribute(1, attr, []byte{0x01, 0x02}, false); code != attErrorWriteNotPermitted {
+		t.Errorf("expected Write Not Permitted on write request, got %#x", code)
+	}
+	if code := a.writeAttribute(1, attr, []byte{0x01, 0x02}, true); code != attErrorWriteNotPermitted {
+		t.Errorf("expected Write Not Permitted on write command, got %#x", code)
+	}
+	if !bytes.Equal(chr.value, []byte{0x00, 0x00}) {
+		t.Errorf("expected the value to be unchanged, got %x", chr.value)
+	}
+}
+
+func TestAuthorizeWriteWithoutResponseOnly(t *testing.T) {
+	deny := &denyAll{}
+	a, attr, chr := newTestCharacteristic(CharacteristicWriteWithoutResponsePermission, deny.authorize)
+
+	if code := a.writeAttribute(1, attr, []byte{0x01, 0x02}, true); code != uint8(ATTErrorInsufficientAuthorization) {
+		t.Errorf("expected Insufficient Authorization on write command, got %#x", code)
+	}
+	if deny.calls != 1 || !deny.write {
+		t.Errorf("expected the hook to be called for a write, got %d calls", deny.calls)
+	}
+	if !bytes.Equal(chr.value, []byte{0x00, 0x00}) {
+		t.Errorf("expected the value to be unchanged, got %x", chr.value)
+	}
+
+	a, attr, chr = newTestCharacteristic(CharacteristicWriteWithoutResponsePermission, nil)
+	if code := a.writeAttribute(1, attr, []byte{0x01, 0x02}, false); code != attErrorWriteNotPermitted {
+		t.Errorf("expected Write Not Permitted on write request, got %#x", code)
+	}
+	if !bytes.Equal(chr.value, []byte{0x00, 0x00}) {
+		t.Errorf("expected the value to be unchanged, got %x", chr.value)
+	}
+
+	if code := a.writeAttribute(1, attr, []byte{0x01, 0x02}, true); code != 0 {
+		t.Errorf("expected write command to succeed, got %#x", code)
+	}
+	if !bytes.Equal(chr.value, []byte{0x01, 0x02}) {
+		t.Errorf("expected the value to be written, got %x", chr.value)
+	}
+}
+
+func TestLongWrite(t *testing.T) {
+	a, attr, chr := newTestCharacteristic(CharacteristicWritePermission, nil)
+	a.attributes = append(a.attributes, *attr)
+	if err := a.addConnection(1); err != nil {
+		t.Fatal(err)
+	}
+	cd, err := a.findConnectionData(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a value longer than the current one, in two Prepare Write requests
+	value := bytes.Repeat([]byte{0x5a}, 40)
+	for offset := 0; offset < len(value); offset += 20 {
+		req := []byte{attOpPrepWriteReq, 0x02, 0x00, byte(offset), 0x00}
+		req = append(req, value[offset:offset+20]...)
+		if err := a.handlePrepWriteReq(1, cd, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(chr.value, []byte{0x00, 0x00}) {
+		t.Errorf("expected the value to be unchanged before execution, got %x", chr.value)
+	}
+
+	if err := a.handleExecWriteReq(1, cd, 0x01); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chr.value, value) {
+		t.Errorf("expected the whole value to be written, got %x", chr.value)
+	}
+}
@@ -0,0 +1,69 @@
+// Package beacon encodes and decodes the advertisements of common beacon
+// formats, to advertise as a beacon or to recognize beacons while scanning:
+//
+//	b := beacon.IBeacon{UUID: uuid, Major: 1, Minor: 2, MeasuredPower: -59}
+//	err := adv.Configure(b.AdvertisementOptions())
+//
+// A beacon advertisement leaves little room in a legacy advertising packet,
+// so the options of a beacon have no local name.
+package beacon
+
+import (
+	"errors"
+
+	"tinygo.org/x/bluetooth"
+)
+
+var (
+	ErrTooLarge = errors.New("beacon: advertisement does not fit in an advertising packet")
+)
+
+// maximum length of the data of a legacy advertising packet, and the length of
+// the flags field that the backends put in front of the beacon data.
+const (
+	maxAdvertisementLength = 31
+	flagsLength            = 3
+)
+
+// Check returns ErrTooLarge if the options don't fit in a legacy advertising
+// packet, as encoded by backends that put all of them in the advertising
+// packet. Some backends send the local name in the scan response instead.
+func Check(options bluetooth.AdvertisementOptions) error {
+	n := flagsLength
+	if options.LocalName != "" {
+		n += 2 + len(options.LocalName)
+	}
+
+	for _, uuid := range options.ServiceUUIDs {
+		if uuid.Is16Bit() {
+			n += 2 + 2
+		} else {
+			n += 2 + 16
+		}
+	}
+
+	for _, element := range options.ManufacturerData {
+		n += 2 + 2 + len(element.Data)
+	}
+
+	for _, element := range options.ServiceData {
+		switch {
+		case element.UUID.Is16Bit():
+			n += 2 + 2 + len(element.Data)
+		case element.UUID.Is32Bit():
+			n += 2 + 4 + len(element.Data)
+		default:
+			n += 2 + 16 + len(element.Data)
+		}
+	}
+
+	if options.Appearance != 0 {
+		n += 2 + 2
+	}
+
+	if n > maxAdvertisementLength {
+		return ErrTooLarge
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package beacon
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+func TestIBeacon(t *testing.T) {
+	uuid, err := bluetooth.ParseUUID("e2c56db5-dffb-48d2-b060-d0f5a71096e0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := IBeacon{UUID: uuid, Major: 1, Minor: 0x0203, MeasuredPower: -59}
+
+	element := b.ManufacturerData()
+	expected := []byte{0x02, 0x15,
+		0xe2, 0xc5, 0x6d, 0xb5, 0xdf, 0xfb, 0x48, 0xd2, 0xb0, 0x60, 0xd0, 0xf5, 0xa7, 0x10, 0x96, 0xe0,
+		0x00, 0x01, 0x02, 0x03, 0xc5}
+	if element.CompanyID != 0x004c || !bytes.Equal(element.Data, expected) {
+		t.Errorf("unexpected manufacturer data: %04x %x", element.CompanyID, element.Data)
+	}
+
+	if err := Check(b.AdvertisementOptions()); err != nil {
+		t.Errorf("iBeacon doesn't fit: %v", err)
+	}
+
+	parsed, ok := ParseIBeacon(element)
+	if !ok || parsed != b {
+		t.Errorf("expected %+v, got %+v (%v)", b, parsed, ok)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	options := IBeacon{}.AdvertisementOptions()
+	options.LocalName = "beacon"
+	if err := Check(options); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestEddystoneURL(t *testing.T) {
+	for _, tc := range []struct {
+		url     string
+		encoded []byte
+		err     error
+	}{
+		{"https://www.example.com/", append([]byte{0x01}, append([]byte("example"), 0x00)...), nil},
+		{"http://tinygo.org", append([]byte{0x02}, append([]byte("tinygo"), 0x08)...), nil},
+		{"https://goo.gl/S6zT6P", append([]byte{0x03}, []byte("goo.gl/S6zT6P")...), nil},
+		{"ftp://example.com", nil, ErrInvalidURL},
+		{"https://a very long url.com", nil, ErrInvalidURL},
+		{"https://averylongdomainname.com", nil, ErrInvalidURL},
+	} {
+		element, err := EddystoneURL{TxPower: -20, URL: tc.url}.ServiceData()
+		if err != tc.err {
+			t.Errorf("%s: expected error %v, got %v", tc.url, tc.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		expected := append([]byte{0x10, 0xec}, tc.encoded...)
+		if element.UUID != EddystoneUUID || !bytes.Equal(element.Data, expected) {
+			t.Errorf("%s: expected %x, got %x", tc.url, expected, element.Data)
+		}
+
+		options, _ := EddystoneURL{URL: tc.url}.AdvertisementOptions()
+		if err := Check(options); err != nil {
+			t.Errorf("%s: %v", tc.url, err)
+		}
+	}
+}
+
+func TestEddystoneTLM(t *testing.T) {
+	element := EddystoneTLM{
+		BatteryVoltage:   3000,
+		Temperature:      21.5,
+		AdvertisingCount: 1000,
+		Uptime:           time.Hour,
+	}.ServiceData()
+
+	expected := []byte{0x20, 0x00, 0x0b, 0xb8, 0x15, 0x80, 0x00, 0x00, 0x03, 0xe8, 0x00, 0x00, 0x8c, 0xa0}
+	if !bytes.Equal(element.Data, expected) {
+		t.Errorf("expected %x, got %x", expected, element.Data)
+	}
+}
@@ -0,0 +1,214 @@
+package beacon
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+var (
+	ErrInvalidURL = errors.New("beacon: URL can't be encoded in an Eddystone-URL frame")
+)
+
+// EddystoneUUID is the 16-bit service UUID of Eddystone, under which the
+// frames are sent as service data.
+var EddystoneUUID = bluetooth.New16BitUUID(0xfeaa)
+
+// Eddystone frame types.
+const (
+	eddystoneUID = 0x00
+	eddystoneURL = 0x10
+	eddystoneTLM = 0x20
+)
+
+// maximum length of an encoded URL, so that the frame fits in an advertising
+// packet.
+const maxEncodedURLLength = 17
+
+// URL scheme prefixes, in the order of their codes.
+var eddystoneSchemes = []string{
+	"http://www.",
+	"https://www.",
+	"http://",
+	"https://",
+}
+
+// URL expansions, in the order of their codes. The ones with a slash come
+// first, so they are preferred.
+var eddystoneExpansions = []string{
+	".com/", ".org/", ".edu/", ".net/", ".info/", ".biz/", ".gov/",
+	".com", ".org", ".edu", ".net", ".info", ".biz", ".gov",
+}
+
+// EddystoneUID is an Eddystone-UID frame, which identifies a beacon.
+type EddystoneUID struct {
+	// TxPower is the RSSI in dBm measured at a distance of 0m.
+	TxPower int8
+
+	// Namespace identifies the beacons of an organization, Instance a beacon
+	// in the namespace.
+	Namespace [10]byte
+	Instance  [6]byte
+}
+
+// ServiceData returns the service data of the frame.
+func (f EddystoneUID) ServiceData() bluetooth.ServiceDataElement {
+	data := make([]byte, 20)
+	data[0] = eddystoneUID
+	data[1] = byte(f.TxPower)
+	copy(data[2:], f.Namespace[:])
+	copy(data[12:], f.Instance[:])
+	// the last two bytes are reserved
+
+	return eddystoneServiceData(data)
+}
+
+// AdvertisementOptions returns the options to advertise the frame.
+func (f EddystoneUID) AdvertisementOptions() bluetooth.AdvertisementOptions {
+	return eddystoneOptions(f.ServiceData())
+}
+
+// EddystoneURL is an Eddystone-URL frame, which broadcasts a URL. The URL is
+// compressed, and must not take more than 17 bytes once compressed: the scheme
+// and the common top-level domains take a single byte.
+type EddystoneURL struct {
+	// TxPower is the RSSI in dBm measured at a distance of 0m.
+	TxPower int8
+
+	URL string
+}
+
+// ServiceData returns the service data of the frame, or ErrInvalidURL if the
+// URL can't be encoded.
+func (f EddystoneURL) ServiceData() (bluetooth.ServiceDataElement, error) {
+	data := make([]byte, 2, 3+maxEncodedURLLength)
+	data[0] = eddystoneURL
+	data[1] = byte(f.TxPower)
+
+	data, err := appendEddystoneURL(data, f.URL)
+	if err != nil {
+		return bluetooth.ServiceDataElement{}, err
+	}
+
+	return eddystoneServiceData(data), nil
+}
+
+// AdvertisementOptions returns the options to advertise the frame, or
+// ErrInvalidURL if the URL can't be encoded.
+func (f EddystoneURL) AdvertisementOptions() (bluetooth.AdvertisementOptions, error) {
+	element, err := f.ServiceData()
+	if err != nil {
+		return bluetooth.AdvertisementOptions{}, err
+	}
+
+	return eddystoneOptions(element), nil
+}
+
+// appendEddystoneURL appends the compressed URL to data.
+func appendEddystoneURL(data []byte, url string) ([]byte, error) {
+	scheme := -1
+	for i, prefix := range eddystoneSchemes {
+		// the longest prefix that matches
+		if strings.HasPrefix(url, prefix) && (scheme < 0 || len(prefix) > len(eddystoneSchemes[scheme])) {
+			scheme = i
+		}
+	}
+	if scheme < 0 {
+		return nil, ErrInvalidURL
+	}
+	data = append(data, byte(scheme))
+	url = url[len(eddystoneSchemes[scheme]):]
+
+	start := len(data)
+	for len(url) > 0 {
+		expanded := false
+		for i, expansion := range eddystoneExpansions {
+			if strings.HasPrefix(url, expansion) {
+				data = append(data, byte(i))
+				url = url[len(expansion):]
+				expanded = true
+				break
+			}
+		}
+		if expanded {
+			continue
+		}
+
+		// other codes are reserved for expansions
+		if url[0] <= 0x20 || url[0] >= 0x7f {
+			return nil, ErrInvalidURL
+		}
+		data = append(data, url[0])
+		url = url[1:]
+	}
+
+	if len(data)-start > maxEncodedURLLength {
+		return nil, ErrInvalidURL
+	}
+
+	return data, nil
+}
+
+// EddystoneTLM is an unencrypted Eddystone-TLM frame, which broadcasts the
+// telemetry of a beacon along with its UID or URL frames.
+type EddystoneTLM struct {
+	// BatteryVoltage in mV, or 0 if the beacon isn't battery powered.
+	BatteryVoltage uint16
+
+	// Temperature of the beacon in °C, with a resolution of 1/256°C. NaN if
+	// the beacon doesn't measure it.
+	Temperature float64
+
+	// AdvertisingCount is the number of advertisements sent since power-on.
+	AdvertisingCount uint32
+
+	// Uptime is the time since power-on, with a resolution of 100ms.
+	Uptime time.Duration
+}
+
+// ServiceData returns the service data of the frame.
+func (f EddystoneTLM) ServiceData() bluetooth.ServiceDataElement {
+	data := make([]byte, 14)
+	data[0] = eddystoneTLM
+	data[1] = 0x00 // version: unencrypted
+
+	binary.BigEndian.PutUint16(data[2:], f.BatteryVoltage)
+
+	temperature := uint16(0x8000) // not supported
+	if !math.IsNaN(f.Temperature) {
+		t := math.Round(f.Temperature * 256)
+		t = math.Max(math.Min(t, math.MaxInt16), math.MinInt16+1)
+		temperature = uint16(int16(t))
+	}
+	binary.BigEndian.PutUint16(data[4:], temperature)
+
+	binary.BigEndian.PutUint32(data[6:], f.AdvertisingCount)
+	binary.BigEndian.PutUint32(data[10:], uint32(f.Uptime/(100*time.Millisecond)))
+
+	return eddystoneServiceData(data)
+}
+
+// AdvertisementOptions returns the options to advertise the frame.
+func (f EddystoneTLM) AdvertisementOptions() bluetooth.AdvertisementOptions {
+	return eddystoneOptions(f.ServiceData())
+}
+
+func eddystoneServiceData(data []byte) bluetooth.ServiceDataElement {
+	return bluetooth.ServiceDataElement{
+		UUID: EddystoneUUID,
+		Data: data,
+	}
+}
+
+// eddystoneOptions returns the options for an Eddystone frame: scanners also
+// expect the Eddystone UUID in the list of service UUIDs.
+func eddystoneOptions(element bluetooth.ServiceDataElement) bluetooth.AdvertisementOptions {
+	return bluetooth.AdvertisementOptions{
+		ServiceUUIDs: []bluetooth.UUID{EddystoneUUID},
+		ServiceData:  []bluetooth.ServiceDataElement{element},
+	}
+}
@@ -0,0 +1,79 @@
+package beacon
+
+import (
+	"encoding/binary"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// company identifier of Apple, which defined the iBeacon format.
+const appleCompanyID = 0x004c
+
+// type and length of the iBeacon data, after the company identifier.
+const (
+	iBeaconType   = 0x02
+	iBeaconLength = 0x15
+)
+
+// IBeacon is an iBeacon advertisement.
+type IBeacon struct {
+	// UUID identifies the beacons of an organization or deployment.
+	UUID bluetooth.UUID
+
+	// Major and Minor identify a group of beacons and a beacon in the group.
+	Major uint16
+	Minor uint16
+
+	// MeasuredPower is the RSSI in dBm measured at a distance of 1m, used by
+	// receivers to estimate their distance to the beacon.
+	MeasuredPower int8
+}
+
+// ManufacturerData returns the manufacturer data of the iBeacon.
+func (b IBeacon) ManufacturerData() bluetooth.ManufacturerDataElement {
+	data := make([]byte, 2+iBeaconLength)
+	data[0] = iBeaconType
+	data[1] = iBeaconLength
+
+	// the UUID is sent most significant byte first, unlike in GATT
+	uuid := b.UUID.Bytes()
+	for i := range uuid {
+		data[2+i] = uuid[len(uuid)-1-i]
+	}
+
+	binary.BigEndian.PutUint16(data[18:], b.Major)
+	binary.BigEndian.PutUint16(data[20:], b.Minor)
+	data[22] = byte(b.MeasuredPower)
+
+	return bluetooth.ManufacturerDataElement{
+		CompanyID: appleCompanyID,
+		Data:      data,
+	}
+}
+
+// AdvertisementOptions returns the options to advertise the iBeacon.
+func (b IBeacon) AdvertisementOptions() bluetooth.AdvertisementOptions {
+	return bluetooth.AdvertisementOptions{
+		ManufacturerData: []bluetooth.ManufacturerDataElement{b.ManufacturerData()},
+	}
+}
+
+// ParseIBeacon parses the manufacturer data of an advertisement. It returns
+// false if it is not an iBeacon.
+func ParseIBeacon(element bluetooth.ManufacturerDataElement) (IBeacon, bool) {
+	data := element.Data
+	if element.CompanyID != appleCompanyID || len(data) != 2+iBeaconLength ||
+		data[0] != iBeaconType || data[1] != iBeaconLength {
+		return IBeacon{}, false
+	}
+
+	var uuid [16]byte
+	copy(uuid[:], data[2:18])
+
+	return IBeacon{
+		UUID:          bluetooth.NewUUID(uuid),
+		Major:         binary.BigEndian.Uint16(data[18:]),
+		Minor:         binary.BigEndian.Uint16(data[20:]),
+		MeasuredPower: int8(data[22]),
+	}, true
+}
@@ -0,0 +1,38 @@
+package bluetooth
+
+// minChunkSize is the largest value that fits in a single ATT write or
+// notification with the default ATT MTU of 23 bytes.
+const minChunkSize = 23 - 3
+
+// chunkSize returns the size of the chunks to use for the given ATT MTU.
+func chunkSize(mtu uint16) int {
+	if int(mtu)-3 < minChunkSize {
+		return minChunkSize
+	}
+
+	return int(mtu) - 3
+}
+
+// writeChunks writes p using write in chunks of at most size bytes. After each
+// chunk the progress callback, if any, is called with the number of bytes
+// written so far.
+func writeChunks(p []byte, size int, write func([]byte) (int, error), progress func(written, total int)) error {
+	written := 0
+	for written < len(p) {
+		end := written + size
+		if end > len(p) {
+			end = len(p)
+		}
+
+		if _, err := write(p[written:end]); err != nil {
+			return err
+		}
+		written = end
+
+		if progress != nil {
+			progress(written, len(p))
+		}
+	}
+
+	return nil
+}
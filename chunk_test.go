@@ -0,0 +1,40 @@
+package bluetooth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteChunks(t *testing.T) {
+	payload := []byte("The quick brown fox jumps over the lazy dog")
+
+	var chunks [][]byte
+	var lastWritten int
+	err := writeChunks(payload, chunkSize(23), func(p []byte) (int, error) {
+		chunks = append(chunks, append([]byte{}, p...))
+		return len(p), nil
+	}, func(written, total int) {
+		if total != len(payload) {
+			t.Errorf("expected total %d but got %d", len(payload), total)
+		}
+		lastWritten = written
+	})
+	if err != nil {
+		t.Fatalf("expected nil but got %v", err)
+	}
+
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks but got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c) > 20 {
+			t.Errorf("chunk %d is too large: %d bytes", i, len(c))
+		}
+	}
+	if !bytes.Equal(bytes.Join(chunks, nil), payload) {
+		t.Errorf("chunks don't add up to the payload: %q", bytes.Join(chunks, nil))
+	}
+	if lastWritten != len(payload) {
+		t.Errorf("expected progress to end at %d but got %d", len(payload), lastWritten)
+	}
+}
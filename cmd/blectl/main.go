@@ -0,0 +1,336 @@
+// Command blectl is a small command line tool to scan for, connect to and
+// interact with Bluetooth Low Energy peripherals using this package. It is
+// useful to check whether a problem is in the library or in an application.
+//
+// Usage:
+//
+//	blectl scan [-timeout 10s]
+//	blectl connect <address>
+//	blectl pair <address>
+//	blectl discover <address>
+//	blectl read <address> <service UUID> <characteristic UUID>
+//	blectl write <address> <service UUID> <characteristic UUID> <hex data>
+//	blectl subscribe <address> <service UUID> <characteristic UUID>
+//
+// Addresses are MAC addresses on Linux and Windows, and UUIDs on macOS, as
+// printed by the scan command. Devices are looked up with a scan before
+// connecting, so they must be advertising. The connect command stays connected
+// until interrupted. Pairing is only available with backends that support it,
+// such as the HCI backend.
+//
+// For example:
+//
+//	go run ./cmd/blectl read EE:74:7D:C9:2A:68 180f 2a19
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+var adapter = bluetooth.DefaultAdapter
+
+var timeout = flag.Duration("timeout", 10*time.Second, "how long to scan")
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := adapter.Enable(); err != nil {
+		fail("enable adapter", err)
+	}
+
+	args := flag.Args()[1:]
+
+	var err error
+	switch cmd := flag.Arg(0); {
+	case cmd == "scan" && len(args) == 0:
+		err = scan()
+	case cmd == "connect" && len(args) == 1:
+		err = stayConnected(args[0])
+	case cmd == "pair" && len(args) == 1:
+		err = pair(args[0])
+	case cmd == "discover" && len(args) == 1:
+		err = discover(args[0])
+	case cmd == "read" && len(args) == 3:
+		err = read(args[0], args[1], args[2])
+	case cmd == "write" && len(args) == 4:
+		err = write(args[0], args[1], args[2], args[3])
+	case cmd == "subscribe" && len(args) == 3:
+		err = subscribe(args[0], args[1], args[2])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fail(flag.Arg(0), err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  blectl [-timeout d] scan")
+	fmt.Fprintln(os.Stderr, "  blectl connect <address>")
+	fmt.Fprintln(os.Stderr, "  blectl pair <address>")
+	fmt.Fprintln(os.Stderr, "  blectl discover <address>")
+	fmt.Fprintln(os.Stderr, "  blectl read <address> <service UUID> <characteristic UUID>")
+	fmt.Fprintln(os.Stderr, "  blectl write <address> <service UUID> <characteristic UUID> <hex data>")
+	fmt.Fprintln(os.Stderr, "  blectl subscribe <address> <service UUID> <characteristic UUID>")
+	flag.PrintDefaults()
+}
+
+func fail(action string, err error) {
+	fmt.Fprintf(os.Stderr, "blectl: %s: %v\n", action, err)
+	os.Exit(1)
+}
+
+// scan prints all advertisements received until the timeout expires.
+func scan() error {
+	time.AfterFunc(*timeout, func() {
+		adapter.StopScan()
+	})
+
+	return adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+		fmt.Printf("%s %4d %q", result.Address.String(), result.RSSI, result.LocalName())
+		if b := result.Bytes(); b != nil {
+			fmt.Printf(" %s", hex.EncodeToString(b))
+		}
+		fmt.Println()
+	})
+}
+
+// find scans for the device with the given address.
+func find(address string) (bluetooth.ScanResult, error) {
+	found := make(chan bluetooth.ScanResult, 1)
+	timer := time.AfterFunc(*timeout, func() {
+		adapter.StopScan()
+	})
+	defer timer.Stop()
+
+	err := adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+		if strings.EqualFold(result.Address.String(), address) {
+			adapter.StopScan()
+
+			// more advertisements may arrive before the scan stops
+			select {
+			case found <- result:
+			default:
+			}
+		}
+	})
+	if err != nil {
+		return bluetooth.ScanResult{}, err
+	}
+
+	select {
+	case result := <-found:
+		return result, nil
+	default:
+		return bluetooth.ScanResult{}, errors.New("device not found")
+	}
+}
+
+func connect(address string) (bluetooth.Device, error) {
+	result, err := find(address)
+	if err != nil {
+		return bluetooth.Device{}, err
+	}
+
+	return adapter.Connect(result.Address, bluetooth.ConnectionParams{})
+}
+
+// characteristic connects to the device and looks up a characteristic.
+func characteristic(address, service, char string) (bluetooth.Device, bluetooth.DeviceCharacteristic, error) {
+	serviceUUID, err := parseUUID(service)
+	if err != nil {
+		return bluetooth.Device{}, bluetooth.DeviceCharacteristic{}, err
+	}
+
+	charUUID, err := parseUUID(char)
+	if err != nil {
+		return bluetooth.Device{}, bluetooth.DeviceCharacteristic{}, err
+	}
+
+	device, err := connect(address)
+	if err != nil {
+		return bluetooth.Device{}, bluetooth.DeviceCharacteristic{}, err
+	}
+
+	services, err := device.DiscoverServices([]bluetooth.UUID{serviceUUID})
+	if err != nil {
+		device.Disconnect()
+		return bluetooth.Device{}, bluetooth.DeviceCharacteristic{}, err
+	}
+
+	chars, err := services[0].DiscoverCharacteristics([]bluetooth.UUID{charUUID})
+	if err != nil {
+		device.Disconnect()
+		return bluetooth.Device{}, bluetooth.DeviceCharacteristic{}, err
+	}
+
+	return device, chars[0], nil
+}
+
+// parseUUID parses a UUID in the 16-bit short form or in the full form.
+func parseUUID(s string) (bluetooth.UUID, error) {
+	if len(s) == 4 {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return bluetooth.UUID{}, err
+		}
+
+		return bluetooth.New16BitUUID(uint16(b[0])<<8 | uint16(b[1])), nil
+	}
+
+	return bluetooth.ParseUUID(s)
+}
+
+// stayConnected connects to the device and waits until interrupted.
+func stayConnected(address string) error {
+	device, err := connect(address)
+	if err != nil {
+		return err
+	}
+	defer device.Disconnect()
+
+	fmt.Println("connected to", address)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+
+	return nil
+}
+
+// pairer is implemented by the devices of the backends that support pairing.
+type pairer interface {
+	Pair() error
+}
+
+// pair connects to the device and pairs with it.
+func pair(address string) error {
+	device, err := connect(address)
+	if err != nil {
+		return err
+	}
+	defer device.Disconnect()
+
+	p, ok := interface{}(device).(pairer)
+	if !ok {
+		return errors.New("pairing is not supported by this backend")
+	}
+
+	if err := p.Pair(); err != nil {
+		return err
+	}
+
+	fmt.Println("paired with", address)
+
+	return nil
+}
+
+func discover(address string) error {
+	device, err := connect(address)
+	if err != nil {
+		return err
+	}
+	defer device.Disconnect()
+
+	services, err := device.DiscoverServices(nil)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 512)
+	for _, service := range services {
+		fmt.Println("service", service.UUID().String())
+
+		chars, err := service.DiscoverCharacteristics(nil)
+		if err != nil {
+			fmt.Println("  error:", err)
+			continue
+		}
+
+		for _, char := range chars {
+			fmt.Print("  characteristic ", char.UUID().String())
+			n, err := char.Read(buf)
+			if err != nil {
+				fmt.Println()
+				continue
+			}
+
+			fmt.Printf(" %s %q\n", hex.EncodeToString(buf[:n]), buf[:n])
+		}
+	}
+
+	return nil
+}
+
+func read(address, service, char string) error {
+	device, c, err := characteristic(address, service, char)
+	if err != nil {
+		return err
+	}
+	defer device.Disconnect()
+
+	buf := make([]byte, 512)
+	n, err := c.Read(buf)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(hex.EncodeToString(buf[:n]))
+
+	return nil
+}
+
+func write(address, service, char, data string) error {
+	value, err := hex.DecodeString(data)
+	if err != nil {
+		return err
+	}
+
+	device, c, err := characteristic(address, service, char)
+	if err != nil {
+		return err
+	}
+	defer device.Disconnect()
+
+	return c.WriteAll(value, nil)
+}
+
+// subscribe prints notifications until interrupted.
+func subscribe(address, service, char string) error {
+	device, c, err := characteristic(address, service, char)
+	if err != nil {
+		return err
+	}
+	defer device.Disconnect()
+
+	err = c.EnableNotifications(func(buf []byte) {
+		fmt.Println(time.Now().Format("15:04:05.000"), hex.EncodeToString(buf))
+	})
+	if err != nil {
+		return err
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+
+	return c.EnableNotifications(nil)
+}
@@ -0,0 +1,137 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	// number of commands that can be queued while the controller is busy.
+	cmdQueueSize = 4
+
+	// maximum parameter length of a queued command.
+	cmdQueueMaxParams = 32
+)
+
+var (
+	ErrHCICommandQueueFull = errors.New("bluetooth: HCI command queue full")
+)
+
+type queuedCommand struct {
+	opcode uint16
+	params [cmdQueueMaxParams]byte
+	len    uint8
+}
+
+// cmdQueue keeps track of the number of commands the controller is willing to
+// accept, as reported in the Command Complete and Command Status events, and
+// holds back commands until the controller can take them. Commands that wait
+// for their completion have to reserve a slot, and while one of them is in
+// flight the queued commands are held back as well, so commands are never
+// interleaved.
+type cmdQueue struct {
+	mu      sync.Mutex
+	cmds    [cmdQueueSize]queuedCommand
+	head    int
+	count   int
+	credits uint8
+	busy    bool
+}
+
+// queueCommand sends a command without waiting for its completion, or queues
+// it if the controller can't accept it right now.
+func (h *hci) queueCommand(opcode uint16, params []byte) error {
+	q := &h.cmdQueue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.count == 0 && q.credits > 0 && !q.busy {
+		q.credits--
+		return h.writeCommand(opcode, params)
+	}
+
+	if len(params) > cmdQueueMaxParams {
+		return ErrHCIPDUTooLarge
+	}
+
+	if q.count == len(q.cmds) {
+		return ErrHCICommandQueueFull
+	}
+
+	if debug {
+		println("hci queue command", opcode)
+	}
+
+	c := &q.cmds[(q.head+q.count)%len(q.cmds)]
+	c.opcode = opcode
+	c.len = uint8(copy(c.params[:], params))
+	q.count++
+
+	return nil
+}
+
+// reserveCommand reserves a slot to send a command that waits for its
+// completion. It returns false if the controller can't accept a command yet,
+// or if there are queued commands that have to be sent first.
+func (h *hci) reserveCommand() (bool, error) {
+	q := &h.cmdQueue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := h.sendQueuedCommands(); err != nil {
+		return false, err
+	}
+
+	if q.count > 0 || q.credits == 0 || q.busy {
+		return false, nil
+	}
+
+	q.credits--
+	q.busy = true
+
+	return true, nil
+}
+
+// releaseCommand is called when a command reserved with reserveCommand has
+// completed, and sends the commands that were queued in the meantime.
+func (h *hci) releaseCommand() error {
+	q := &h.cmdQueue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.busy = false
+
+	return h.sendQueuedCommands()
+}
+
+// setCommandCredits sets the number of commands the controller can accept, as
+// reported by the controller, and sends queued commands if possible.
+func (h *hci) setCommandCredits(n uint8) error {
+	q := &h.cmdQueue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.credits = n
+
+	return h.sendQueuedCommands()
+}
+
+// sendQueuedCommands sends queued commands for as long as the controller
+// accepts them. The queue must be locked.
+func (h *hci) sendQueuedCommands() error {
+	q := &h.cmdQueue
+	for q.count > 0 && q.credits > 0 && !q.busy {
+		c := &q.cmds[q.head]
+		q.head = (q.head + 1) % len(q.cmds)
+		q.count--
+		q.credits--
+
+		if err := h.writeCommand(c.opcode, c.params[:c.len]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package bluetooth
+
+import (
+	"hash"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// DuplicateFilter drops repeated scan results of the same device within a
+// time window, for example from beacons that advertise many times per second.
+// It works on the results passed to the scan callback, so it behaves the same
+// on all backends. It is safe for concurrent use.
+type DuplicateFilter struct {
+	ttl            time.Duration
+	comparePayload bool
+
+	mu        sync.Mutex
+	seen      map[duplicateKey]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+type duplicateKey struct {
+	address string
+	payload uint64
+}
+
+// NewDuplicateFilter returns a filter that lets a result of a device through
+// at most once per ttl. If comparePayload is set, a result with a different
+// local name, service UUIDs, manufacturer data or service data than the
+// previous ones is let through right away, so that changes, such as a new
+// sensor value, are not missed.
+func NewDuplicateFilter(ttl time.Duration, comparePayload bool) *DuplicateFilter {
+	return &DuplicateFilter{
+		ttl:            ttl,
+		comparePayload: comparePayload,
+		seen:           make(map[duplicateKey]time.Time),
+		now:            time.Now,
+	}
+}
+
+// Allow returns whether the result should be let through, and records it if
+// so.
+func (f *DuplicateFilter) Allow(result ScanResult) bool {
+	key := duplicateKey{address: result.Address.String()}
+	if f.comparePayload && result.AdvertisementPayload != nil {
+		key.payload = hashPayload(result.AdvertisementPayload)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if now.Sub(f.lastPrune) > f.ttl {
+		// forget expired entries, so devices that went away don't pile up
+		for k, t := range f.seen {
+			if now.Sub(t) >= f.ttl {
+				delete(f.seen, k)
+			}
+		}
+		f.lastPrune = now
+	}
+
+	if t, ok := f.seen[key]; ok && now.Sub(t) < f.ttl {
+		return false
+	}
+
+	f.seen[key] = now
+	return true
+}
+
+// hashPayload returns a hash of the fields of an advertisement. Only some
+// backends provide the raw advertisement, so the structured fields are hashed
+// rather than the raw data.
+func hashPayload(payload AdvertisementPayload) uint64 {
+	var fields AdvertisementFields
+	switch p := payload.(type) {
+	case *advertisementFields:
+		fields = p.AdvertisementFields
+	case *parsedAdvertisementPayload:
+		fields = p.AdvertisementFields
+	default:
+		if b := payload.Bytes(); b != nil {
+			fields, _ = ParseAdvertisingData(b)
+		} else {
+			fields.LocalName = payload.LocalName()
+			fields.ManufacturerData = payload.ManufacturerData()
+			fields.ServiceData = payload.ServiceData()
+		}
+	}
+
+	h := fnv.New64a()
+	hashBytes(h, []byte(fields.LocalName))
+	for _, uuid := range fields.ServiceUUIDs {
+		b := uuid.Bytes()
+		h.Write(b[:])
+	}
+	for _, m := range fields.ManufacturerData {
+		h.Write([]byte{byte(m.CompanyID), byte(m.CompanyID >> 8)})
+		hashBytes(h, m.Data)
+	}
+	for _, s := range fields.ServiceData {
+		b := s.UUID.Bytes()
+		h.Write(b[:])
+		hashBytes(h, s.Data)
+	}
+
+	return h.Sum64()
+}
+
+// hashBytes writes b to h prefixed by its length, so that the boundaries of the
+// fields are part of the hash.
+func hashBytes(h hash.Hash64, b []byte) {
+	h.Write([]byte{byte(len(b)), byte(len(b) >> 8)})
+	h.Write(b)
+}
+
+// Callback wraps a scan callback so that it is only called for the results
+// that Allow lets through.
+func (f *DuplicateFilter) Callback(callback func(*Adapter, ScanResult)) func(*Adapter, ScanResult) {
+	return func(adapter *Adapter, result ScanResult) {
+		if f.Allow(result) {
+			callback(adapter, result)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package bluetooth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuplicateFilter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	f := NewDuplicateFilter(time.Second, true)
+	f.now = func() time.Time { return now }
+
+	var a, b Address
+	a.Set("01:02:03:04:05:06")
+	b.Set("01:02:03:04:05:07")
+
+	result := func(address Address, payload string) ScanResult {
+		raw := []byte(payload)
+		adf, _ := ParseAdvertisingData(raw)
+		return ScanResult{
+			Address: address,
+			AdvertisementPayload: &parsedAdvertisementPayload{
+				advertisementFields: advertisementFields{adf},
+				raw:                 raw,
+			},
+		}
+	}
+
+	for i, tc := range []struct {
+		result  ScanResult
+		elapsed time.Duration
+		allowed bool
+	}{
+		{result(a, "\x02\x01\x06"), 0, true},
+		{result(a, "\x02\x01\x06"), 100 * time.Millisecond, false},
+		{result(b, "\x02\x01\x06"), 0, true},
+		{result(a, "\x02\x01\x06\x04\xff\x34\x12\x01"), 0, true}, // new payload
+		{result(a, "\x02\x01\x06"), time.Second, true},
+	} {
+		now = now.Add(tc.elapsed)
+		if allowed := f.Allow(tc.result); allowed != tc.allowed {
+			t.Errorf("result %d: expected allowed=%v", i, tc.allowed)
+		}
+	}
+}
+
+func TestDuplicateFilterFields(t *testing.T) {
+	// backends such as Linux only report the structured fields, Bytes returns
+	// nil
+	now := time.Unix(1000, 0)
+	f := NewDuplicateFilter(time.Second, true)
+	f.now = func() time.Time { return now }
+
+	var a Address
+	a.Set("01:02:03:04:05:06")
+
+	result := func(fields AdvertisementFields) ScanResult {
+		return ScanResult{
+			Address:              a,
+			AdvertisementPayload: &advertisementFields{fields},
+		}
+	}
+
+	for i, tc := range []struct {
+		result  ScanResult
+		allowed bool
+	}{
+		{result(AdvertisementFields{LocalName: "sensor"}), true},
+		{result(AdvertisementFields{LocalName: "sensor"}), false},
+		{result(AdvertisementFields{LocalName: "sensor2"}), true},
+		{result(AdvertisementFields{
+			LocalName:        "sensor2",
+			ManufacturerData: []ManufacturerDataElement{{0x1234, []byte{1}}},
+		}), true},
+		{result(AdvertisementFields{
+			LocalName:        "sensor2",
+			ManufacturerData: []ManufacturerDataElement{{0x1234, []byte{2}}},
+		}), true},
+		{result(AdvertisementFields{
+			LocalName:        "sensor2",
+			ManufacturerData: []ManufacturerDataElement{{0x1234, []byte{2}}},
+		}), false},
+		{result(AdvertisementFields{
+			ServiceData: []ServiceDataElement{{UUID: New16BitUUID(0xfcd2), Data: []byte{1}}},
+		}), true},
+		{result(AdvertisementFields{
+			ServiceData: []ServiceDataElement{{UUID: New16BitUUID(0xfcd2), Data: []byte{2}}},
+		}), true},
+		{result(AdvertisementFields{ServiceUUIDs: []UUID{ServiceUUIDHeartRate}}), true},
+		{result(AdvertisementFields{ServiceUUIDs: []UUID{ServiceUUIDBattery}}), true},
+		{result(AdvertisementFields{ServiceUUIDs: []UUID{ServiceUUIDBattery}}), false},
+	} {
+		if allowed := f.Allow(tc.result); allowed != tc.allowed {
+			t.Errorf("result %d: expected allowed=%v", i, tc.allowed)
+		}
+	}
+}
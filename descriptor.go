@@ -0,0 +1,63 @@
+package bluetooth
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errInvalidPresentationFormat = errors.New("bluetooth: invalid characteristic presentation format")
+
+var (
+	// DescriptorUUIDCharacteristicUserDescription - Characteristic User
+	// Description, a human-readable name of the characteristic.
+	DescriptorUUIDCharacteristicUserDescription = New16BitUUID(0x2901)
+	// DescriptorUUIDCharacteristicPresentationFormat - Characteristic
+	// Presentation Format, see PresentationFormat.
+	DescriptorUUIDCharacteristicPresentationFormat = New16BitUUID(0x2904)
+)
+
+// PresentationFormat is the decoded value of a Characteristic Presentation
+// Format descriptor, which describes how the value of a characteristic is
+// represented.
+type PresentationFormat struct {
+	// Format of the value, such as 0x04 for uint8 or 0x0e for sint16, as
+	// listed in the Bluetooth Assigned Numbers.
+	Format uint8
+
+	// Exponent of the value: the actual value is the raw value times 10 to
+	// the power of Exponent.
+	Exponent int8
+
+	// Unit of the value, such as 0x272f for degrees Celsius, as listed in the
+	// Bluetooth Assigned Numbers.
+	Unit UUID
+
+	// Namespace and Description identify the part of the device the value is
+	// about, such as the left or right side. Namespace 0x01 is the Bluetooth
+	// SIG namespace.
+	Namespace   uint8
+	Description uint16
+}
+
+// ParsePresentationFormat decodes the 7-byte value of a Characteristic
+// Presentation Format descriptor.
+func ParsePresentationFormat(b []byte) (PresentationFormat, error) {
+	if len(b) < 7 {
+		return PresentationFormat{}, errInvalidPresentationFormat
+	}
+
+	return PresentationFormat{
+		Format:      b[0],
+		Exponent:    int8(b[1]),
+		Unit:        New16BitUUID(binary.LittleEndian.Uint16(b[2:])),
+		Namespace:   b[4],
+		Description: binary.LittleEndian.Uint16(b[5:]),
+	}, nil
+}
+
+// Value returns the actual value for a raw integer value, by applying the
+// exponent.
+func (f PresentationFormat) Value(raw int64) float64 {
+	return float64(raw) * math.Pow10(int(f.Exponent))
+}
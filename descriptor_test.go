@@ -0,0 +1,25 @@
+package bluetooth
+
+import (
+	"testing"
+)
+
+func TestParsePresentationFormat(t *testing.T) {
+	// sint16, exponent -2, degrees Celsius, Bluetooth SIG namespace, unknown
+	f, err := ParsePresentationFormat([]byte{0x0e, 0xfe, 0x2f, 0x27, 0x01, 0x00, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Format != 0x0e || f.Exponent != -2 || f.Unit != New16BitUUID(0x272f) || f.Namespace != 0x01 || f.Description != 0 {
+		t.Errorf("unexpected presentation format: %+v", f)
+	}
+
+	if v := f.Value(2150); v < 21.49 || v > 21.51 {
+		t.Errorf("expected value 21.5, got %f", v)
+	}
+
+	if _, err := ParsePresentationFormat([]byte{0x0e, 0xfe}); err == nil {
+		t.Error("expected an error for a short value")
+	}
+}
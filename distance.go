@@ -0,0 +1,123 @@
+package bluetooth
+
+import "math"
+
+// Path-loss exponents for typical environments, for use with
+// EstimateDistance.
+const (
+	PathLossFreeSpace = 2.0
+	PathLossIndoor    = 3.0
+)
+
+// txPowerLossAt1m is the free-space path loss at one meter at 2.4GHz, in dB.
+const txPowerLossAt1m = 41
+
+// MeasuredPowerFromTxPower returns the expected RSSI at one meter from the
+// transmit power of a device, such as the one in its Tx Power Level
+// advertisement field. Prefer the measured power advertised by beacons when
+// available, as it is calibrated for the device.
+func MeasuredPowerFromTxPower(txPower int8) int8 {
+	return int8(int(txPower) - txPowerLossAt1m)
+}
+
+// EstimateDistance returns an estimate of the distance in meters to a device,
+// from the received signal strength and the expected RSSI at one meter, using
+// the log-distance path loss model. The path-loss exponent is 2 in free space,
+// and usually between 2.7 and 4 indoors.
+//
+// The RSSI fluctuates a lot, so the result is only a rough indication of the
+// distance. Smoothing the RSSI, for example with a DistanceEstimator, gives
+// more stable results.
+func EstimateDistance(rssi float64, measuredPower int8, pathLossExponent float64) float64 {
+	return math.Pow(10, (float64(measuredPower)-rssi)/(10*pathLossExponent))
+}
+
+// RSSIFilter smooths a series of RSSI values.
+type RSSIFilter interface {
+	// Update adds a new RSSI value, and returns the smoothed value.
+	Update(rssi float64) float64
+}
+
+// EMAFilter smooths RSSI values with an exponential moving average.
+type EMAFilter struct {
+	// Weight of a new value, between 0 and 1. Lower values smooth more, but
+	// follow changes more slowly.
+	Alpha float64
+
+	value   float64
+	started bool
+}
+
+// Update adds a new RSSI value, and returns the smoothed value.
+func (f *EMAFilter) Update(rssi float64) float64 {
+	if !f.started {
+		f.value = rssi
+		f.started = true
+		return f.value
+	}
+
+	f.value += f.Alpha * (rssi - f.value)
+	return f.value
+}
+
+// KalmanFilter smooths RSSI values with a one-dimensional Kalman filter,
+// assuming that the actual RSSI changes slowly.
+type KalmanFilter struct {
+	// Variance of the change of the actual RSSI between two values. Higher
+	// values follow changes more quickly.
+	ProcessNoise float64
+
+	// Variance of the measurement noise of the RSSI. Higher values smooth
+	// more.
+	MeasurementNoise float64
+
+	value      float64
+	covariance float64
+	started    bool
+}
+
+// Update adds a new RSSI value, and returns the smoothed value.
+func (f *KalmanFilter) Update(rssi float64) float64 {
+	if !f.started {
+		f.value = rssi
+		f.covariance = f.MeasurementNoise
+		f.started = true
+		return f.value
+	}
+
+	covariance := f.covariance + f.ProcessNoise
+	gain := covariance / (covariance + f.MeasurementNoise)
+	f.value += gain * (rssi - f.value)
+	f.covariance = (1 - gain) * covariance
+
+	return f.value
+}
+
+// DistanceEstimator estimates the distance to a single device from a series
+// of RSSI values, such as those of its scan results.
+type DistanceEstimator struct {
+	// Expected RSSI at one meter, see MeasuredPowerFromTxPower.
+	MeasuredPower int8
+
+	// Path-loss exponent of the environment, see EstimateDistance.
+	PathLossExponent float64
+
+	// Filter used to smooth the RSSI values, if not nil.
+	Filter RSSIFilter
+}
+
+// Update adds a new RSSI value, and returns the estimated distance in meters.
+func (e *DistanceEstimator) Update(rssi int16) float64 {
+	value := float64(rssi)
+	if e.Filter != nil {
+		value = e.Filter.Update(value)
+	}
+
+	return EstimateDistance(value, e.MeasuredPower, e.PathLossExponent)
+}
+
+// UpdateScanResult adds the RSSI of a scan result of the device, and returns
+// the estimated distance in meters.
+func (e *DistanceEstimator) UpdateScanResult(result ScanResult) float64 {
+	return e.Update(result.RSSI)
+}
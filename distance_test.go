@@ -0,0 +1,47 @@
+package bluetooth
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateDistance(t *testing.T) {
+	for _, tc := range []struct {
+		rssi     float64
+		exponent float64
+		distance float64
+	}{
+		{-59, PathLossFreeSpace, 1},
+		{-79, PathLossFreeSpace, 10},
+		{-89, PathLossIndoor, 10},
+		{-39, PathLossFreeSpace, 0.1},
+	} {
+		d := EstimateDistance(tc.rssi, -59, tc.exponent)
+		if math.Abs(d-tc.distance) > 1e-9 {
+			t.Errorf("EstimateDistance(%v, -59, %v) = %v, expected %v", tc.rssi, tc.exponent, d, tc.distance)
+		}
+	}
+}
+
+func TestDistanceEstimator(t *testing.T) {
+	for _, filter := range []RSSIFilter{
+		&EMAFilter{Alpha: 0.5},
+		&KalmanFilter{ProcessNoise: 0.1, MeasurementNoise: 4},
+	} {
+		e := DistanceEstimator{
+			MeasuredPower:    -59,
+			PathLossExponent: PathLossFreeSpace,
+			Filter:           filter,
+		}
+
+		if d := e.Update(-59); math.Abs(d-1) > 1e-9 {
+			t.Errorf("%T: first estimate is %v, expected 1", filter, d)
+		}
+
+		// a single outlier only moves the estimate part of the way
+		d := e.UpdateScanResult(ScanResult{RSSI: -79})
+		if d <= 1 || d >= 10 {
+			t.Errorf("%T: estimate after outlier is %v, expected between 1 and 10", filter, d)
+		}
+	}
+}
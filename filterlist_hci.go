@@ -0,0 +1,60 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"errors"
+)
+
+var (
+	ErrFilterList = errors.New("bluetooth: could not update the filter accept list")
+)
+
+// AddDeviceToFilterList adds a device to the filter accept list of the
+// controller, which limits the devices reported by a scan with the
+// FilterAcceptList option. The controller rejects the change while such a scan
+// is running, or if the list is full.
+func (a *Adapter) AddDeviceToFilterList(address Address) error {
+	return a.hci.leUpdateFilterAcceptList(ocfLEAddToFilterAcceptList, address)
+}
+
+// RemoveDeviceFromFilterList removes a device from the filter accept list of
+// the controller.
+func (a *Adapter) RemoveDeviceFromFilterList(address Address) error {
+	return a.hci.leUpdateFilterAcceptList(ocfLERemoveFromFilterAcceptList, address)
+}
+
+// ClearFilterList removes all devices from the filter accept list of the
+// controller.
+func (a *Adapter) ClearFilterList() error {
+	status, _, err := a.hci.sendCommandWithResponse(ogfLECtrl<<ogfCommandPos|ocfLEClearFilterAcceptList, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if status != 0x00 {
+		return ErrFilterList
+	}
+
+	return nil
+}
+
+func (h *hci) leUpdateFilterAcceptList(ocf uint16, address Address) error {
+	var b [7]byte
+	if address.isRandom {
+		b[0] = 0x01
+	}
+	addr := makeNINAAddress(address.MAC)
+	copy(b[1:], addr[:])
+
+	status, _, err := h.sendCommandWithResponse(ogfLECtrl<<ogfCommandPos|ocf, b[:], nil)
+	if err != nil {
+		return err
+	}
+
+	if status != 0x00 {
+		return ErrFilterList
+	}
+
+	return nil
+}
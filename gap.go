@@ -54,12 +54,133 @@ type AdvertisementOptions struct {
 	// Interval in BLE-specific units. Create an interval by using NewDuration.
 	Interval Duration
 
+	// Timeout, if not zero, stops the advertisement by itself after this
+	// duration. MaxEvents, if not zero, does the same after this number of
+	// advertising events. OnStopped, if not nil, is then called. Only
+	// supported by the HCI and nRF52 SoftDevice backends. The HCI backend
+	// turns MaxEvents into a timeout, based on the advertising interval.
+	Timeout   time.Duration
+	MaxEvents int
+	OnStopped func()
+
+	// OnEvent, if not nil, is called when the advertisement starts, stops,
+	// times out, or when a central connects to it, which stops it. The device
+	// is the central for AdvertisingEventConnected, and is zero otherwise.
+	// Only supported by the HCI and nRF52 SoftDevice backends, which call it
+	// from their event handling, so it must not block.
+	OnEvent func(event AdvertisingEvent, device Device)
+
+	// RestartOnDisconnect starts the advertisement again, as Start does, when
+	// a central that connected to it disconnects: Timeout and MaxEvents start
+	// over, and OnEvent reports AdvertisingEventStarted. Without it, the HCI
+	// and SoftDevice backends only resume advertising where the connection
+	// interrupted it, and BlueZ on Linux always resumes it by itself. Only
+	// supported by the HCI and nRF52 SoftDevice backends.
+	RestartOnDisconnect bool
+
+	// KeepAdvertising keeps the device discoverable while a central is
+	// connected to it: the advertisement is started again after the
+	// connection, still connectable if the controller supports it so that
+	// another central can connect, and otherwise non-connectable. Only
+	// supported by the HCI backend.
+	KeepAdvertising bool
+
+	// Channels restricts advertising to some of the three advertising
+	// channels, for example for RF testing. All channels are used if zero.
+	// Only supported by the HCI and SoftDevice backends.
+	Channels AdvertisingChannels
+
 	// ManufacturerData stores Advertising Data.
 	ManufacturerData []ManufacturerDataElement
 
 	// ServiceData stores Advertising Data.
 	ServiceData []ServiceDataElement
-}
+
+	// Appearance is the external appearance of the device, one of the
+	// Appearance constants. It is advertised unless it is zero (unknown), and
+	// is the value of the Appearance characteristic of the GAP service on the
+	// HCI backend.
+	Appearance uint16
+
+	// IncludeTxPower adds the Tx Power Level field to the advertisement, with
+	// the transmit power used by the controller, so that scanners can estimate
+	// the distance from the signal strength. Only supported by the HCI
+	// backend.
+	IncludeTxPower bool
+
+	// LocalNamePlacement, ServiceUUIDsPlacement, ManufacturerDataPlacement and
+	// ServiceDataPlacement choose whether these fields are sent in the
+	// advertising data, which all scanners receive, or in the scan response,
+	// which only active scanners request. By default a field is put in the
+	// advertising data if it still has room, and in the scan response
+	// otherwise, the local name last. Only supported by the HCI backend, which
+	// ignores them for extended advertisements as these can't be scanned.
+	LocalNamePlacement        AdvertisingPlacement
+	ServiceUUIDsPlacement     AdvertisingPlacement
+	ManufacturerDataPlacement AdvertisingPlacement
+	ServiceDataPlacement      AdvertisingPlacement
+
+	// RawAdvertisementData, if not nil, is advertised as it is instead of the
+	// data encoded from the other options, including the flags, for AD
+	// structures that aren't supported otherwise. RawScanResponseData, if not
+	// nil, replaces the scan response data in the same way. The data must be
+	// a valid sequence of AD structures. Only supported by the HCI and
+	// SoftDevice backends.
+	RawAdvertisementData []byte
+	RawScanResponseData  []byte
+
+	// DeviceNameChanged, if not nil, makes the GAP Device Name characteristic
+	// writable, so that a connected central can rename the device. It is
+	// called with the new name, which is advertised as the local name from
+	// then on. Only supported by the HCI backend.
+	DeviceNameChanged func(name string)
+}
+
+// AdvertisingChannels is a set of the advertising channels 37, 38 and 39.
+type AdvertisingChannels uint8
+
+const (
+	AdvertisingChannel37 AdvertisingChannels = 1 << iota
+	AdvertisingChannel38
+	AdvertisingChannel39
+
+	AdvertisingChannelsAll = AdvertisingChannel37 | AdvertisingChannel38 | AdvertisingChannel39
+)
+
+// AdvertisingEvent is a change in the state of an advertisement, see
+// AdvertisementOptions.OnEvent.
+type AdvertisingEvent uint8
+
+const (
+	// AdvertisingEventStarted means the advertisement was started.
+	AdvertisingEventStarted AdvertisingEvent = iota
+
+	// AdvertisingEventStopped means the advertisement was stopped by Stop.
+	AdvertisingEventStopped
+
+	// AdvertisingEventTimedOut means the advertisement stopped by itself,
+	// after its Timeout or MaxEvents. OnStopped is called as well.
+	AdvertisingEventTimedOut
+
+	// AdvertisingEventConnected means a central connected to the
+	// advertisement.
+	AdvertisingEventConnected
+)
+
+// AdvertisingPlacement is the packet an advertised field is sent in.
+type AdvertisingPlacement uint8
+
+const (
+	// AdvertisingPlacementAuto puts the field in the advertising data, or in
+	// the scan response if it doesn't fit.
+	AdvertisingPlacementAuto AdvertisingPlacement = iota
+
+	// AdvertisingPlacementData puts the field in the advertising data.
+	AdvertisingPlacementData
+
+	// AdvertisingPlacementScanResponse puts the field in the scan response.
+	AdvertisingPlacementScanResponse
+)
 
 // Manufacturer data that's part of an advertisement packet.
 type ManufacturerDataElement struct {
@@ -96,6 +217,46 @@ func NewDuration(interval time.Duration) Duration {
 	return Duration(uint64(interval / (625 * time.Microsecond)))
 }
 
+// PHY is a physical layer of Bluetooth LE. The values match those used by
+// HCI.
+type PHY uint8
+
+const (
+	PHYUnknown PHY = iota
+	PHY1M
+	PHY2M
+	PHYCoded
+)
+
+// AdvertisementType is the kind of advertising PDU a scan result was received
+// from.
+type AdvertisementType uint8
+
+const (
+	// AdvertisementTypeUnknown is used by backends that don't report the type.
+	AdvertisementTypeUnknown AdvertisementType = iota
+
+	// AdvertisementTypeInd is a connectable and scannable advertisement
+	// (ADV_IND).
+	AdvertisementTypeInd
+
+	// AdvertisementTypeDirectInd is a connectable advertisement directed at a
+	// single central (ADV_DIRECT_IND).
+	AdvertisementTypeDirectInd
+
+	// AdvertisementTypeScanInd is a scannable but not connectable
+	// advertisement (ADV_SCAN_IND).
+	AdvertisementTypeScanInd
+
+	// AdvertisementTypeNonConnInd is an advertisement that is neither
+	// connectable nor scannable (ADV_NONCONN_IND), such as a beacon.
+	AdvertisementTypeNonConnInd
+
+	// AdvertisementTypeScanResponse is a scan response (SCAN_RSP) that could
+	// not be matched with the advertisement it answers.
+	AdvertisementTypeScanResponse
+)
+
 // Connection is a numeric identifier that indicates a connection handle.
 type Connection uint16
 
@@ -108,6 +269,29 @@ type ScanResult struct {
 	// Signal strength of the  advertisement packet.
 	RSSI int16
 
+	// PHYs the advertisement was received on, or PHYUnknown if the backend
+	// doesn't report them. The secondary PHY is only set for extended
+	// advertisements, which carry their data on the secondary channels.
+	PrimaryPHY   PHY
+	SecondaryPHY PHY
+
+	// AdvertisingSID is the advertising set ID of an extended advertisement,
+	// needed to synchronize with periodic advertising. It is 0xff if the
+	// advertisement has none. Only reported by the HCI backend.
+	AdvertisingSID uint8
+
+	// AdvertisementType is the kind of advertisement that was received. Scan
+	// responses merged with their advertisement during an active scan have
+	// the type of the advertisement. Only reported by the HCI backend.
+	AdvertisementType AdvertisementType
+
+	// Timestamp is the time the advertisement was received, with a monotonic
+	// clock reading so that the time between advertisements can be measured
+	// reliably. The HCI backend takes it when the controller reports the
+	// advertisement, other backends when the result is created. It is zero
+	// on the SoftDevice backend.
+	Timestamp time.Time
+
 	// The data obtained from the advertisement data, which may contain many
 	// different properties.
 	// Warning: this data may only stay valid until the next event arrives. If
@@ -116,6 +300,12 @@ type ScanResult struct {
 	AdvertisementPayload
 }
 
+// Connectable returns whether the advertiser accepts connections. It is false
+// if the backend doesn't report the advertisement type.
+func (r ScanResult) Connectable() bool {
+	return r.AdvertisementType == AdvertisementTypeInd || r.AdvertisementType == AdvertisementTypeDirectInd
+}
+
 // AdvertisementPayload contains information obtained during a scan (see
 // ScanResult). It is provided as an interface as there are two possible
 // implementations: an implementation that works with raw data (usually on
@@ -143,6 +333,15 @@ type AdvertisementPayload interface {
 	// ServiceData returns a slice with all the service data present in the
 	// advertising. It may be empty.
 	ServiceData() []ServiceDataElement
+
+	// TxPowerLevel returns the advertised transmit power level in dBm, and
+	// whether it was advertised. See MeasuredPowerFromTxPower to use it for
+	// distance estimation.
+	TxPowerLevel() (int8, bool)
+
+	// Appearance returns the advertised appearance of the device, or 0
+	// (unknown) if it wasn't advertised.
+	Appearance() uint16
 }
 
 // AdvertisementFields contains advertisement fields in structured form.
@@ -161,6 +360,14 @@ type AdvertisementFields struct {
 
 	// ServiceData is the service data of the advertisement.
 	ServiceData []ServiceDataElement
+
+	// TxPower is the advertised transmit power level in dBm. It is only valid
+	// if HasTxPower is set.
+	TxPower    int8
+	HasTxPower bool
+
+	// Appearance is the advertised appearance of the device, or 0 (unknown).
+	Appearance uint16
 }
 
 // advertisementFields wraps AdvertisementFields to implement the
@@ -203,6 +410,16 @@ func (p *advertisementFields) ServiceData() []ServiceDataElement {
 	return p.AdvertisementFields.ServiceData
 }
 
+// TxPowerLevel returns the underlying TxPower and HasTxPower fields.
+func (p *advertisementFields) TxPowerLevel() (int8, bool) {
+	return p.AdvertisementFields.TxPower, p.AdvertisementFields.HasTxPower
+}
+
+// Appearance returns the underlying Appearance field.
+func (p *advertisementFields) Appearance() uint16 {
+	return p.AdvertisementFields.Appearance
+}
+
 // rawAdvertisementPayload encapsulates a raw advertisement packet. Methods to
 // get the data (such as LocalName()) will parse just the needed field. Scanning
 // the data should be fast as most advertisement packets only have a very small
@@ -333,10 +550,8 @@ func (buf *rawAdvertisementPayload) ServiceData() []ServiceDataElement {
 				Data: buf.data[index+6 : index+fieldLength+1],
 			})
 		case 0x21: // 128-bit uuid
-			var uuidArray [16]byte
-			copy(uuidArray[:], buf.data[index+2:index+18])
 			serviceData = append(serviceData, ServiceDataElement{
-				UUID: NewUUID(uuidArray),
+				UUID: parseUUID128(buf.data[index+2 : index+18]),
 				Data: buf.data[index+18 : index+fieldLength+1],
 			})
 		default:
@@ -346,6 +561,24 @@ func (buf *rawAdvertisementPayload) ServiceData() []ServiceDataElement {
 	return serviceData
 }
 
+// TxPowerLevel returns the transmit power level in the advertisement payload.
+func (buf *rawAdvertisementPayload) TxPowerLevel() (int8, bool) {
+	b := buf.findField(0x0a) // Tx Power Level
+	if len(b) != 1 {
+		return 0, false
+	}
+	return int8(b[0]), true
+}
+
+// Appearance returns the appearance in the advertisement payload.
+func (buf *rawAdvertisementPayload) Appearance() uint16 {
+	b := buf.findField(0x19) // Appearance
+	if len(b) != 2 {
+		return 0
+	}
+	return uint16(b[0]) | uint16(b[1])<<8
+}
+
 // reset restores this buffer to the original state.
 func (buf *rawAdvertisementPayload) reset() {
 	// The data is not reset (only the length), because with a zero length the
@@ -357,6 +590,10 @@ func (buf *rawAdvertisementPayload) reset() {
 // before the call) from the advertisement options. It returns true if it fits,
 // false otherwise.
 func (buf *rawAdvertisementPayload) addFromOptions(options AdvertisementOptions) (ok bool) {
+	if options.RawAdvertisementData != nil {
+		return buf.addRaw(options.RawAdvertisementData)
+	}
+
 	buf.addFlags(0x06)
 	if options.LocalName != "" {
 		if !buf.addCompleteLocalName(options.LocalName) {
@@ -386,6 +623,52 @@ func (buf *rawAdvertisementPayload) addFromOptions(options AdvertisementOptions)
 		}
 	}
 
+	if options.Appearance != 0 {
+		if !buf.addAppearance(options.Appearance) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addRaw appends data, which must be a sequence of AD structures, to the
+// advertisement buffer as it is. It returns true on success and false if it
+// doesn't fit.
+func (buf *rawAdvertisementPayload) addRaw(data []byte) (ok bool) {
+	if int(buf.len)+len(data) > len(buf.data) {
+		return false
+	}
+	buf.len += uint8(copy(buf.data[buf.len:], data))
+	return true
+}
+
+// addAppearance adds the Appearance field to the advertisement buffer. It
+// returns true on success and false if it doesn't fit.
+func (buf *rawAdvertisementPayload) addAppearance(appearance uint16) (ok bool) {
+	if int(buf.len)+4 > len(buf.data) {
+		return false // appearance doesn't fit
+	}
+
+	buf.data[buf.len] = 3      // length of field (including type)
+	buf.data[buf.len+1] = 0x19 // type, 0x19 means Appearance
+	buf.data[buf.len+2] = byte(appearance)
+	buf.data[buf.len+3] = byte(appearance >> 8)
+	buf.len += 4
+	return true
+}
+
+// addTxPowerLevel adds the Tx Power Level field to the advertisement buffer.
+// It returns true on success and false if it doesn't fit.
+func (buf *rawAdvertisementPayload) addTxPowerLevel(dBm int8) (ok bool) {
+	if int(buf.len)+3 > len(buf.data) {
+		return false // power level doesn't fit
+	}
+
+	buf.data[buf.len] = 2      // length of field (including type)
+	buf.data[buf.len+1] = 0x0a // type, 0x0a means Tx Power Level
+	buf.data[buf.len+2] = byte(dBm)
+	buf.len += 3
 	return true
 }
 
@@ -99,6 +99,9 @@ type deviceInternal struct {
 	servicesChan chan error
 	charsChan    chan error
 
+	// how long to wait for the peripheral, see SetATTTimeout
+	timeout time.Duration
+
 	services map[UUID]DeviceService
 }
 
@@ -145,6 +148,7 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (Device, err
 					prph:         p,
 					servicesChan: make(chan error),
 					charsChan:    make(chan error),
+					timeout:      a.attTimeout,
 				},
 			}
 
@@ -3,21 +3,213 @@
 package bluetooth
 
 import (
-	"encoding/binary"
+	"context"
 	"errors"
-	"slices"
+	"sync"
 	"time"
 )
 
 const defaultMTU = 23
 
+const (
+	// timeout of a connection attempt, if none is set in the connection
+	// parameters.
+	defaultConnectionTimeout = 5 * time.Second
+
+	// time to wait for the controller to confirm that a connection attempt
+	// has been cancelled.
+	connectionCancelTimeout = time.Second
+)
+
 var (
-	ErrConnect = errors.New("bluetooth: could not connect")
+	ErrConnect         = errors.New("bluetooth: could not connect")
+	ErrPHYNotSupported = errors.New("bluetooth: PHY not supported by the controller")
+
+	ErrTxPowerNotSupported       = errors.New("bluetooth: TX power can't be set on the controller")
+	ErrAdvertisingWhileConnected = errors.New("bluetooth: controller can't advertise while connected")
+
+	ErrReadRSSI = errors.New("bluetooth: could not read RSSI")
+
+	ErrConnectionParamsRejected = errors.New("bluetooth: connection parameters rejected by the central")
+
+	errNotPeripheralConnection = errors.New("bluetooth: not connected as peripheral")
 )
 
+// ScanOptions are the options of a scan, see ScanWithOptions.
+type ScanOptions struct {
+	// ServiceUUIDs, if not empty, limits the scan results to advertisements
+	// that list at least one of these service UUIDs. Other advertisements are
+	// dropped before they are parsed.
+	ServiceUUIDs []UUID
+
+	// Active requests the scan response of scannable advertisers. The
+	// advertisement of a scannable device is held back until its scan
+	// response arrives, and reported once merged with it, so the result has
+	// the fields of both, such as the full local name. If the device
+	// advertises again without having answered, the held back advertisement
+	// is reported on its own.
+	Active bool
+
+	// ReportPartial reports the advertisements of an active scan right away,
+	// for latency-sensitive applications. The merged advertisement and scan
+	// response is then reported as a second result.
+	ReportPartial bool
+
+	// PHYs to scan on, the 1M PHY if empty. Advertisements are only sent on
+	// the 1M and the Coded PHY, the latter for long range. Scanning on the
+	// Coded PHY returns ErrPHYNotSupported if the controller doesn't support
+	// it, or extended advertising.
+	PHYs []ScanPHY
+
+	// MinRSSI, if not zero, drops advertisements received with a weaker
+	// signal, in dBm. They are dropped as soon as they are received, before
+	// they take up space in the report queue.
+	MinRSSI int8
+
+	// FilterAcceptList only reports advertisements of the devices added with
+	// AddDeviceToFilterList. The controller drops the others, so they don't
+	// need to be received from it at all.
+	FilterAcceptList bool
+}
+
+// ScanPHY is the configuration of a scan on one PHY. If the interval or window
+// is zero, the one of the power profile is used.
+type ScanPHY struct {
+	PHY      PHY
+	Interval Duration
+	Window   Duration
+}
+
+// number of advertisements kept to be merged with their scan response during
+// an active scan.
+const scanResponseCacheSize = 4
+
+type cachedAdvertisement struct {
+	used           bool
+	pending        bool // not reported yet, waiting for the scan response
+	peerBdaddr     [6]uint8
+	peerBdaddrType uint8
+	typ            uint8
+	extended       bool
+	rssi           int8
+	primaryPHY     uint8
+	secondaryPHY   uint8
+	sid            uint8
+	timestamp      time.Time
+	len            uint8
+	data           [31]uint8
+}
+
+// scanResponseCache holds the advertising data of the last devices seen during
+// an active scan, to merge it with their scan responses.
+type scanResponseCache struct {
+	entries [scanResponseCacheSize]cachedAdvertisement
+	next    int
+}
+
+// fits returns whether the advertising data of the report can be cached.
+func (c *scanResponseCache) fits(r *leAdvertisingReport) bool {
+	return int(r.eirLength) <= len(c.entries[0].data)
+}
+
+// add remembers the advertisement in r, which must fit. If pending is set, it
+// is held back until its scan response arrives. If it replaces an
+// advertisement that is still held back, that one is put in evicted and add
+// returns true.
+func (c *scanResponseCache) add(r *leAdvertisingReport, pending bool, evicted *leAdvertisingReport) bool {
+	e := c.find(r)
+	if e == nil {
+		e = &c.entries[c.next]
+		c.next = (c.next + 1) % len(c.entries)
+	}
+
+	wasPending := e.used && e.pending
+	if wasPending {
+		e.restore(evicted)
+	}
+
+	e.used = true
+	e.pending = pending
+	e.peerBdaddr = r.peerBdaddr
+	e.peerBdaddrType = r.peerBdaddrType
+	e.typ = r.typ
+	e.extended = r.extended
+	e.rssi = r.rssi
+	e.primaryPHY = r.primaryPHY
+	e.secondaryPHY = r.secondaryPHY
+	e.sid = r.sid
+	e.timestamp = r.timestamp
+	e.len = r.eirLength
+	copy(e.data[:], r.eirData[:r.eirLength])
+
+	return wasPending
+}
+
+// merge puts the advertising data of the same device in front of the scan
+// response in r, and gives r the type of the advertisement, if it is known.
+func (c *scanResponseCache) merge(r *leAdvertisingReport) {
+	e := c.find(r)
+	if e == nil {
+		return
+	}
+
+	n := copy(r.eirData[e.len:], r.eirData[:r.eirLength])
+	copy(r.eirData[:], e.data[:e.len])
+	r.eirLength = e.len + uint8(n)
+	r.typ = e.typ
+	r.extended = e.extended
+	e.pending = false
+}
+
+func (c *scanResponseCache) find(r *leAdvertisingReport) *cachedAdvertisement {
+	for i := range c.entries {
+		e := &c.entries[i]
+		if e.used && e.peerBdaddr == r.peerBdaddr && e.peerBdaddrType == r.peerBdaddrType {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// restore puts the cached advertisement in r.
+func (e *cachedAdvertisement) restore(r *leAdvertisingReport) {
+	r.typ = e.typ
+	r.extended = e.extended
+	r.peerBdaddr = e.peerBdaddr
+	r.peerBdaddrType = e.peerBdaddrType
+	r.rssi = e.rssi
+	r.primaryPHY = e.primaryPHY
+	r.secondaryPHY = e.secondaryPHY
+	r.sid = e.sid
+	r.timestamp = e.timestamp
+	r.eirLength = e.len
+	copy(r.eirData[:], e.data[:e.len])
+}
+
 // Scan starts a BLE scan.
 func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) error {
-	if a.scanning {
+	return a.ScanWithOptions(context.Background(), ScanOptions{}, callback)
+}
+
+// ScanContext is like Scan, but the scan also stops when the context is done,
+// in which case the context error is returned.
+func (a *Adapter) ScanContext(ctx context.Context, callback func(*Adapter, ScanResult)) error {
+	return a.ScanWithOptions(ctx, ScanOptions{}, callback)
+}
+
+// ScanWithOptions is like ScanContext, with the given options.
+func (a *Adapter) ScanWithOptions(ctx context.Context, options ScanOptions, callback func(*Adapter, ScanResult)) error {
+	if err := a.startScan(options); err != nil {
+		return err
+	}
+
+	return a.receiveScanResults(ctx, options, callback)
+}
+
+// startScan sets up the controller and starts scanning.
+func (a *Adapter) startScan(options ScanOptions) error {
+	if a.scanning.Load() {
 		return errScanning
 	}
 
@@ -25,112 +217,206 @@ func (a *Adapter) Scan(callback func(*Adapter, ScanResult)) error {
 		return err
 	}
 
-	// passive scanning, every 40ms, for 30ms
-	if err := a.hci.leSetScanParameters(0x00, 0x0080, 0x0030, 0x00, 0x00); err != nil {
+	typ := uint8(0x00) // passive
+	if options.Active {
+		typ = 0x01
+	}
+
+	// Controllers that support extended advertising only report extended
+	// advertisements when scanning with the extended commands. They report
+	// legacy advertisements too.
+	a.hci.extendedScanning = a.hci.leFeatures&leFeatureExtendedAdvertising != 0
+
+	phys, err := a.scanPHYs(options.PHYs)
+	if err != nil {
 		return err
 	}
 
-	a.scanning = true
+	filter := uint8(0x00) // accept all advertisements
+	if options.FilterAcceptList {
+		filter = 0x01
+	}
+
+	if a.hci.extendedScanning {
+		err = a.hci.leSetExtScanParameters(typ, 0x00, filter, phys)
+	} else {
+		err = a.hci.leSetScanParameters(typ, uint16(phys[0].Interval), uint16(phys[0].Window), 0x00, filter)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.hci.scanMinRSSI = options.MinRSSI
+	a.scanning.Store(true)
 
 	// scan with duplicates
 	if err := a.hci.leSetScanEnable(true, false); err != nil {
 		return err
 	}
 
-	lastUpdate := time.Now().UnixNano()
+	a.hci.advReports.reset()
 
-	for {
-		if err := a.hci.poll(); err != nil {
-			return err
-		}
+	// reports are received by the event loop, so a slow callback doesn't stop
+	// reports from being received from the controller.
+	a.startEventLoop()
 
-		switch {
-		case a.hci.advData.reported:
-			adf := AdvertisementFields{}
-			if a.hci.advData.eirLength > 31 {
-				if debug {
-					println("eirLength too long")
-				}
+	return nil
+}
+
+// scanPHYs checks that the controller can scan on the requested PHYs, and
+// returns them in the order of the scan parameter command, with the duty cycle
+// of the power profile where none is given.
+func (a *Adapter) scanPHYs(requested []ScanPHY) ([]ScanPHY, error) {
+	if len(requested) == 0 {
+		requested = []ScanPHY{{PHY: PHY1M}}
+	}
 
-				a.hci.clearAdvData()
+	settings := a.powerSettings()
+	phys := make([]ScanPHY, 0, 2)
+	for _, phy := range []PHY{PHY1M, PHYCoded} {
+		for _, p := range requested {
+			if p.PHY != phy {
 				continue
 			}
 
-			for i := 0; i < int(a.hci.advData.eirLength); {
-				l, t := int(a.hci.advData.eirData[i]), a.hci.advData.eirData[i+1]
-				if l < 1 {
-					break
-				}
-
-				switch t {
-				case 0x02, 0x03:
-					// 16-bit Service Class UUID
-					adf.ServiceUUIDs = append(adf.ServiceUUIDs, New16BitUUID(binary.LittleEndian.Uint16(a.hci.advData.eirData[i+2:i+4])))
-				case 0x06, 0x07:
-					// 128-bit Service Class UUID
-					var uuid [16]byte
-					copy(uuid[:], a.hci.advData.eirData[i+2:i+18])
-					adf.ServiceUUIDs = append(adf.ServiceUUIDs, NewUUID(uuid))
-				case 0x08, 0x09:
-					if debug {
-						println("local name", string(a.hci.advData.eirData[i+2:i+1+l]))
-					}
-
-					adf.LocalName = string(a.hci.advData.eirData[i+2 : i+1+l])
-				case 0xFF:
-					// Manufacturer Specific Data
-				}
-
-				i += l + 1
+			if p.Interval == 0 {
+				p.Interval = Duration(settings.scanInterval)
+			}
+			if p.Window == 0 {
+				p.Window = Duration(settings.scanWindow)
 			}
+			phys = append(phys, p)
+			break
+		}
+	}
 
-			random := a.hci.advData.peerBdaddrType == 0x01
+	for _, p := range requested {
+		if p.PHY != PHY1M && p.PHY != PHYCoded {
+			return nil, ErrPHYNotSupported
+		}
+		if p.PHY == PHYCoded && (!a.hci.extendedScanning || a.hci.leFeatures&leFeatureCodedPHY == 0) {
+			return nil, ErrPHYNotSupported
+		}
+	}
 
-			callback(a, ScanResult{
-				Address: Address{
-					MACAddress{
-						MAC:      makeAddress(a.hci.advData.peerBdaddr),
-						isRandom: random,
-					},
-				},
-				RSSI: int16(a.hci.advData.rssi),
-				AdvertisementPayload: &advertisementFields{
-					AdvertisementFields: adf,
-				},
-			})
+	return phys, nil
+}
 
-			a.hci.clearAdvData()
-			time.Sleep(5 * time.Millisecond)
+// receiveScanResults calls the callback for the scan results until the scan is
+// stopped.
+func (a *Adapter) receiveScanResults(ctx context.Context, options ScanOptions, callback func(*Adapter, ScanResult)) error {
+	lastUpdate := time.Now().UnixNano()
 
-		default:
-			if !a.scanning {
-				return nil
+	var report, evicted leAdvertisingReport
+	var responses scanResponseCache
+	for {
+		if !a.scanning.Load() {
+			// stopped, possibly from the callback
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			if err := a.StopScan(); err != nil && err != errNotScanning {
+				return err
 			}
+			return ctx.Err()
+		}
 
+		if !a.hci.advReports.pop(&report) {
 			if debug && (time.Now().UnixNano()-lastUpdate)/int64(time.Second) > 1 {
-				println("still scanning...")
+				println("still scanning...", a.hci.advReports.droppedReports(), "reports dropped")
 				lastUpdate = time.Now().UnixNano()
 			}
 
-			time.Sleep(5 * time.Millisecond)
+			select {
+			case <-a.hci.advReports.ready:
+			case <-ctx.Done():
+			}
+			continue
 		}
-	}
 
-	return nil
+		if options.Active {
+			switch {
+			case report.isScanResponse():
+				responses.merge(&report)
+			case !responses.fits(&report):
+				// reported on its own
+			default:
+				hold := report.isScannable() && !options.ReportPartial
+				if responses.add(&report, hold, &evicted) {
+					a.reportScanResult(&evicted, options, callback)
+				}
+				if hold {
+					continue
+				}
+			}
+		}
+
+		a.reportScanResult(&report, options, callback)
+	}
 }
 
-func (a *Adapter) StopScan() error {
-	if !a.scanning {
-		return errNotScanning
+// reportScanResult calls the callback for the report, unless it is filtered
+// out by the options.
+func (a *Adapter) reportScanResult(report *leAdvertisingReport, options ScanOptions, callback func(*Adapter, ScanResult)) {
+	if !a.scanning.Load() {
+		// stopped by the callback of an earlier report
+		return
 	}
 
-	if err := a.hci.leSetScanEnable(false, false); err != nil {
-		return err
+	if len(options.ServiceUUIDs) != 0 &&
+		!advertisesServiceUUID(report.eirData[:report.eirLength], options.ServiceUUIDs) {
+		return
+	}
+
+	adf, err := ParseAdvertisingData(report.eirData[:report.eirLength])
+	if err != nil && debug {
+		println("invalid advertising data:", err.Error())
 	}
 
-	a.scanning = false
+	random := report.peerBdaddrType == 0x01
 
-	return nil
+	callback(a, ScanResult{
+		Address: Address{
+			MACAddress{
+				MAC:      makeAddress(report.peerBdaddr),
+				isRandom: random,
+			},
+		},
+		RSSI:              int16(report.rssi),
+		PrimaryPHY:        PHY(report.primaryPHY),
+		SecondaryPHY:      PHY(report.secondaryPHY),
+		AdvertisingSID:    report.sid,
+		AdvertisementType: report.advertisementType(),
+		Timestamp:         report.timestamp,
+		AdvertisementPayload: &parsedAdvertisementPayload{
+			advertisementFields: advertisementFields{
+				AdvertisementFields: adf,
+			},
+			raw: report.eirData[:report.eirLength],
+		},
+	})
+}
+
+// DroppedScanReports returns the number of advertising reports that were
+// dropped during the current or last scan, because the scan callback could not
+// keep up with the rate at which they were received.
+func (a *Adapter) DroppedScanReports() uint32 {
+	return a.hci.advReports.droppedReports()
+}
+
+// StopScan stops a scan. It may be called from the scan callback, in which case
+// the callback isn't called anymore and Scan returns once the callback returns.
+// Called from another goroutine, a result that is being delivered may still
+// reach the callback.
+func (a *Adapter) StopScan() error {
+	// the scan loop stops even if the controller can't be told to stop
+	if !a.scanning.Swap(false) {
+		return errNotScanning
+	}
+	a.hci.advReports.wake()
+
+	return a.hci.leSetScanEnable(false, false)
 }
 
 // Address contains a Bluetooth MAC address.
@@ -140,6 +426,13 @@ type Address struct {
 
 // Connect starts a connection attempt to the given peripheral device address.
 func (a *Adapter) Connect(address Address, params ConnectionParams) (Device, error) {
+	return a.ConnectContext(context.Background(), address, params)
+}
+
+// ConnectContext is like Connect, but the connection attempt is also cancelled
+// when the context is done, in which case the context error is returned. The
+// connection timeout in the parameters still applies.
+func (a *Adapter) ConnectContext(ctx context.Context, address Address, params ConnectionParams) (Device, error) {
 	if debug {
 		println("Connect")
 	}
@@ -148,65 +441,140 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (Device, err
 	if address.isRandom {
 		random = 1
 	}
+
+	// register the waiter before starting the connection attempt, so that the
+	// connection complete event cannot be missed.
+	waiter := a.hci.waitForConnect()
+	defer a.hci.stopWaitingForConnect()
+
+	// connection intervals are in units of 1.25ms
+	settings := a.powerSettings()
+	minInterval, maxInterval := settings.connMinInterval, settings.connMaxInterval
+	if params.MinInterval != 0 {
+		minInterval = uint16(params.MinInterval) / 2
+	}
+	if params.MaxInterval != 0 {
+		maxInterval = uint16(params.MaxInterval) / 2
+	}
+
 	if err := a.hci.leCreateConn(0x0060, 0x0030, 0x00,
 		random, makeNINAAddress(address.MAC),
-		0x00, 0x0006, 0x000c, 0x0000, 0x00c8, 0x0004, 0x0006); err != nil {
+		0x00, minInterval, maxInterval, 0x0000, 0x00c8, 0x0004, 0x0006); err != nil {
 		return Device{}, err
 	}
 
-	// are we connected?
-	start := time.Now().UnixNano()
+	// the waiter is woken up by the event loop as soon as the connection
+	// complete event has been received.
+	a.startEventLoop()
+
+	connectionTimeout := defaultConnectionTimeout
+	if params.ConnectionTimeout != 0 {
+		connectionTimeout = time.Duration(int64(params.ConnectionTimeout)*625) * time.Microsecond
+	}
+
+	timeout := time.NewTimer(connectionTimeout)
+	defer timeout.Stop()
+
+	cancelled := false
+	done := ctx.Done()
 	for {
-		if err := a.hci.poll(); err != nil {
-			return Device{}, err
-		}
+		select {
+		case cd := <-waiter:
+			if cd.status != 0x00 {
+				if debug {
+					println("connection failed with status", cd.status)
+				}
+
+				if ctx.Err() != nil {
+					return Device{}, ctx.Err()
+				}
+				return Device{}, ErrConnect
+			}
 
-		if a.hci.connectData.connected {
-			defer a.hci.clearConnectData()
+			if ctx.Err() != nil {
+				// established just before the caller gave up on it
+				a.hci.disconnect(cd.handle)
+				return Device{}, ctx.Err()
+			}
 
-			random := false
-			if address.isRandom {
-				random = true
+			di, err := a.newDeviceInternal()
+			if err != nil {
+				a.hci.disconnect(cd.handle)
+				return Device{}, err
 			}
 
+			di.adapter = a
+			di.handle = cd.handle
+
 			d := Device{
 				Address: Address{
 					MACAddress{
-						MAC:      makeAddress(a.hci.connectData.peerBdaddr),
-						isRandom: random},
-				},
-				deviceInternal: &deviceInternal{
-					adapter:                   a,
-					handle:                    a.hci.connectData.handle,
-					mtu:                       defaultMTU,
-					notificationRegistrations: make([]notificationRegistration, 0),
+						MAC:      makeAddress(cd.peerBdaddr),
+						isRandom: address.isRandom},
 				},
+				deviceInternal: di,
+			}
+			if err := a.addConnection(d); err != nil {
+				di.used = false
+				a.hci.disconnect(cd.handle)
+				return Device{}, err
+			}
+
+			if err := d.checkGATTCache(); err != nil {
+				if debug {
+					println("could not check GATT cache:", err.Error())
+				}
+			}
+
+			if err := d.restoreSubscriptions(); err != nil {
+				if debug {
+					println("could not restore subscriptions:", err.Error())
+				}
 			}
-			a.addConnection(d)
 
 			return d, nil
 
-		} else {
-			// check for timeout
-			if (time.Now().UnixNano()-start)/int64(time.Second) > 5 {
-				break
+		case <-done:
+			// stop selecting on the closed channel
+			done = nil
+			if cancelled {
+				continue
 			}
 
-			time.Sleep(5 * time.Millisecond)
-		}
-	}
+			if err := a.hci.leCancelConn(); err != nil {
+				return Device{}, err
+			}
 
-	// cancel connection attempt that failed
-	if err := a.hci.leCancelConn(); err != nil {
-		return Device{}, err
-	}
+			cancelled = true
+			timeout.Reset(connectionCancelTimeout)
+
+		case <-timeout.C:
+			if cancelled {
+				// the controller never confirmed the cancellation
+				if ctx.Err() != nil {
+					return Device{}, ctx.Err()
+				}
+				return Device{}, ErrConnect
+			}
+
+			// cancel connection attempt that failed
+			if err := a.hci.leCancelConn(); err != nil {
+				return Device{}, err
+			}
 
-	return Device{}, ErrConnect
+			// The controller confirms the cancellation with a connection
+			// complete event. The connection may also have been established
+			// just before it was cancelled, in which case it is used.
+			cancelled = true
+			timeout.Reset(connectionCancelTimeout)
+		}
+	}
 }
 
 type notificationRegistration struct {
 	handle   uint16
 	callback func([]byte)
+	indicate bool // subscribed to indications instead of notifications
 }
 
 // Device is a connection to a remote peripheral.
@@ -218,8 +586,23 @@ type Device struct {
 type deviceInternal struct {
 	adapter *Adapter
 	handle  uint16
-	mtu     uint16
+	used    bool
+
+	// GATT operations, which may be called from several goroutines, run one
+	// at a time
+	requests requestQueue
+
+	// asynchronous GATT operations, queued when they are called so that they
+	// are run in order, see Device.async
+	asyncRequests requestQueue
+
+	// whether Service Changed indications have been enabled, see
+	// enableServiceChanged
+	serviceChangedEnabled bool
 
+	// notificationRegistrations is changed by subscriptions while the
+	// notification goroutine dispatches from it
+	notificationMu            sync.Mutex
 	notificationRegistrations []notificationRegistration
 }
 
@@ -246,7 +629,132 @@ func (d Device) RequestConnectionParams(params ConnectionParams) error {
 	return nil
 }
 
+// RequestConnectionParams asks the central of a connection in the peripheral
+// role to change the connection parameters, for example to a longer interval
+// to save power once the initial setup is done. It waits for the answer of the
+// central, and returns ErrConnectionParamsRejected if it refused them. The
+// central applies the new parameters some time later.
+//
+// Unset intervals default to those of the power profile, and an unset
+// timeout to 2 seconds.
+func (a *hciAdapter) RequestConnectionParams(client Connection, params ConnectionParams) error {
+	found := false
+	for _, handle := range a.hci.peripheralConnections {
+		if handle == uint16(client) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errNotPeripheralConnection
+	}
+
+	// connection intervals are in units of 1.25ms, the timeout in units of
+	// 10ms
+	settings := a.powerSettings()
+	minInterval, maxInterval := settings.connMinInterval, settings.connMaxInterval
+	if params.MinInterval != 0 {
+		minInterval = uint16(params.MinInterval) / 2
+	}
+	if params.MaxInterval != 0 {
+		maxInterval = uint16(params.MaxInterval) / 2
+	}
+	timeout := uint16(0x00c8)
+	if params.Timeout != 0 {
+		timeout = uint16(params.Timeout) / 16
+	}
+
+	// a single request can wait for its response at a time
+	a.att.busy.Lock()
+	defer a.att.busy.Unlock()
+
+	accepted, err := a.hci.l2cap.connectionParamUpdateReq(uint16(client), minInterval, maxInterval, 0, timeout, a.att.timeout)
+	if err != nil {
+		return err
+	}
+	if !accepted {
+		return ErrConnectionParamsRejected
+	}
+
+	return nil
+}
+
+// RequestMTU exchanges the ATT MTU with the device, offering mtu, which is
+// lowered to the largest MTU supported by the controller. The negotiated MTU,
+// see MTU, is the lower of the offer and the MTU of the device. The MTU can
+// only be exchanged once per connection.
+func (d Device) RequestMTU(mtu uint16) error {
+	return d.RequestMTUWithTimeout(mtu, 0)
+}
+
+// RequestMTUWithTimeout exchanges the ATT MTU like RequestMTU, but fails with
+// ErrTimeout if the device does not respond within the given timeout. A zero
+// timeout uses the adapter's ATT timeout.
+func (d Device) RequestMTUWithTimeout(mtu uint16, timeout time.Duration) error {
+	d.requests.acquire()
+	defer d.requests.release()
+
+	return d.adapter.att.mtuReq(d.handle, mtu, timeout)
+}
+
+// MTU returns the ATT MTU of the connection, which is 23 until it has been
+// exchanged with RequestMTU.
+func (d Device) MTU() uint16 {
+	return d.adapter.att.connectionMTU(d.handle)
+}
+
+// SetServerMTU sets the ATT MTU that the local GATT server accepts when a
+// central exchanges the MTU. It is lowered to the largest MTU supported by
+// the controller, which is also the default, and only applies to the
+// exchanges that follow.
+func (a *hciAdapter) SetServerMTU(mtu uint16) {
+	if mtu < defaultMTU {
+		mtu = defaultMTU
+	}
+
+	a.serverMTU = mtu
+	if a.att != nil {
+		a.att.serverMTU = mtu
+	}
+}
+
+// ConnectionMTU returns the ATT MTU negotiated with a connected central, which
+// is 23 until the central has exchanged it. A notification can carry up to
+// MTU-3 bytes of data.
+func (a *hciAdapter) ConnectionMTU(client Connection) uint16 {
+	return a.att.connectionMTU(uint16(client))
+}
+
+// ReadRSSI returns the received signal strength of the connection, in dBm, as
+// measured by the controller.
+func (d Device) ReadRSSI() (int16, error) {
+	rssi, err := d.adapter.hci.readRSSI(d.handle)
+	if err != nil {
+		return 0, err
+	}
+
+	return int16(rssi), nil
+}
+
+// Pair pairs with the device and encrypts the link. Only LE legacy pairing
+// with Just Works is supported, and no keys are distributed, so the device has
+// to be paired again after reconnecting.
+func (d Device) Pair() error {
+	d.requests.acquire()
+	defer d.requests.release()
+
+	return d.pair()
+}
+
+// pair pairs with the device and encrypts the link, see Pair.
+func (d Device) pair() error {
+	return d.adapter.hci.smp.pair(d.handle)
+}
+
 func (d Device) findNotificationRegistration(handle uint16) *notificationRegistration {
+	d.notificationMu.Lock()
+	defer d.notificationMu.Unlock()
+
 	for _, n := range d.notificationRegistrations {
 		if n.handle == handle {
 			return &n
@@ -256,27 +764,96 @@ func (d Device) findNotificationRegistration(handle uint16) *notificationRegistr
 	return nil
 }
 
-func (d Device) addNotificationRegistration(handle uint16, callback func([]byte)) {
+// addNotificationRegistration registers the callback of the notifications of
+// the characteristic value handle, replacing the one registered before.
+func (d Device) addNotificationRegistration(handle uint16, callback func([]byte)) error {
+	d.notificationMu.Lock()
+	defer d.notificationMu.Unlock()
+
+	for i := range d.notificationRegistrations {
+		if d.notificationRegistrations[i].handle == handle {
+			d.notificationRegistrations[i].callback = callback
+			return nil
+		}
+	}
+
+	if !d.adapter.hci.hasRoom(len(d.notificationRegistrations), cap(d.notificationRegistrations)) {
+		return ErrNoResources
+	}
+
 	d.notificationRegistrations = append(d.notificationRegistrations,
 		notificationRegistration{
 			handle:   handle,
 			callback: callback,
 		})
+
+	return nil
+}
+
+// removeNotificationRegistration drops the callback of the notifications of the
+// characteristic value handle, which frees its slot in static allocation mode.
+func (d Device) removeNotificationRegistration(handle uint16) {
+	d.notificationMu.Lock()
+	defer d.notificationMu.Unlock()
+
+	for i := range d.notificationRegistrations {
+		if d.notificationRegistrations[i].handle == handle {
+			d.notificationRegistrations = append(d.notificationRegistrations[:i], d.notificationRegistrations[i+1:]...)
+			return
+		}
+	}
 }
 
 func (d Device) startNotifications() {
 	d.adapter.startNotifications()
 }
 
+// maximum length of the GAP Device Name.
+const maxDeviceNameLength = 248
+
 var defaultAdvertisement Advertisement
 
 // Advertisement encapsulates a single advertisement instance.
 type Advertisement struct {
 	adapter *Adapter
 
-	localName    []byte
-	serviceUUIDs []UUID
-	interval     uint16
+	localName        []byte
+	serviceUUIDs     []UUID
+	manufacturerData []ManufacturerDataElement
+	serviceData      []ServiceDataElement
+	appearanceValue  uint16
+	rawAdvData       []byte
+	rawScanRspData   []byte
+	interval         uint16
+	channels         AdvertisingChannels
+	timeout          time.Duration
+	maxEvents        int
+	onStopped        func()
+	onEvent          func(event AdvertisingEvent, device Device)
+	restart          bool
+	keepAdvertising  bool
+
+	// see AdvertisingPlacement
+	localNamePlacement        AdvertisingPlacement
+	serviceUUIDsPlacement     AdvertisingPlacement
+	manufacturerDataPlacement AdvertisingPlacement
+	serviceDataPlacement      AdvertisingPlacement
+
+	deviceNameChanged func(name string)
+
+	// transmit power requested with SetTxPower, and the one used by the
+	// controller, which is advertised if includeTxPower is set
+	requestedTxPower int8
+	txPower          int8
+	includeTxPower   bool
+
+	// set while the data is sent in an extended advertising packet
+	extendedPDU bool
+
+	// characteristics of the generic access and generic attribute services
+	deviceName     Characteristic
+	appearance     Characteristic
+	serviceChanged Characteristic
 }
 
 // DefaultAdvertisement returns the default advertisement instance but does not
@@ -284,6 +861,7 @@ type Advertisement struct {
 func (a *Adapter) DefaultAdvertisement() *Advertisement {
 	if defaultAdvertisement.adapter == nil {
 		defaultAdvertisement.adapter = a
+		defaultAdvertisement.requestedTxPower = txPowerNoPreference
 	}
 
 	return &defaultAdvertisement
@@ -291,6 +869,10 @@ func (a *Adapter) DefaultAdvertisement() *Advertisement {
 
 // Configure this advertisement.
 func (a *Advertisement) Configure(options AdvertisementOptions) error {
+	if len(options.RawScanResponseData) > 31 {
+		return errAdvertisementPacketTooBig
+	}
+
 	switch {
 	case options.LocalName != "":
 		a.localName = []byte(options.LocalName)
@@ -299,124 +881,524 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 	}
 
 	a.serviceUUIDs = append([]UUID{}, options.ServiceUUIDs...)
+	a.manufacturerData = append([]ManufacturerDataElement{}, options.ManufacturerData...)
+	a.serviceData = append([]ServiceDataElement{}, options.ServiceData...)
+	a.appearanceValue = options.Appearance
+	a.localNamePlacement = options.LocalNamePlacement
+	a.serviceUUIDsPlacement = options.ServiceUUIDsPlacement
+	a.manufacturerDataPlacement = options.ManufacturerDataPlacement
+	a.serviceDataPlacement = options.ServiceDataPlacement
+	a.rawAdvData, a.rawScanRspData = nil, nil
+	if options.RawAdvertisementData != nil {
+		a.rawAdvData = append([]byte{}, options.RawAdvertisementData...)
+	}
+	if options.RawScanResponseData != nil {
+		a.rawScanRspData = append([]byte{}, options.RawScanResponseData...)
+	}
 	a.interval = uint16(options.Interval)
+	a.timeout = options.Timeout
+	a.maxEvents = options.MaxEvents
+	a.onStopped = options.OnStopped
+	a.onEvent = options.OnEvent
+	a.restart = options.RestartOnDisconnect
+	a.keepAdvertising = options.KeepAdvertising
+	a.channels = options.Channels & AdvertisingChannelsAll
+	if a.channels == 0 {
+		a.channels = AdvertisingChannelsAll
+	}
+	a.deviceNameChanged = options.DeviceNameChanged
+	a.includeTxPower = options.IncludeTxPower
+
+	deviceName := CharacteristicConfig{
+		Handle: &a.deviceName,
+		UUID:   CharacteristicUUIDDeviceName,
+		Flags:  CharacteristicReadPermission,
+		Value:  a.localName,
+	}
+	if options.DeviceNameChanged != nil {
+		deviceName.Flags |= CharacteristicWritePermission
+		deviceName.WriteEvent = a.setDeviceName
+	}
 
-	a.adapter.AddService(
+	if err := a.adapter.AddService(
 		&Service{
 			UUID: ServiceUUIDGenericAccess,
 			Characteristics: []CharacteristicConfig{
+				deviceName,
 				{
-					UUID:  CharacteristicUUIDDeviceName,
-					Flags: CharacteristicReadPermission,
-					Value: a.localName,
-				},
-				{
-					UUID:  CharacteristicUUIDAppearance,
-					Flags: CharacteristicReadPermission,
+					Handle: &a.appearance,
+					UUID:   CharacteristicUUIDAppearance,
+					Flags:  CharacteristicReadPermission,
+					Value:  []byte{byte(options.Appearance), byte(options.Appearance >> 8)},
 				},
 			},
-		})
-	a.adapter.AddService(
+		}); err != nil {
+		return err
+	}
+
+	return a.adapter.AddService(
 		&Service{
 			UUID: ServiceUUIDGenericAttribute,
 			Characteristics: []CharacteristicConfig{
 				{
-					UUID:  CharacteristicUUIDServiceChanged,
-					Flags: CharacteristicIndicatePermission,
+					Handle: &a.serviceChanged,
+					UUID:   CharacteristicUUIDServiceChanged,
+					Flags:  CharacteristicIndicatePermission,
 				},
 			},
 		})
-
-	return nil
 }
 
 // Start advertisement. May only be called after it has been configured.
+//
+// Controllers that support extended advertising are used with the extended
+// advertising commands, and can advertise more data than fits in a legacy
+// advertising packet. The data is still sent in legacy packets when it fits,
+// as not all scanners receive extended advertisements. Otherwise Start returns
+// an error if the data doesn't fit.
 func (a *Advertisement) Start() error {
-	// uint8_t type = (_connectable) ? 0x00 : (_localName ? 0x02 : 0x03);
-	typ := uint8(0x00)
+	if err := a.start(); err != nil {
+		return err
+	}
+
+	a.event(AdvertisingEventStarted, Device{})
+
+	return nil
+}
 
-	if err := a.adapter.hci.leSetAdvertisingParameters(a.interval, a.interval,
-		typ, 0x00, 0x00, [6]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 0x07, 0); err != nil {
+// start is Start without the started event, to restart the advertisement.
+func (a *Advertisement) start() error {
+	a.adapter.hci.extendedAdvertising = a.adapter.hci.leFeatures&leFeatureExtendedAdvertising != 0
+
+	var advertisingData, scanResponseData advertisingPayload
+	extended, err := a.payloads(&advertisingData, &scanResponseData)
+	if err != nil {
 		return err
 	}
 
-	var advertisingData [31]byte
-	advertisingDataLen := uint8(0)
+	mode, ok := a.mode()
+	if !ok {
+		return ErrAdvertisingWhileConnected
+	}
 
-	advertisingData[0] = 0x02
-	advertisingData[1] = 0x01
-	advertisingData[2] = 0x06
-	advertisingDataLen += 3
+	if err := a.setParameters(extended, mode); err != nil {
+		return err
+	}
 
-	// TODO: handle multiple service UUIDs
-	if len(a.serviceUUIDs) > 0 {
-		uuid := a.serviceUUIDs[0]
-		var sz uint8
+	if a.includeTxPower {
+		// the transmit power is only known once the parameters are set
+		advertisingData, scanResponseData = advertisingPayload{}, advertisingPayload{}
+		extended, err = a.payloads(&advertisingData, &scanResponseData)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := a.adapter.hci.leSetAdvertisingData(advertisingData.Bytes()); err != nil {
+		return err
+	}
+
+	if !extended && mode != advModeNonConnectable {
+		if err := a.adapter.hci.leSetScanResponseData(scanResponseData.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := a.adapter.hci.leSetAdvertiseEnable(true); err != nil {
+		return err
+	}
+
+	a.extendedPDU = extended
+
+	// remembered for the advertising watchdog
+	a.adapter.advertisement = a
+	// a non-connectable advertisement becomes connectable again
+	a.adapter.hci.advRestartOnDisconnect = a.restart || a.keepAdvertising
+	a.adapter.advStopAt = a.stopTime()
+
+	// events while advertising are handled by the event loop
+	a.adapter.startEventLoop()
+
+	return nil
+}
+
+// advertising modes, see Advertisement.mode
+const (
+	advModeConnectable = iota
+	advModeScannable
+	advModeNonConnectable
+)
+
+// SetMaxPeripheralConnections sets how many centrals can be connected at the
+// same time. Once the limit is reached, an advertisement with KeepAdvertising
+// is no longer connectable, and centrals that still manage to connect are
+// disconnected. Zero, the default, only limits connections to what the
+// controller supports. The CCCDs of local characteristics are kept for each
+// connection.
+func (a *hciAdapter) SetMaxPeripheralConnections(n int) {
+	a.maxPeripheralConnections = n
+	if a.hci != nil {
+		a.hci.maxPeripheralConnections = n
+	}
+}
+
+// mode returns how the advertisement can be advertised: connectable, unless a
+// central is connected and the controller can't accept another one or the
+// limit of SetMaxPeripheralConnections is reached, in which case
+// KeepAdvertising makes it scannable or non-connectable. It returns false if
+// the controller can't advertise while connected.
+func (a *Advertisement) mode() (mode int, ok bool) {
+	h := a.adapter.hci
+	full := h.maxPeripheralConnections > 0 &&
+		len(h.peripheralConnections) >= h.maxPeripheralConnections
 
+	switch {
+	case !a.keepAdvertising || len(a.adapter.att.connections) == 0:
+		return advModeConnectable, true
+	case !full && h.leStates&leStateConnAdvPeripheral != 0:
+		return advModeConnectable, true
+	case h.leStates&leStateScanAdvPeripheral != 0:
+		return advModeScannable, true
+	case h.leStates&leStateNonConnAdvPeripheral != 0:
+		return advModeNonConnectable, true
+	}
+
+	return 0, false
+}
+
+// setParameters sets the advertising parameters for the mode, for an extended
+// advertising packet if extended is set.
+func (a *Advertisement) setParameters(extended bool, mode int) error {
+	interval := a.advertisingInterval()
+
+	ownAddress := a.adapter.advAddress
+	ownBdaddrType := uint8(0x00) // public
+	if ownAddress.isRandom {
+		ownBdaddrType = 0x01
+	}
+	a.adapter.hci.advOwnAddressType = ownBdaddrType
+	a.adapter.hci.advOwnAddress = makeNINAAddress(ownAddress.MAC)
+
+	if !a.adapter.hci.extendedAdvertising {
+		typ := uint8(0x00) // ADV_IND
+		switch mode {
+		case advModeScannable:
+			typ = 0x02 // ADV_SCAN_IND
+		case advModeNonConnectable:
+			typ = 0x03 // ADV_NONCONN_IND
+		}
+
+		if err := a.adapter.hci.leSetAdvertisingParameters(interval, interval,
+			typ, ownBdaddrType, 0x00, [6]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, uint8(a.channels), 0); err != nil {
+			return err
+		}
+
+		txPower, err := a.adapter.hci.leReadAdvChannelTxPower()
+		if err != nil {
+			return err
+		}
+		a.txPower = txPower
+	} else {
+		// extended advertisements can't be connectable and scannable at once
+		var properties uint16
 		switch {
-		case uuid.Is16Bit():
-			sz = 2
-			binary.LittleEndian.PutUint16(advertisingData[5:], uuid.Get16Bit())
-		case uuid.Is32Bit():
-			sz = 6
-			data := uuid.Bytes()
-			slices.Reverse(data[:])
-			copy(advertisingData[5:], data[:])
+		case extended && mode == advModeConnectable:
+			properties = advPropConnectable
+		case extended:
+			// neither connectable nor scannable
+		case mode == advModeConnectable:
+			properties = advPropConnectable | advPropScannable | advPropLegacy
+		case mode == advModeScannable:
+			properties = advPropScannable | advPropLegacy
+		default:
+			properties = advPropLegacy
 		}
 
-		advertisingData[3] = sz + 1
-		advertisingData[4] = sz
-		advertisingDataLen += sz + 2
+		txPower, _, err := a.adapter.hci.leSetExtAdvParameters(advHandle, properties, uint32(interval), uint32(interval),
+			uint8(a.channels), ownBdaddrType, 0, a.requestedTxPower)
+		if err != nil {
+			return err
+		}
+		a.txPower = txPower
 	}
 
-	// TODO: handle manufacturer data
+	if !ownAddress.isRandom {
+		return nil
+	}
 
-	if err := a.adapter.hci.leSetAdvertisingData(advertisingData[:advertisingDataLen]); err != nil {
-		return err
+	return a.adapter.hci.leSetAdvRandomAddress(makeNINAAddress(ownAddress.MAC))
+}
+
+// advertisingInterval returns the advertising interval, in units of 0.625ms.
+func (a *Advertisement) advertisingInterval() uint16 {
+	if a.interval == 0 {
+		return a.adapter.powerSettings().advInterval
 	}
 
-	var scanResponseData [31]byte
-	scanResponseDataLen := uint8(0)
+	return a.interval
+}
 
+// stopTime returns the time at which the advertisement stops by itself, or the
+// zero time if it doesn't. The maximum number of events is turned into a time,
+// the controller adds a random delay of up to 10ms to each event.
+func (a *Advertisement) stopTime() time.Time {
+	timeout := a.timeout
+	if a.maxEvents > 0 {
+		event := time.Duration(a.advertisingInterval())*625*time.Microsecond + 5*time.Millisecond
+		if d := time.Duration(a.maxEvents) * event; timeout == 0 || d < timeout {
+			timeout = d
+		}
+	}
+
+	if timeout <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(timeout)
+}
+
+// SetAdvertisingAddress sets the address to advertise with. A random address
+// must be a static random address or a resolvable private address, see
+// NewStaticRandomAddress and NewResolvablePrivateAddress, otherwise the public
+// address of the controller is used, which is the default. It takes effect the
+// next time an advertisement is started, so a resolvable private address can be
+// rotated by stopping and starting the advertisement.
+func (a *hciAdapter) SetAdvertisingAddress(address MACAddress) {
+	a.advAddress = address
+}
+
+// payloads puts the advertising data in adv and the scan response data in
+// rsp, each in a legacy advertising packet. If they don't fit, extended is set
+// and all the data is put in adv instead, including the local name, as
+// extended advertisements can't be scanned. Raw scan response data therefore
+// requires the data to fit in legacy packets.
+func (a *Advertisement) payloads(adv, rsp *advertisingPayload) (extended bool, err error) {
+	adv.limit, rsp.limit = 31, 31
+	if a.fill(adv, rsp) {
+		return false, nil
+	}
+
+	if !a.adapter.hci.extendedAdvertising || a.rawScanRspData != nil {
+		return false, errAdvertisementPacketTooBig
+	}
+
+	*adv, *rsp = advertisingPayload{}, advertisingPayload{}
+	if !a.fill(adv, nil) {
+		return false, errAdvertisementPacketTooBig
+	}
+
+	return true, nil
+}
+
+// fill puts the fields of the advertisement in adv and rsp, according to their
+// placement, or all of them in adv if rsp is nil. It returns false if they
+// don't fit.
+func (a *Advertisement) fill(adv, rsp *advertisingPayload) bool {
+	if rsp != nil && a.rawScanRspData != nil {
+		// nothing else fits in the scan response
+		rsp.len = copy(rsp.data[:], a.rawScanRspData)
+		rsp.limit = rsp.len
+	}
+
+	if a.rawAdvData != nil {
+		if len(a.rawAdvData) > adv.size() {
+			return false
+		}
+		adv.len = copy(adv.data[:], a.rawAdvData)
+
+		// the local name can only go in the scan response
+		if rsp != nil {
+			rsp.addLocalName(a.localName)
+		}
+		return true
+	}
+
+	adv.add(func(field *rawAdvertisementPayload) bool {
+		return field.addFlags(0x06)
+	})
+
+	for _, uuid := range a.serviceUUIDs {
+		uuid := uuid
+		if !place(a.serviceUUIDsPlacement, adv, rsp, func(field *rawAdvertisementPayload) bool {
+			return field.addServiceUUID(uuid)
+		}) {
+			return false
+		}
+	}
+
+	for _, element := range a.manufacturerData {
+		element := element
+		if !place(a.manufacturerDataPlacement, adv, rsp, func(field *rawAdvertisementPayload) bool {
+			return field.addManufacturerData(element.CompanyID, element.Data)
+		}) {
+			return false
+		}
+	}
+
+	for _, element := range a.serviceData {
+		element := element
+		if !place(a.serviceDataPlacement, adv, rsp, func(field *rawAdvertisementPayload) bool {
+			return field.addServiceData(element.UUID, element.Data)
+		}) {
+			return false
+		}
+	}
+
+	if a.appearanceValue != 0 {
+		if !place(AdvertisingPlacementAuto, adv, rsp, func(field *rawAdvertisementPayload) bool {
+			return field.addAppearance(a.appearanceValue)
+		}) {
+			return false
+		}
+	}
+
+	if a.includeTxPower {
+		if !place(AdvertisingPlacementAuto, adv, rsp, func(field *rawAdvertisementPayload) bool {
+			return field.addTxPowerLevel(a.txPower)
+		}) {
+			return false
+		}
+	}
+
+	// the local name is shortened if it doesn't fit
 	switch {
-	case len(a.localName) > 29:
-		scanResponseData[1] = 0x08
-		scanResponseData[0] = 1 + 29
-		copy(scanResponseData[2:], a.localName[:29])
-		scanResponseDataLen = 31
-	case len(a.localName) > 0:
-		scanResponseData[1] = 0x09
-		scanResponseData[0] = uint8(1 + len(a.localName))
-		copy(scanResponseData[2:], a.localName)
-		scanResponseDataLen = uint8(2 + len(a.localName))
-	}
-
-	if err := a.adapter.hci.leSetScanResponseData(scanResponseData[:scanResponseDataLen]); err != nil {
+	case rsp == nil || a.localNamePlacement == AdvertisingPlacementData:
+		adv.addLocalName(a.localName)
+	case a.localNamePlacement == AdvertisingPlacementAuto && adv.size()-adv.len >= 2+len(a.localName):
+		adv.addLocalName(a.localName)
+	default:
+		rsp.addLocalName(a.localName)
+	}
+
+	return true
+}
+
+// SetTxPower sets the transmit power of the advertisement in dBm, which takes
+// effect the next time it is started. The controller uses the closest power it
+// supports, see TxPower. Only controllers that support extended advertising
+// let the power be chosen, otherwise ErrTxPowerNotSupported is returned.
+func (a *Advertisement) SetTxPower(dBm int8) error {
+	if a.adapter.hci.leFeatures&leFeatureExtendedAdvertising == 0 {
+		return ErrTxPowerNotSupported
+	}
+
+	a.requestedTxPower = dBm
+
+	return nil
+}
+
+// TxPower returns the transmit power of the advertisement in dBm, as reported
+// by the controller when the advertisement was last started.
+func (a *Advertisement) TxPower() int8 {
+	return a.txPower
+}
+
+// SetManufacturerData replaces the manufacturer data of the advertisement. If
+// it is advertising, the new data is advertised right away, without stopping
+// it. If the data doesn't fit, the advertisement is left unchanged.
+func (a *Advertisement) SetManufacturerData(elements []ManufacturerDataElement) error {
+	old := a.manufacturerData
+	a.manufacturerData = append([]ManufacturerDataElement{}, elements...)
+
+	if err := a.updateAdvertisingData(); err != nil {
+		a.manufacturerData = old
 		return err
 	}
 
-	if err := a.adapter.hci.leSetAdvertiseEnable(true); err != nil {
+	return nil
+}
+
+// SetServiceData replaces the service data of the advertisement. If it is
+// advertising, the new data is advertised right away, without stopping it. If
+// the data doesn't fit, the advertisement is left unchanged.
+func (a *Advertisement) SetServiceData(elements []ServiceDataElement) error {
+	old := a.serviceData
+	a.serviceData = append([]ServiceDataElement{}, elements...)
+
+	if err := a.updateAdvertisingData(); err != nil {
+		a.serviceData = old
 		return err
 	}
 
-	// go routine to poll for HCI events while advertising
-	go func() {
-		for {
-			if err := a.adapter.att.poll(); err != nil {
-				// TODO: handle error
-				if debug {
-					println("error polling while advertising:", err.Error())
-				}
-			}
+	return nil
+}
+
+// updateAdvertisingData checks that the advertising data fits, and sends it to
+// the controller if the advertisement is running.
+func (a *Advertisement) updateAdvertisingData() error {
+	var advertisingData, scanResponseData advertisingPayload
+	extended, err := a.payloads(&advertisingData, &scanResponseData)
+	if err != nil {
+		return err
+	}
+
+	if a.adapter.advertisement != a {
+		// sent by Start
+		return nil
+	}
 
-			time.Sleep(5 * time.Millisecond)
+	if extended != a.extendedPDU {
+		// the kind of packet is a parameter, which can't be changed while
+		// advertising
+		if err := a.adapter.hci.leSetAdvertiseEnable(false); err != nil {
+			return err
 		}
-	}()
+		return a.start()
+	}
 
-	return nil
+	if err := a.adapter.hci.leSetAdvertisingData(advertisingData.Bytes()); err != nil {
+		return err
+	}
+
+	if extended {
+		return nil
+	}
+
+	return a.adapter.hci.leSetScanResponseData(scanResponseData.Bytes())
+}
+
+// setDeviceName is called when a central writes the GAP Device Name
+// characteristic. The new name is advertised from now on.
+func (a *Advertisement) setDeviceName(client Connection, offset int, value []byte) {
+	if len(value) > maxDeviceNameLength {
+		value = value[:maxDeviceNameLength]
+	}
+
+	name := append([]byte{}, value...)
+	a.localName = name
+	a.deviceName.value = name
+
+	// called from an event handler, so the controller can't be waited for:
+	// the event loop sends the new data.
+	a.adapter.advDataChanged = true
+
+	if a.deviceNameChanged != nil {
+		a.deviceNameChanged(string(name))
+	}
 }
 
 // Stop advertisement. May only be called after it has been started.
 func (a *Advertisement) Stop() error {
+	if err := a.stop(); err != nil {
+		return err
+	}
+
+	a.event(AdvertisingEventStopped, Device{})
+
+	return nil
+}
+
+// stop is Stop without the stopped event.
+func (a *Advertisement) stop() error {
+	a.adapter.advertisement = nil
+	a.adapter.hci.advRestartOnDisconnect = false
+	a.adapter.advStopAt = time.Time{}
+
 	return a.adapter.hci.leSetAdvertiseEnable(false)
 }
+
+func (a *Advertisement) event(event AdvertisingEvent, device Device) {
+	if a.onEvent != nil {
+		a.onEvent(event, device)
+	}
+}
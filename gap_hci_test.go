@@ -0,0 +1,115 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// legacy advertising report types
+const (
+	testAdvInd        = 0x00
+	testAdvNonConnInd = 0x03
+	testScanRsp       = 0x04
+)
+
+// scanStep is an advertising report received during an active scan.
+type scanStep struct {
+	addr byte
+	typ  uint8
+	data string
+}
+
+// feedScanResponseCache passes the reports through the cache as an active scan
+// does, and returns the reports that would be sent to the callback.
+func feedScanResponseCache(steps []scanStep) []string {
+	var c scanResponseCache
+	var reported []string
+	report := func(r *leAdvertisingReport) {
+		reported = append(reported, fmt.Sprintf("%d %02x %s", r.peerBdaddr[0], r.typ, r.eirData[:r.eirLength]))
+	}
+
+	for _, step := range steps {
+		var r, evicted leAdvertisingReport
+		r.peerBdaddr[0] = step.addr
+		r.typ = step.typ
+		r.eirLength = uint8(copy(r.eirData[:], step.data))
+
+		if r.isScanResponse() {
+			c.merge(&r)
+		} else {
+			hold := r.isScannable()
+			if c.add(&r, hold, &evicted) {
+				report(&evicted)
+			}
+			if hold {
+				continue
+			}
+		}
+
+		report(&r)
+	}
+
+	return reported
+}
+
+func TestScanResponseCache(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		steps    []scanStep
+		reported []string
+	}{
+		{
+			name: "pairing",
+			steps: []scanStep{
+				{1, testAdvInd, "adv"},
+				{1, testScanRsp, "rsp"},
+			},
+			reported: []string{"1 00 advrsp"},
+		},
+		{
+			name: "unpaired scan response",
+			steps: []scanStep{
+				{1, testAdvInd, "adv"},
+				{2, testScanRsp, "rsp"},
+			},
+			reported: []string{"2 04 rsp"},
+		},
+		{
+			name: "non-scannable advertisement",
+			steps: []scanStep{
+				{1, testAdvNonConnInd, "adv"},
+			},
+			reported: []string{"1 03 adv"},
+		},
+		{
+			name: "eviction",
+			steps: []scanStep{
+				{1, testAdvInd, "adv1"},
+				{2, testAdvInd, "adv2"},
+				{3, testAdvInd, "adv3"},
+				{4, testAdvInd, "adv4"},
+				{5, testAdvInd, "adv5"},
+				{1, testScanRsp, "rsp1"},
+				{5, testScanRsp, "rsp5"},
+			},
+			reported: []string{"1 00 adv1", "1 04 rsp1", "5 00 adv5rsp5"},
+		},
+		{
+			name: "payload change",
+			steps: []scanStep{
+				{1, testAdvInd, "old"},
+				{1, testAdvInd, "new"},
+				{1, testScanRsp, "rsp"},
+			},
+			reported: []string{"1 00 old", "1 00 newrsp"},
+		},
+	} {
+		reported := feedScanResponseCache(tc.steps)
+		if !reflect.DeepEqual(reported, tc.reported) {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.reported, reported)
+		}
+	}
+}
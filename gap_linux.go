@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/godbus/dbus/v5/prop"
@@ -85,6 +86,9 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 			// TODO: MinInterval and MaxInterval (experimental as of BlueZ 5.71)
 		},
 	}
+	if options.Appearance != 0 {
+		propsSpec["org.bluez.LEAdvertisement1"]["Appearance"] = &prop.Prop{Value: options.Appearance}
+	}
 	props, err := prop.Export(a.adapter.bus, a.path, propsSpec)
 	if err != nil {
 		return err
@@ -292,6 +296,8 @@ func makeScanResult(props map[string]dbus.Variant) ScanResult {
 	// Get optional properties.
 	localName, _ := props["Name"].Value().(string)
 	rssi, _ := props["RSSI"].Value().(int16)
+	txPower, hasTxPower := props["TxPower"].Value().(int16)
+	appearance, _ := props["Appearance"].Value().(uint16)
 
 	var serviceData []ServiceDataElement
 	if sdata, ok := props["ServiceData"].Value().(map[string]dbus.Variant); ok {
@@ -308,14 +314,18 @@ func makeScanResult(props map[string]dbus.Variant) ScanResult {
 	}
 
 	return ScanResult{
-		RSSI:    rssi,
-		Address: a,
+		RSSI:      rssi,
+		Address:   a,
+		Timestamp: time.Now(),
 		AdvertisementPayload: &advertisementFields{
 			AdvertisementFields{
 				LocalName:        localName,
 				ServiceUUIDs:     serviceUUIDs,
 				ManufacturerData: manufacturerData,
 				ServiceData:      serviceData,
+				TxPower:          int8(txPower),
+				HasTxPower:       hasTxPower,
+				Appearance:       appearance,
 			},
 		},
 	}
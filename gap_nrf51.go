@@ -53,7 +53,13 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 		return errAdvertisementPacketTooBig
 	}
 
-	errCode := C.sd_ble_gap_adv_data_set((*C.uint8_t)(unsafe.Pointer(&payload.data[0])), C.uint8_t(payload.len), nil, 0)
+	var scanResponse rawAdvertisementPayload
+	if !scanResponse.addRaw(options.RawScanResponseData) {
+		return errAdvertisementPacketTooBig
+	}
+
+	errCode := C.sd_ble_gap_adv_data_set((*C.uint8_t)(unsafe.Pointer(&payload.data[0])), C.uint8_t(payload.len),
+		(*C.uint8_t)(unsafe.Pointer(&scanResponse.data[0])), C.uint8_t(scanResponse.len))
 	a.interval = options.Interval
 	return makeError(errCode)
 }
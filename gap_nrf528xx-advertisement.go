@@ -23,6 +23,10 @@ type Advertisement struct {
 	handle        C.uint8_t
 	isAdvertising volatile.Register8
 	payload       rawAdvertisementPayload
+	scanResponse  rawAdvertisementPayload
+	stopped       func()
+	onEvent       func(event AdvertisingEvent, device Device)
+	restart       bool
 }
 
 // The nrf528xx devices only seem to support one advertisement instance. The way
@@ -61,12 +65,48 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 		p_data: (*C.uint8_t)(unsafe.Pointer(&a.payload.data[0])),
 		len:    C.uint16_t(a.payload.len),
 	}
+	a.scanResponse.reset()
+	if options.RawScanResponseData != nil {
+		if !a.scanResponse.addRaw(options.RawScanResponseData) {
+			return errAdvertisementPacketTooBig
+		}
+		data.scan_rsp_data = C.ble_data_t{
+			p_data: (*C.uint8_t)(unsafe.Pointer(&a.scanResponse.data[0])),
+			len:    C.uint16_t(a.scanResponse.len),
+		}
+	}
 	params := C.ble_gap_adv_params_t{
 		properties: C.ble_gap_adv_properties_t{
 			_type: C.BLE_GAP_ADV_TYPE_CONNECTABLE_SCANNABLE_UNDIRECTED,
 		},
 		interval: C.uint32_t(options.Interval),
 	}
+	if options.Timeout > 0 {
+		// in units of 10ms
+		duration := options.Timeout / (10 * time.Millisecond)
+		if duration < 1 {
+			duration = 1
+		}
+		if duration > 0xffff {
+			duration = 0xffff
+		}
+		params.duration = C.uint16_t(duration)
+	}
+	if options.MaxEvents > 0 {
+		maxEvents := options.MaxEvents
+		if maxEvents > 0xff {
+			maxEvents = 0xff
+		}
+		params.max_adv_evts = C.uint8_t(maxEvents)
+	}
+	a.stopped = options.OnStopped
+	a.onEvent = options.OnEvent
+	a.restart = options.RestartOnDisconnect
+	if channels := options.Channels & AdvertisingChannelsAll; channels != 0 {
+		// the mask has the channels that are not used, channels 37 to 39
+		// are the upper bits of the last byte
+		params.channel_mask[4] = C.uint8_t(^channels&AdvertisingChannelsAll) << 5
+	}
 	errCode := C.sd_ble_gap_adv_set_configure(&a.handle, &data, &params)
 	return makeError(errCode)
 }
@@ -75,6 +115,9 @@ func (a *Advertisement) Configure(options AdvertisementOptions) error {
 func (a *Advertisement) Start() error {
 	a.isAdvertising.Set(1)
 	errCode := C.sd_ble_gap_adv_start(a.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
+	if errCode == 0 {
+		a.event(AdvertisingEventStarted, Device{})
+	}
 	return makeError(errCode)
 }
 
@@ -82,5 +125,50 @@ func (a *Advertisement) Start() error {
 func (a *Advertisement) Stop() error {
 	a.isAdvertising.Set(0)
 	errCode := C.sd_ble_gap_adv_stop(a.handle)
+	if errCode == 0 {
+		a.event(AdvertisingEventStopped, Device{})
+	}
 	return makeError(errCode)
 }
+
+// terminated is called when the SoftDevice stopped advertising because the
+// timeout or the maximum number of events was reached.
+func (a *Advertisement) terminated() {
+	a.isAdvertising.Set(0)
+	a.event(AdvertisingEventTimedOut, Device{})
+	if a.stopped != nil {
+		a.stopped()
+	}
+}
+
+// connected is called when a central connected in the peripheral role, which
+// stopped the advertisement.
+func (a *Advertisement) connected(device Device) {
+	if a.isAdvertising.Get() != 0 {
+		a.event(AdvertisingEventConnected, device)
+	}
+}
+
+// resume is called when a connection ended, to resume the advertisement if
+// the connection stopped it.
+func (a *Advertisement) resume() {
+	if a.isAdvertising.Get() == 0 {
+		return
+	}
+
+	// Note that it cannot be restarted during connect like this, because it
+	// would need to be reconfigured as a non-connectable advertisement.
+	// That's left as a future addition, if necessary.
+	if a.restart {
+		a.Start()
+		return
+	}
+
+	C.sd_ble_gap_adv_start(a.handle, C.BLE_CONN_CFG_TAG_DEFAULT)
+}
+
+func (a *Advertisement) event(event AdvertisingEvent, device Device) {
+	if a.onEvent != nil {
+		a.onEvent(event, device)
+	}
+}
@@ -0,0 +1,191 @@
+package bluetooth
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	ErrInvalidAdvertisingData = errors.New("bluetooth: invalid advertising data")
+)
+
+// ParseAdvertisingData parses a raw advertising or scan response payload, as a
+// sequence of length-type-value fields, into structured form. Unknown field
+// types are skipped.
+//
+// Parsing stops at the first malformed field, in which case the fields parsed
+// so far are returned together with ErrInvalidAdvertisingData. A zero length
+// field marks the end of the significant part of the payload and is not an
+// error.
+//
+// The returned manufacturer data and service data slices point into data, so
+// they are only valid as long as data is.
+func ParseAdvertisingData(data []byte) (AdvertisementFields, error) {
+	var fields AdvertisementFields
+	var shortName []byte
+	hasName := false
+
+	for len(data) > 0 {
+		fieldLength := int(data[0])
+		if fieldLength == 0 {
+			// early termination
+			break
+		}
+		if fieldLength+1 > len(data) {
+			return fields, ErrInvalidAdvertisingData
+		}
+
+		fieldType := data[1]
+		value := data[2 : fieldLength+1]
+		data = data[fieldLength+1:]
+
+		switch fieldType {
+		case 0x02, 0x03: // 16-bit Service Class UUIDs
+			if len(value)%2 != 0 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			for i := 0; i < len(value); i += 2 {
+				fields.ServiceUUIDs = append(fields.ServiceUUIDs, New16BitUUID(binary.LittleEndian.Uint16(value[i:])))
+			}
+		case 0x04, 0x05: // 32-bit Service Class UUIDs
+			if len(value)%4 != 0 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			for i := 0; i < len(value); i += 4 {
+				fields.ServiceUUIDs = append(fields.ServiceUUIDs, New32BitUUID(binary.LittleEndian.Uint32(value[i:])))
+			}
+		case 0x06, 0x07: // 128-bit Service Class UUIDs
+			if len(value)%16 != 0 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			for i := 0; i < len(value); i += 16 {
+				fields.ServiceUUIDs = append(fields.ServiceUUIDs, parseUUID128(value[i:i+16]))
+			}
+		case 0x08: // Shortened Local Name
+			shortName = value
+		case 0x09: // Complete Local Name
+			fields.LocalName = string(value)
+			hasName = true
+		case 0x0a: // Tx Power Level
+			if len(value) != 1 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			fields.TxPower = int8(value[0])
+			fields.HasTxPower = true
+		case 0x19: // Appearance
+			if len(value) != 2 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			fields.Appearance = binary.LittleEndian.Uint16(value)
+		case 0x16: // Service Data - 16-bit UUID
+			if len(value) < 2 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			fields.ServiceData = append(fields.ServiceData, ServiceDataElement{
+				UUID: New16BitUUID(binary.LittleEndian.Uint16(value)),
+				Data: value[2:],
+			})
+		case 0x20: // Service Data - 32-bit UUID
+			if len(value) < 4 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			fields.ServiceData = append(fields.ServiceData, ServiceDataElement{
+				UUID: New32BitUUID(binary.LittleEndian.Uint32(value)),
+				Data: value[4:],
+			})
+		case 0x21: // Service Data - 128-bit UUID
+			if len(value) < 16 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			fields.ServiceData = append(fields.ServiceData, ServiceDataElement{
+				UUID: parseUUID128(value[:16]),
+				Data: value[16:],
+			})
+		case 0xff: // Manufacturer Specific Data
+			if len(value) < 2 {
+				return fields, ErrInvalidAdvertisingData
+			}
+			fields.ManufacturerData = append(fields.ManufacturerData, ManufacturerDataElement{
+				CompanyID: binary.LittleEndian.Uint16(value),
+				Data:      value[2:],
+			})
+		}
+	}
+
+	if !hasName && shortName != nil {
+		fields.LocalName = string(shortName)
+	}
+
+	return fields, nil
+}
+
+// advertisesServiceUUID returns whether the raw advertising data lists at least
+// one of the given service UUIDs. Unlike ParseAdvertisingData it doesn't
+// allocate, so it can be used to cheaply filter advertisements.
+func advertisesServiceUUID(data []byte, uuids []UUID) bool {
+	for len(data) >= 2 {
+		fieldLength := int(data[0])
+		if fieldLength == 0 || fieldLength+1 > len(data) {
+			return false
+		}
+
+		fieldType := data[1]
+		value := data[2 : fieldLength+1]
+		data = data[fieldLength+1:]
+
+		size := 0
+		switch fieldType {
+		case 0x02, 0x03: // 16-bit Service Class UUIDs
+			size = 2
+		case 0x04, 0x05: // 32-bit Service Class UUIDs
+			size = 4
+		case 0x06, 0x07: // 128-bit Service Class UUIDs
+			size = 16
+		default:
+			continue
+		}
+
+		for i := 0; i+size <= len(value); i += size {
+			var uuid UUID
+			switch size {
+			case 2:
+				uuid = New16BitUUID(binary.LittleEndian.Uint16(value[i:]))
+			case 4:
+				uuid = New32BitUUID(binary.LittleEndian.Uint32(value[i:]))
+			default:
+				uuid = parseUUID128(value[i : i+16])
+			}
+
+			for _, u := range uuids {
+				if u == uuid {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// parseUUID128 returns the UUID stored in little endian byte order in b, as it
+// is sent over the air.
+func parseUUID128(b []byte) UUID {
+	var uuid [16]byte
+	for i := range uuid {
+		uuid[i] = b[15-i]
+	}
+
+	return NewUUID(uuid)
+}
+
+// parsedAdvertisementPayload is an advertisement payload that has been parsed
+// from raw advertising data, and keeps the raw data available.
+type parsedAdvertisementPayload struct {
+	advertisementFields
+	raw []byte
+}
+
+// Bytes returns the raw advertising data.
+func (p *parsedAdvertisementPayload) Bytes() []byte {
+	return p.raw
+}
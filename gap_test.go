@@ -114,6 +114,22 @@ func TestCreateAdvertisementPayload(t *testing.T) {
 				},
 			},
 		},
+		{
+			raw: "\x02\x01\x06" + // flags
+				"\x03\x19\x40\x05", // appearance
+			parsed: AdvertisementOptions{
+				Appearance: AppearanceGenericSensor,
+			},
+		},
+		{
+			raw: "\x02\x01\x04" + // flags
+				"\x04\x2c\x01\x02\x03", // BIGInfo, not supported by the encoder
+			parsed: AdvertisementOptions{
+				// The other options are ignored.
+				LocalName:            "foobar",
+				RawAdvertisementData: []byte("\x02\x01\x04\x04\x2c\x01\x02\x03"),
+			},
+		},
 	}
 	for _, tc := range tests {
 		var expectedRaw rawAdvertisementPayload
@@ -129,5 +145,141 @@ func TestCreateAdvertisementPayload(t *testing.T) {
 		if !reflect.DeepEqual(mdata, tc.parsed.ManufacturerData) {
 			t.Errorf("ManufacturerData was not parsed as expected:\nexpected: %#v\nactual:   %#v", tc.parsed.ManufacturerData, mdata)
 		}
+		sdata := raw.ServiceData()
+		if !reflect.DeepEqual(sdata, tc.parsed.ServiceData) {
+			t.Errorf("ServiceData was not parsed as expected:\nexpected: %#v\nactual:   %#v", tc.parsed.ServiceData, sdata)
+		}
+	}
+}
+
+func TestParseAdvertisingData(t *testing.T) {
+	type testCase struct {
+		raw    string
+		parsed AdvertisementFields
+		err    error
+	}
+	tests := []testCase{
+		{
+			raw:    "\x02\x01\x06", // flags
+			parsed: AdvertisementFields{},
+		},
+		{
+			raw: "\x02\x01\x06" + // flags
+				"\x0b\x09Heart rate" + // local name
+				"\x05\x03\x0d\x18\x0f\x18", // service UUIDs
+			parsed: AdvertisementFields{
+				LocalName: "Heart rate",
+				ServiceUUIDs: []UUID{
+					ServiceUUIDHeartRate,
+					ServiceUUIDBattery,
+				},
+			},
+		},
+		{
+			raw: "\x04\x08abc" + // shortened local name
+				"\x07\x09abcdef", // complete local name
+			parsed: AdvertisementFields{
+				LocalName: "abcdef",
+			},
+		},
+		{
+			raw: "\x11\x07\xB8\x6C\x75\x05\xE9\x25\xBD\x93\xA8\x42\x32\xC3\x00\x01\xAF\xAD", // 128-bit service UUID
+			parsed: AdvertisementFields{
+				ServiceUUIDs: []UUID{
+					NewUUID([16]byte{0xad, 0xaf, 0x01, 0x00, 0xc3, 0x32, 0x42, 0xa8, 0x93, 0xbd, 0x25, 0xe9, 0x05, 0x75, 0x6c, 0xb8}),
+				},
+			},
+		},
+		{
+			raw: "\x05\xff\x34\x12\x01\x02" + // manufacturer data
+				"\x04\x16\xD2\xFC\x40", // service data 16-Bit UUID
+			parsed: AdvertisementFields{
+				ManufacturerData: []ManufacturerDataElement{
+					{0x1234, []byte{1, 2}},
+				},
+				ServiceData: []ServiceDataElement{
+					{UUID: New16BitUUID(0xFCD2), Data: []byte{0x40}},
+				},
+			},
+		},
+		{
+			raw: "\x02\x0a\xf8" + // TX power level
+				"\x03\x19\xc1\x03", // appearance
+			parsed: AdvertisementFields{
+				TxPower:    -8,
+				HasTxPower: true,
+				Appearance: 0x03c1,
+			},
+		},
+		{
+			raw: "\x07\x09foobar" + // local name
+				"\x00\x12\x34", // early termination, followed by padding
+			parsed: AdvertisementFields{
+				LocalName: "foobar",
+			},
+		},
+		{
+			raw: "\x07\x09foobar" + // local name
+				"\x05\x03\x0d", // truncated field
+			parsed: AdvertisementFields{
+				LocalName: "foobar",
+			},
+			err: ErrInvalidAdvertisingData,
+		},
+		{
+			raw: "\x02\x03\x0d", // odd 16-bit UUID list
+			err: ErrInvalidAdvertisingData,
+		},
+		{
+			raw: "\x02\xff\x34", // manufacturer data without company ID
+			err: ErrInvalidAdvertisingData,
+		},
+	}
+	for _, tc := range tests {
+		parsed, err := ParseAdvertisingData([]byte(tc.raw))
+		if err != tc.err {
+			t.Errorf("unexpected error for %#v: expected %v, got %v", tc.raw, tc.err, err)
+		}
+		if !reflect.DeepEqual(parsed, tc.parsed) {
+			t.Errorf("advertising data was not parsed as expected: %#v\nexpected: %#v\nactual:   %#v", tc.raw, tc.parsed, parsed)
+		}
+	}
+}
+
+func FuzzParseAdvertisingData(f *testing.F) {
+	f.Add([]byte("\x02\x01\x06\x0b\x09Heart rate\x03\x03\x0d\x18"))
+	f.Add([]byte("\x05\xff\x34\x12\x01\x02\x04\x16\xD2\xFC\x40"))
+	f.Add([]byte("\x06\x20\xD2\xFC\x40\x02\xC4"))
+	f.Add([]byte("\x12\x21\xB8\x6C\x75\x05\xE9\x25\xBD\x93\xA8\x42\x32\xC3\x00\x01\xAF\xAD\x09"))
+	f.Add([]byte("\xff\x09"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fields, err := ParseAdvertisingData(data)
+		if err != nil && err != ErrInvalidAdvertisingData {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(fields.LocalName) > len(data) {
+			t.Errorf("local name longer than the payload: %d > %d", len(fields.LocalName), len(data))
+		}
+		if err == nil {
+			for _, uuid := range fields.ServiceUUIDs {
+				if !advertisesServiceUUID(data, []UUID{uuid}) {
+					t.Errorf("service UUID %s not found by the filter", uuid.String())
+				}
+			}
+		}
+	})
+}
+
+func TestAdvertisesServiceUUID(t *testing.T) {
+	data := []byte("\x02\x01\x06" + // flags
+		"\x05\x03\x0d\x18\x0f\x18") // service UUIDs
+	if !advertisesServiceUUID(data, []UUID{ServiceUUIDHeartRate}) {
+		t.Error("heart rate service not found")
+	}
+	if !advertisesServiceUUID(data, []UUID{ServiceUUIDGlucose, ServiceUUIDBattery}) {
+		t.Error("battery service not found")
+	}
+	if advertisesServiceUUID(data, []UUID{ServiceUUIDGlucose}) {
+		t.Error("glucose service found")
 	}
 }
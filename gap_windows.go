@@ -2,6 +2,7 @@ package bluetooth
 
 import (
 	"fmt"
+	"time"
 	"unsafe"
 
 	"github.com/go-ole/go-ole"
@@ -218,8 +219,9 @@ func getScanResultFromArgs(args *advertisement.BluetoothLEAdvertisementReceivedE
 	}
 	sigStrength, _ := args.GetRawSignalStrengthInDBm()
 	result := ScanResult{
-		RSSI:    sigStrength,
-		Address: adr,
+		RSSI:      sigStrength,
+		Address:   adr,
+		Timestamp: time.Now(),
 	}
 
 	var manufacturerData []ManufacturerDataElement
@@ -278,6 +280,9 @@ type Device struct {
 
 	device  *bluetooth.BluetoothLEDevice
 	session *genericattributeprofile.GattSession
+
+	// how long to wait for the peripheral, see SetATTTimeout
+	timeout time.Duration
 }
 
 // Connect starts a connection attempt to the given peripheral device address.
@@ -342,7 +347,12 @@ func (a *Adapter) Connect(address Address, params ConnectionParams) (Device, err
 		return Device{}, err
 	}
 
-	return Device{address, bleDevice, newSession}, nil
+	timeout := a.attTimeout
+	if timeout <= 0 {
+		timeout = defaultATTTimeout
+	}
+
+	return Device{address, bleDevice, newSession, timeout}, nil
 }
 
 // Disconnect from the BLE device. This method is non-blocking and does not
@@ -0,0 +1,37 @@
+//go:build !softdevice || s132v6 || s140v6 || s140v7
+
+package bluetooth
+
+// The asynchronous variants of the GATT client calls return immediately, and
+// run the call in a new goroutine. The callback is called from that goroutine
+// when the call has completed, so it must not block for long and must
+// synchronize with the rest of the application itself.
+//
+// On HCI, the asynchronous calls on a connection are run in the order in which
+// they were made. On other platforms, calls that are made without waiting for
+// the callback of the previous one may run in any order.
+
+// DiscoverServicesAsync discovers services like DiscoverServices, without
+// blocking. The callback receives the result.
+func (d Device) DiscoverServicesAsync(uuids []UUID, callback func(services []DeviceService, err error)) {
+	d.async(func() {
+		callback(d.DiscoverServices(uuids))
+	})
+}
+
+// DiscoverCharacteristicsAsync discovers characteristics like
+// DiscoverCharacteristics, without blocking. The callback receives the result.
+func (s DeviceService) DiscoverCharacteristicsAsync(uuids []UUID, callback func(characteristics []DeviceCharacteristic, err error)) {
+	s.async(func() {
+		callback(s.DiscoverCharacteristics(uuids))
+	})
+}
+
+// ReadAsync reads the characteristic value into data like Read, without
+// blocking. The callback receives the number of bytes read. data must not be
+// used until then.
+func (c DeviceCharacteristic) ReadAsync(data []byte, callback func(n int, err error)) {
+	c.async(func() {
+		callback(c.Read(data))
+	})
+}
@@ -0,0 +1,27 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+// async runs f in a new goroutine, once the asynchronous calls made on the
+// connection before it have completed. The call is queued before async
+// returns, so calls made one after the other reach the request queue in the
+// same order.
+func (d Device) async(f func()) {
+	ticket := d.asyncRequests.reserve()
+	go func() {
+		d.asyncRequests.wait(ticket)
+		defer d.asyncRequests.release()
+
+		f()
+	}()
+}
+
+// async runs f like Device.async.
+func (s DeviceService) async(f func()) {
+	s.device.async(f)
+}
+
+// async runs f like Device.async.
+func (c DeviceCharacteristic) async(f func()) {
+	c.service.device.async(f)
+}
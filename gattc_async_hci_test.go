@@ -0,0 +1,31 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAsyncOrder(t *testing.T) {
+	d := Device{deviceInternal: &deviceInternal{}}
+
+	var wg sync.WaitGroup
+	var order []int
+	for i := 0; i < 20; i++ {
+		i := i
+		wg.Add(1)
+		d.async(func() {
+			// the calls run one at a time, so no lock is needed
+			order = append(order, i)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	for i, n := range order {
+		if n != i {
+			t.Fatalf("expected the calls to run in order, got %v", order)
+		}
+	}
+}
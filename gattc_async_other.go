@@ -0,0 +1,18 @@
+//go:build !hci && !ninafw && !cyw43439 && (!softdevice || s132v6 || s140v6 || s140v7)
+
+package bluetooth
+
+// async runs f in a new goroutine. The order of the calls isn't preserved.
+func (d Device) async(f func()) {
+	go f()
+}
+
+// async runs f like Device.async.
+func (s DeviceService) async(f func()) {
+	go f()
+}
+
+// async runs f like Device.async.
+func (c DeviceCharacteristic) async(f func()) {
+	go f()
+}
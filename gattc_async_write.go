@@ -0,0 +1,12 @@
+//go:build hci || ninafw || cyw43439 || darwin || windows
+
+package bluetooth
+
+// WriteAsync writes the characteristic value like Write, without blocking.
+// The callback receives the result once the peripheral has confirmed the
+// write. p must not be modified until then.
+func (c DeviceCharacteristic) WriteAsync(p []byte, callback func(n int, err error)) {
+	c.async(func() {
+		callback(c.Write(p))
+	})
+}
@@ -52,8 +52,8 @@ func (d Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 			d.services[svc.uuidWrapper] = svc
 		}
 		return svcs, nil
-	case <-time.NewTimer(10 * time.Second).C:
-		return nil, errors.New("timeout on DiscoverServices")
+	case <-time.NewTimer(d.timeout).C:
+		return nil, ErrTimeout
 	}
 }
 
@@ -136,8 +136,8 @@ func (s DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacteri
 			}
 		}
 		return chars, nil
-	case <-time.NewTimer(10 * time.Second).C:
-		return nil, errors.New("timeout on DiscoverCharacteristics")
+	case <-time.NewTimer(s.device.timeout).C:
+		return nil, ErrTimeout
 	}
 }
 
@@ -176,6 +176,13 @@ func (c DeviceCharacteristic) UUID() UUID {
 	return c.uuidWrapper
 }
 
+// Permissions returns the properties of the characteristic, as discovered by
+// DiscoverCharacteristics: the operations the peripheral allows on it.
+func (c DeviceCharacteristic) Permissions() CharacteristicPermissions {
+	// the first 8 bits match the properties of the characteristic declaration
+	return CharacteristicPermissions(c.characteristic.Properties() & 0xff)
+}
+
 // Write replaces the characteristic value with a new value. The
 // call will return after all data has been written.
 func (c DeviceCharacteristic) Write(p []byte) (n int, err error) {
@@ -184,8 +191,8 @@ func (c DeviceCharacteristic) Write(p []byte) (n int, err error) {
 
 	// wait for result
 	select {
-	case <-time.NewTimer(10 * time.Second).C:
-		err = errors.New("timeout on Write()")
+	case <-time.NewTimer(c.service.device.timeout).C:
+		err = ErrTimeout
 	case err = <-c.writeChan:
 	}
 
@@ -239,9 +246,9 @@ func (c *deviceCharacteristic) Read(data []byte) (n int, err error) {
 		if err != nil {
 			return 0, err
 		}
-	case <-time.NewTimer(10 * time.Second).C:
+	case <-time.NewTimer(c.service.device.timeout).C:
 		c.readChan = nil
-		return 0, errors.New("timeout on Read()")
+		return 0, ErrTimeout
 	}
 
 	copy(data, c.characteristic.Value())
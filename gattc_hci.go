@@ -2,19 +2,28 @@
 
 package bluetooth
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	errNotYetImplemented         = errors.New("bluetooth: not yet implemented")
 	errNoWrite                   = errors.New("bluetooth: write not permitted")
 	errNoWriteWithoutResponse    = errors.New("bluetooth: write without response not permitted")
 	errWriteFailed               = errors.New("bluetooth: write failed")
+	errWriteTooLong              = errors.New("bluetooth: write without response longer than MTU-3")
 	errNoRead                    = errors.New("bluetooth: read not permitted")
 	errReadFailed                = errors.New("bluetooth: read failed")
 	errNoNotify                  = errors.New("bluetooth: notify/indicate not permitted")
+	errNoIndicate                = errors.New("bluetooth: indicate not permitted")
 	errEnableNotificationsFailed = errors.New("bluetooth: enable notifications failed")
 	errServiceNotFound           = errors.New("bluetooth: service not found")
 	errCharacteristicNotFound    = errors.New("bluetooth: characteristic not found")
+	errDescriptorNotFound        = errors.New("bluetooth: descriptor not found")
+
+	ErrInsufficientSecurity = errors.New("bluetooth: insufficient authentication or encryption")
+	ErrWouldBlock           = errors.New("bluetooth: all controller buffers are in use")
 )
 
 const (
@@ -52,10 +61,25 @@ func (s DeviceService) UUID() UUID {
 // Passing a nil slice of UUIDs will return a complete list of
 // services.
 func (d Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
+	return d.DiscoverServicesWithTimeout(uuids, 0)
+}
+
+// DiscoverServicesWithTimeout discovers services like DiscoverServices, but
+// fails with ErrTimeout if the peripheral does not respond to one of the
+// requests within the given timeout. A zero timeout uses the adapter's ATT
+// timeout.
+func (d Device) DiscoverServicesWithTimeout(uuids []UUID, timeout time.Duration) ([]DeviceService, error) {
 	if debug {
 		println("DiscoverServices")
 	}
 
+	if services, ok := d.cachedServices(uuids); ok {
+		return services, nil
+	}
+
+	d.requests.acquire()
+	defer d.requests.release()
+
 	services := make([]DeviceService, 0, maxDefaultServicesToDiscover)
 	foundServices := make(map[UUID]DeviceService)
 
@@ -67,7 +91,7 @@ func (d Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 	startHandle := uint16(0x0001)
 	endHandle := uint16(0xffff)
 	for endHandle == uint16(0xffff) {
-		err := d.adapter.att.readByGroupReq(d.handle, startHandle, endHandle, gattServiceUUID)
+		err := d.adapter.att.readByGroupReq(d.handle, startHandle, endHandle, gattServiceUUID, timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -123,6 +147,8 @@ func (d Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 		}
 	}
 
+	d.cacheServices(services, len(uuids) == 0)
+
 	return services, nil
 }
 
@@ -134,6 +160,7 @@ type DeviceCharacteristic struct {
 	service     *DeviceService
 	permissions CharacteristicPermissions
 	handle      uint16
+	endHandle   uint16 // last handle of the descriptors
 	properties  uint8
 	callback    func(buf []byte)
 }
@@ -143,6 +170,12 @@ func (c DeviceCharacteristic) UUID() UUID {
 	return c.uuid
 }
 
+// Permissions returns the properties of the characteristic, as discovered by
+// DiscoverCharacteristics: the operations the peripheral allows on it.
+func (c DeviceCharacteristic) Permissions() CharacteristicPermissions {
+	return c.permissions
+}
+
 // DiscoverCharacteristics discovers characteristics in this service. Pass a
 // list of characteristic UUIDs you are interested in to this function. Either a
 // list of all requested services is returned, or if some services could not be
@@ -153,10 +186,25 @@ func (c DeviceCharacteristic) UUID() UUID {
 // Passing a nil slice of UUIDs will return a complete
 // list of characteristics.
 func (s DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacteristic, error) {
+	return s.DiscoverCharacteristicsWithTimeout(uuids, 0)
+}
+
+// DiscoverCharacteristicsWithTimeout discovers characteristics like
+// DiscoverCharacteristics, but fails with ErrTimeout if the peripheral does not
+// respond to one of the requests within the given timeout. A zero timeout uses
+// the adapter's ATT timeout.
+func (s DeviceService) DiscoverCharacteristicsWithTimeout(uuids []UUID, timeout time.Duration) ([]DeviceCharacteristic, error) {
 	if debug {
 		println("DiscoverCharacteristics")
 	}
 
+	if characteristics, ok := s.cachedCharacteristics(uuids); ok {
+		return characteristics, nil
+	}
+
+	s.device.requests.acquire()
+	defer s.device.requests.release()
+
 	characteristics := make([]DeviceCharacteristic, 0, maxDefaultCharacteristicsToDiscover)
 	foundCharacteristics := make(map[UUID]DeviceCharacteristic)
 
@@ -165,10 +213,14 @@ func (s DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacteri
 		return nil, err
 	}
 
+	// the descriptors of a characteristic end before the next one
+	var previous UUID
+	previousFound := false
+
 	startHandle := s.startHandle
 	endHandle := s.endHandle
 	for startHandle < endHandle {
-		err := s.device.adapter.att.readByTypeReq(s.device.handle, startHandle, endHandle, gattCharacteristicUUID)
+		err := s.device.adapter.att.readByTypeReq(s.device.handle, startHandle, endHandle, gattCharacteristicUUID, timeout)
 		switch {
 		case err == ErrATTOp:
 			opcode, _, errcode := s.device.adapter.att.lastError(s.device.handle)
@@ -189,16 +241,26 @@ func (s DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacteri
 		}
 
 		for _, rawCharacteristic := range cd.characteristics {
+			if previousFound {
+				dc := foundCharacteristics[previous]
+				dc.endHandle = rawCharacteristic.startHandle - 1
+				foundCharacteristics[previous] = dc
+			}
+			previousFound = false
+
 			if len(uuids) == 0 || rawCharacteristic.uuid.isIn(uuids) {
 				dc := DeviceCharacteristic{
 					service:     &s,
 					uuid:        rawCharacteristic.uuid,
 					handle:      rawCharacteristic.valueHandle,
+					endHandle:   s.endHandle,
 					properties:  rawCharacteristic.properties,
 					permissions: CharacteristicPermissions(rawCharacteristic.properties),
 				}
 
 				foundCharacteristics[rawCharacteristic.uuid] = dc
+				previous = rawCharacteristic.uuid
+				previousFound = true
 			}
 
 			startHandle = rawCharacteristic.valueHandle + 1
@@ -230,24 +292,165 @@ func (s DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacteri
 
 	}
 
+	s.cacheCharacteristics(characteristics, len(uuids) == 0)
+
+	if err := s.device.enableServiceChanged(); err != nil {
+		if debug {
+			println("could not enable Service Changed indications:", err.Error())
+		}
+	}
+
 	return characteristics, nil
 }
 
+// Write replaces the characteristic value with a new value. The call returns
+// after all data has been written. Values longer than a write request, MTU-3
+// bytes, are written in parts with prepare write requests, which the
+// peripheral writes together at the end.
+func (c DeviceCharacteristic) Write(p []byte) (n int, err error) {
+	return c.WriteWithTimeout(p, 0)
+}
+
+// WriteWithTimeout writes the value like Write, but fails with ErrTimeout if
+// the peripheral does not respond to one of the requests within the given
+// timeout. A zero timeout uses the adapter's ATT timeout.
+func (c DeviceCharacteristic) WriteWithTimeout(p []byte, timeout time.Duration) (n int, err error) {
+	if !c.permissions.Write() {
+		return 0, errNoWrite
+	}
+
+	d := c.service.device
+	d.requests.acquire()
+	defer d.requests.release()
+
+	err = d.withSecurityRetry(func() error {
+		if len(p) > int(d.MTU())-3 {
+			return d.adapter.att.writeLong(d.handle, c.handle, p, timeout)
+		}
+		return d.adapter.att.writeReq(d.handle, c.handle, p, timeout)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
 // WriteWithoutResponse replaces the characteristic value with a new value. The
 // call will return before all data has been written. A limited number of such
-// writes can be in flight at any given time. This call is also known as a
-// "write command" (as opposed to a write request).
+// writes can be in flight at any given time: while all the ACL buffers of the
+// controller are in use, the call blocks until one is freed. This call is also
+// known as a "write command" (as opposed to a write request).
+//
+// Values longer than MTU-3 bytes are split into several writes, unless write
+// chunking has been disabled with SetWriteChunking.
 func (c DeviceCharacteristic) WriteWithoutResponse(p []byte) (n int, err error) {
+	return c.writeWithoutResponse(p, true)
+}
+
+// TryWriteWithoutResponse is like WriteWithoutResponse, but returns
+// ErrWouldBlock instead of blocking while all the ACL buffers of the
+// controller are in use. If the value was split into several writes, n is the
+// number of bytes that have been written.
+func (c DeviceCharacteristic) TryWriteWithoutResponse(p []byte) (n int, err error) {
+	return c.writeWithoutResponse(p, false)
+}
+
+func (c DeviceCharacteristic) writeWithoutResponse(p []byte, wait bool) (n int, err error) {
 	if !c.permissions.WriteWithoutResponse() {
 		return 0, errNoWriteWithoutResponse
 	}
 
-	err = c.service.device.adapter.att.writeCmd(c.service.device.handle, c.handle, p)
-	if err != nil {
-		return 0, err
+	d := c.service.device
+	size := chunkSize(d.MTU())
+	if len(p) > size && d.adapter.strictWriteBoundaries {
+		return 0, errWriteTooLong
 	}
 
-	return len(p), nil
+	for {
+		end := len(p)
+		if end-n > size {
+			end = n + size
+		}
+
+		if wait {
+			if err := d.adapter.hci.waitForCredits(); err != nil {
+				return n, err
+			}
+		} else if !d.adapter.hci.hasCredits() {
+			return n, ErrWouldBlock
+		}
+
+		if err := d.adapter.att.writeCmd(d.handle, c.handle, p[n:end]); err != nil {
+			return n, err
+		}
+		n = end
+
+		if n == len(p) {
+			return n, nil
+		}
+	}
+}
+
+// WritePipeline coalesces small WriteWithoutResponse payloads for a single
+// characteristic into writes of up to MTU-3 bytes, paced by the number of free
+// ACL buffers in the controller. It is intended for streaming applications in
+// which the peripheral does not depend on packet boundaries.
+type WritePipeline struct {
+	char DeviceCharacteristic
+	buf  []byte
+	n    int
+}
+
+// NewWritePipeline returns a new write pipeline for this characteristic,
+// sized according to the current MTU of the connection.
+func (c DeviceCharacteristic) NewWritePipeline() (*WritePipeline, error) {
+	if !c.permissions.WriteWithoutResponse() {
+		return nil, errNoWriteWithoutResponse
+	}
+
+	return &WritePipeline{
+		char: c,
+		buf:  make([]byte, c.service.device.MTU()-3),
+	}, nil
+}
+
+// Write queues p to be written to the characteristic. Full packets are sent
+// out as soon as they fill up, any remaining data is kept until the next call
+// to Write or Flush.
+func (w *WritePipeline) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		c := copy(w.buf[w.n:], p)
+		w.n += c
+		n += c
+		p = p[c:]
+
+		if w.n == len(w.buf) {
+			if err := w.Flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Flush sends any queued data to the characteristic, waiting for the
+// controller to have a free buffer if needed.
+func (w *WritePipeline) Flush() error {
+	if w.n == 0 {
+		return nil
+	}
+
+	device := w.char.service.device
+	if err := device.adapter.hci.waitForCredits(); err != nil {
+		return err
+	}
+
+	err := device.adapter.att.writeCmd(device.handle, w.char.handle, w.buf[:w.n])
+	w.n = 0
+
+	return err
 }
 
 // EnableNotifications enables notifications in the Client Characteristic
@@ -255,67 +458,172 @@ func (c DeviceCharacteristic) WriteWithoutResponse(p []byte) (n int, err error)
 // notification with a new value every time the value of the characteristic
 // changes.
 //
+// The slice passed to the callback is only valid until the callback returns,
+// as its buffer is then reused for the next notification. A callback that
+// keeps the value, for example to send it on a channel, must copy it.
+//
 // Users may call EnableNotifications with a nil callback to disable notifications.
 func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) error {
+	return c.EnableNotificationsWithTimeout(callback, 0)
+}
+
+// EnableNotificationsWithTimeout enables or disables notifications like
+// EnableNotifications, but fails with ErrTimeout if the peripheral does not
+// respond within the given timeout. A zero timeout uses the adapter's ATT
+// timeout.
+func (c DeviceCharacteristic) EnableNotificationsWithTimeout(callback func(buf []byte), timeout time.Duration) error {
 	if !c.permissions.Notify() {
 		return errNoNotify
 	}
 
+	return c.subscribe(callback, false, timeout)
+}
+
+// EnableIndications enables indications in the Client Characteristic
+// Configuration Descriptor (CCCD). Indications are like notifications, but
+// each one is confirmed to the peripheral, which is done automatically once it
+// has been queued for the callback. As with EnableNotifications, the slice
+// passed to the callback is only valid until the callback returns.
+//
+// Users may call EnableIndications with a nil callback to disable indications.
+func (c DeviceCharacteristic) EnableIndications(callback func(buf []byte)) error {
+	return c.EnableIndicationsWithTimeout(callback, 0)
+}
+
+// EnableIndicationsWithTimeout enables or disables indications like
+// EnableIndications, but fails with ErrTimeout if the peripheral does not
+// respond within the given timeout. A zero timeout uses the adapter's ATT
+// timeout.
+func (c DeviceCharacteristic) EnableIndicationsWithTimeout(callback func(buf []byte), timeout time.Duration) error {
+	if !c.permissions.Indicate() {
+		return errNoIndicate
+	}
+
+	return c.subscribe(callback, true, timeout)
+}
+
+// subscribe enables notifications, or indications if indicate is set, or
+// disables both if callback is nil. The CCCD write fails after timeout, or
+// after the ATT timeout if it is zero.
+func (c DeviceCharacteristic) subscribe(callback func(buf []byte), indicate bool, timeout time.Duration) error {
+	value := []byte{0x00, 0x00}
 	switch {
 	case callback == nil:
-		// disable notifications
 		if debug {
 			println("disabling notifications")
 		}
-
-		err := c.service.device.adapter.att.writeReq(c.service.device.handle, c.handle+1, []byte{0x00, 0x00})
-		if err != nil {
-			return err
+	case indicate:
+		if debug {
+			println("enabling indications")
 		}
+		value[0] = 0x02
 	default:
-		// enable notifications
 		if debug {
 			println("enabling notifications")
 		}
+		value[0] = 0x01
+	}
 
-		err := c.service.device.adapter.att.writeReq(c.service.device.handle, c.handle+1, []byte{0x01, 0x00})
-		if err != nil {
-			return err
-		}
+	c.service.device.requests.acquire()
+	defer c.service.device.requests.release()
+
+	err := c.service.device.withSecurityRetry(func() error {
+		return c.service.device.adapter.att.writeReq(c.service.device.handle, c.handle+1, value, timeout)
+	})
+	if err != nil {
+		return err
 	}
 
 	c.callback = callback
+	c.service.device.cacheSubscription(c.handle, callback, indicate)
+
+	if callback == nil {
+		c.service.device.removeNotificationRegistration(c.handle)
+		return nil
+	}
 
 	c.service.device.startNotifications()
-	c.service.device.addNotificationRegistration(c.handle, c.callback)
 
-	return nil
+	return c.service.device.addNotificationRegistration(c.handle, c.callback)
 }
 
-// GetMTU returns the MTU for the characteristic.
+// ReadSubscription reads the Client Characteristic Configuration Descriptor
+// (CCCD) back from the peripheral, and returns whether notifications and
+// indications are enabled.
+func (c DeviceCharacteristic) ReadSubscription() (notify, indicate bool, err error) {
+	if !c.permissions.Notify() && !c.permissions.Indicate() {
+		return false, false, errNoNotify
+	}
+
+	d := c.service.device
+	d.requests.acquire()
+	defer d.requests.release()
+
+	err = d.withSecurityRetry(func() error {
+		return d.adapter.att.readReq(d.handle, c.handle+1, 0)
+	})
+	if err != nil {
+		return false, false, err
+	}
+
+	cd, err := d.adapter.att.findConnectionData(d.handle)
+	if err != nil {
+		return false, false, err
+	}
+
+	if len(cd.value) < 2 {
+		return false, false, errReadFailed
+	}
+
+	return cd.value[0]&0x01 != 0, cd.value[0]&0x02 != 0, nil
+}
+
+// GetMTU returns the MTU for the characteristic. The largest MTU supported is
+// requested first, unless the MTU has already been exchanged.
 func (c DeviceCharacteristic) GetMTU() (uint16, error) {
-	err := c.service.device.adapter.att.mtuReq(c.service.device.handle)
+	d := c.service.device
+	cd, err := d.adapter.att.findConnectionData(d.handle)
 	if err != nil {
 		return 0, err
 	}
 
-	c.service.device.mtu = c.service.device.adapter.att.mtu
+	if !cd.mtuExchanged {
+		if err := d.RequestMTU(d.adapter.att.maxMTU); err != nil {
+			return 0, err
+		}
+	}
 
-	return c.service.device.mtu, nil
+	return d.MTU(), nil
 }
 
 // Read reads the current characteristic value.
 func (c DeviceCharacteristic) Read(data []byte) (int, error) {
+	return c.ReadWithTimeout(data, 0)
+}
+
+// ReadWithTimeout reads the current characteristic value, like Read, but fails
+// with ErrTimeout if the peripheral does not respond within the given
+// timeout. A zero timeout uses the adapter's ATT timeout.
+//
+// Values that don't fit in a single response are read in parts, until data is
+// full or the whole value has been read.
+func (c DeviceCharacteristic) ReadWithTimeout(data []byte, timeout time.Duration) (int, error) {
 	if !c.permissions.Read() {
 		return 0, errNoRead
 	}
 
-	err := c.service.device.adapter.att.readReq(c.service.device.handle, c.handle)
+	d := c.service.device
+	d.requests.acquire()
+	defer d.requests.release()
+
+	err := d.withSecurityRetry(func() error {
+		return d.adapter.att.readReq(d.handle, c.handle, timeout)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	cd, err := c.service.device.adapter.att.findConnectionData(c.service.device.handle)
+	cd, err := d.adapter.att.findConnectionData(d.handle)
 	if err != nil {
 		return 0, err
 	}
@@ -325,6 +633,238 @@ func (c DeviceCharacteristic) Read(data []byte) (int, error) {
 	}
 
 	copy(data, cd.value)
+	received := len(cd.value)
+
+	// a full response means the value may be longer
+	for len(cd.value) == int(d.MTU())-1 && received < len(data) {
+		err := d.adapter.att.readBlobReq(d.handle, c.handle, uint16(received), timeout)
+		if err == ErrATTOp {
+			_, _, code := d.adapter.att.lastError(d.handle)
+			if code == attErrorAttrNotLong || code == attErrorInvalidOffset {
+				// the value was exactly as long as a response
+				break
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		copy(data[received:], cd.value)
+		received += len(cd.value)
+	}
+
+	return received, nil
+}
+
+// withSecurityRetry runs an ATT request. If the request fails because the link
+// is not authenticated or encrypted and automatic pairing has been enabled on
+// the adapter, the device is paired and the request is retried once.
+// Otherwise, ErrInsufficientSecurity is returned.
+func (d Device) withSecurityRetry(req func() error) error {
+	err := req()
+	if err != ErrATTOp || !d.insufficientSecurity() {
+		return err
+	}
+
+	if !d.adapter.autoPair {
+		return ErrInsufficientSecurity
+	}
+
+	if debug {
+		println("insufficient security, pairing and retrying")
+	}
+
+	if err := d.pair(); err != nil {
+		return err
+	}
+
+	err = req()
+	if err == ErrATTOp && d.insufficientSecurity() {
+		return ErrInsufficientSecurity
+	}
+
+	return err
+}
+
+// insufficientSecurity returns whether the last ATT request failed because of
+// insufficient authentication or encryption.
+func (d Device) insufficientSecurity() bool {
+	_, _, code := d.adapter.att.lastError(d.handle)
+	switch code {
+	case attErrorAuthentication, attErrorInsuffEnc, attErrorInsuffEncrKeySize:
+		return true
+	}
+
+	return false
+}
+
+// DeviceDescriptor is a descriptor of a characteristic on a connected
+// peripheral device.
+type DeviceDescriptor struct {
+	uuid UUID
+
+	device Device
+	handle uint16
+}
+
+// UUID returns the UUID for this DeviceDescriptor.
+func (d DeviceDescriptor) UUID() UUID {
+	return d.uuid
+}
+
+// DiscoverDescriptors discovers all the descriptors of this characteristic,
+// including the Client Characteristic Configuration Descriptor.
+func (c DeviceCharacteristic) DiscoverDescriptors() ([]DeviceDescriptor, error) {
+	return c.DiscoverDescriptorsWithTimeout(0)
+}
+
+// DiscoverDescriptorsWithTimeout discovers descriptors like DiscoverDescriptors,
+// but fails with ErrTimeout if the peripheral does not respond to one of the
+// requests within the given timeout. A zero timeout uses the adapter's ATT
+// timeout.
+func (c DeviceCharacteristic) DiscoverDescriptorsWithTimeout(timeout time.Duration) ([]DeviceDescriptor, error) {
+	if debug {
+		println("DiscoverDescriptors")
+	}
+
+	d := c.service.device
+	d.requests.acquire()
+	defer d.requests.release()
+
+	cd, err := d.adapter.att.findConnectionData(d.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	var descriptors []DeviceDescriptor
+	startHandle := c.handle + 1
+	for startHandle != 0 && startHandle <= c.endHandle {
+		cd.descriptors = cd.descriptors[:0]
+
+		err := d.adapter.att.findInfoReq(d.handle, startHandle, c.endHandle, timeout)
+		switch {
+		case err == ErrATTOp:
+			_, _, errcode := d.adapter.att.lastError(d.handle)
+			if errcode == attErrorAttrNotFound {
+				// no more descriptors
+				return descriptors, nil
+			}
+			return nil, err
+		case err != nil:
+			return nil, err
+		}
+
+		if len(cd.descriptors) == 0 {
+			break
+		}
+
+		for _, rawDescriptor := range cd.descriptors {
+			uuid := rawDescriptor.uuid()
+			if uuid == New16BitUUID(gattCharacteristicUUID) {
+				// the end handle was not known, the next characteristic
+				// has been reached
+				return descriptors, nil
+			}
+
+			descriptors = append(descriptors, DeviceDescriptor{
+				uuid:   uuid,
+				device: d,
+				handle: rawDescriptor.handle,
+			})
+
+			startHandle = rawDescriptor.handle + 1
+		}
+	}
+
+	return descriptors, nil
+}
+
+// Read reads the value of the descriptor.
+func (d DeviceDescriptor) Read(data []byte) (int, error) {
+	d.device.requests.acquire()
+	defer d.device.requests.release()
+
+	err := d.device.withSecurityRetry(func() error {
+		return d.device.adapter.att.readReq(d.device.handle, d.handle, 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	cd, err := d.device.adapter.att.findConnectionData(d.device.handle)
+	if err != nil {
+		return 0, err
+	}
+
+	return copy(data, cd.value), nil
+}
+
+// Write writes a new value to the descriptor, and waits for the peripheral to
+// confirm it.
+func (d DeviceDescriptor) Write(p []byte) (int, error) {
+	d.device.requests.acquire()
+	defer d.device.requests.release()
+
+	err := d.device.withSecurityRetry(func() error {
+		if len(p) > int(d.device.MTU())-3 {
+			return d.device.adapter.att.writeLong(d.device.handle, d.handle, p, 0)
+		}
+		return d.device.adapter.att.writeReq(d.device.handle, d.handle, p, 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// UserDescription returns the human-readable name of the characteristic, from
+// its Characteristic User Description descriptor.
+func (c DeviceCharacteristic) UserDescription() (string, error) {
+	d, err := c.findDescriptor(DescriptorUUIDCharacteristicUserDescription)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, c.service.device.MTU()-1)
+	n, err := d.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf[:n]), nil
+}
+
+// PresentationFormat returns the format of the value of the characteristic,
+// from its Characteristic Presentation Format descriptor.
+func (c DeviceCharacteristic) PresentationFormat() (PresentationFormat, error) {
+	d, err := c.findDescriptor(DescriptorUUIDCharacteristicPresentationFormat)
+	if err != nil {
+		return PresentationFormat{}, err
+	}
+
+	var buf [7]byte
+	n, err := d.Read(buf[:])
+	if err != nil {
+		return PresentationFormat{}, err
+	}
+
+	return ParsePresentationFormat(buf[:n])
+}
+
+// findDescriptor discovers the descriptors of the characteristic, and returns
+// the first one with the UUID.
+func (c DeviceCharacteristic) findDescriptor(uuid UUID) (DeviceDescriptor, error) {
+	descriptors, err := c.DiscoverDescriptors()
+	if err != nil {
+		return DeviceDescriptor{}, err
+	}
+
+	for _, d := range descriptors {
+		if d.uuid == uuid {
+			return d, nil
+		}
+	}
 
-	return len(cd.value), nil
+	return DeviceDescriptor{}, errDescriptorNotFound
 }
@@ -56,8 +56,8 @@ func (d Device) DiscoverServices(uuids []UUID) ([]DeviceService, error) {
 		// TODO: actually there is, by waiting for a property change event of
 		// ServicesResolved.
 		time.Sleep(10 * time.Millisecond)
-		if time.Since(start) > 10*time.Second {
-			return nil, errors.New("timeout on DiscoverServices")
+		if time.Since(start) > d.adapter.timeout() {
+			return nil, ErrTimeout
 		}
 	}
 
@@ -132,6 +132,7 @@ type DeviceCharacteristic struct {
 	uuidWrapper
 	adapter                      *Adapter
 	characteristic               dbus.BusObject
+	permissions                  CharacteristicPermissions
 	property                     chan *dbus.Signal // channel where notifications are reported
 	propertiesChangedMatchOption dbus.MatchOption  // the same value must be passed to RemoveMatchSignal
 }
@@ -141,6 +142,25 @@ func (c DeviceCharacteristic) UUID() UUID {
 	return c.uuidWrapper
 }
 
+// Permissions returns the properties of the characteristic, as discovered by
+// DiscoverCharacteristics: the operations the peripheral allows on it.
+func (c DeviceCharacteristic) Permissions() CharacteristicPermissions {
+	return c.permissions
+}
+
+// characteristicFlags maps the BlueZ characteristic flags to the properties
+// of the characteristic declaration.
+var characteristicFlags = map[string]CharacteristicPermissions{
+	"broadcast":                   CharacteristicBroadcastPermission,
+	"read":                        CharacteristicReadPermission,
+	"write-without-response":      CharacteristicWriteWithoutResponsePermission,
+	"write":                       CharacteristicWritePermission,
+	"notify":                      CharacteristicNotifyPermission,
+	"indicate":                    CharacteristicIndicatePermission,
+	"authenticated-signed-writes": CharacteristicAuthenticatedSignedWritesPermission,
+	"extended-properties":         CharacteristicExtendedPropertiesPermission,
+}
+
 // DiscoverCharacteristics discovers characteristics in this service. Pass a
 // list of characteristic UUIDs you are interested in to this function. Either a
 // list of all requested services is returned, or if some services could not be
@@ -184,6 +204,11 @@ func (s DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacteri
 			adapter:        s.adapter,
 			characteristic: s.adapter.bus.Object("org.bluez", dbus.ObjectPath(objectPath)),
 		}
+		if flags, ok := properties["Flags"].Value().([]string); ok {
+			for _, flag := range flags {
+				char.permissions |= characteristicFlags[flag]
+			}
+		}
 
 		if len(uuids) > 0 {
 			// The caller wants to get a list of characteristics in a specific
@@ -222,13 +247,23 @@ func (s DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacteri
 // writes can be in flight at any given time. This call is also known as a
 // "write command" (as opposed to a write request).
 func (c DeviceCharacteristic) WriteWithoutResponse(p []byte) (n int, err error) {
-	err = c.characteristic.Call("org.bluez.GattCharacteristic1.WriteValue", 0, p, map[string]dbus.Variant(nil)).Err
+	err = c.adapter.callWithTimeout(c.characteristic, "org.bluez.GattCharacteristic1.WriteValue", p, map[string]dbus.Variant(nil)).Err
 	if err != nil {
 		return 0, err
 	}
 	return len(p), nil
 }
 
+// writeRequest writes p with a write request. BlueZ uses a long write if it
+// doesn't fit in one.
+func (c DeviceCharacteristic) writeRequest(p []byte) error {
+	options := map[string]dbus.Variant{
+		"type": dbus.MakeVariant("request"),
+	}
+
+	return c.adapter.callWithTimeout(c.characteristic, "org.bluez.GattCharacteristic1.WriteValue", p, options).Err
+}
+
 // EnableNotifications enables notifications in the Client Characteristic
 // Configuration Descriptor (CCCD). This means that most peripherals will send a
 // notification with a new value every time the value of the characteristic
@@ -248,7 +283,7 @@ func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) err
 		c.propertiesChangedMatchOption = dbus.WithMatchInterface("org.freedesktop.DBus.Properties")
 		c.adapter.bus.AddMatchSignal(c.propertiesChangedMatchOption)
 
-		err := c.characteristic.Call("org.bluez.GattCharacteristic1.StartNotify", 0).Err
+		err := c.adapter.callWithTimeout(c.characteristic, "org.bluez.GattCharacteristic1.StartNotify").Err
 		if err != nil {
 			return err
 		}
@@ -298,7 +333,7 @@ func (c DeviceCharacteristic) GetMTU() (uint16, error) {
 func (c DeviceCharacteristic) Read(data []byte) (int, error) {
 	options := make(map[string]interface{})
 	var result []byte
-	err := c.characteristic.Call("org.bluez.GattCharacteristic1.ReadValue", 0, options).Store(&result)
+	err := c.adapter.callWithTimeout(c.characteristic, "org.bluez.GattCharacteristic1.ReadValue", options).Store(&result)
 	if err != nil {
 		return 0, err
 	}
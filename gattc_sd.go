@@ -23,6 +23,7 @@ var (
 	errAlreadyDiscovering = errors.New("bluetooth: already discovering a service or characteristic")
 	errNotFound           = errors.New("bluetooth: not found")
 	errNoNotify           = errors.New("bluetooth: no notify permission")
+	errNoWriteRequest     = errors.New("bluetooth: write requests are not supported")
 )
 
 // A global used while discovering services, to communicate between the main
@@ -171,6 +172,12 @@ func (c DeviceCharacteristic) UUID() UUID {
 	return c.uuid.UUID()
 }
 
+// Permissions returns the properties of the characteristic, as discovered by
+// DiscoverCharacteristics: the operations the peripheral allows on it.
+func (c DeviceCharacteristic) Permissions() CharacteristicPermissions {
+	return c.permissions
+}
+
 // A global used to pass information from the event handler back to the
 // DiscoverCharacteristics function below.
 var discoveringCharacteristic struct {
@@ -272,6 +279,9 @@ func (s DeviceService) DiscoverCharacteristics(uuids []UUID) ([]DeviceCharacteri
 		if rawPermissions.bitfield_indicate() != 0 {
 			permissions |= CharacteristicIndicatePermission
 		}
+		if rawPermissions.bitfield_auth_signed_wr() != 0 {
+			permissions |= CharacteristicAuthenticatedSignedWritesPermission
+		}
 
 		dc := DeviceCharacteristic{uuid: shortUUID(discoveringCharacteristic.uuid)}
 		dc.permissions = permissions
@@ -334,6 +344,12 @@ func (c DeviceCharacteristic) WriteWithoutResponse(p []byte) (n int, err error)
 	return len(p), nil
 }
 
+// writeRequest would write p with a write request, which this backend doesn't
+// support yet.
+func (c DeviceCharacteristic) writeRequest(p []byte) error {
+	return errNoWriteRequest
+}
+
 type gattcNotificationCallback struct {
 	connectionHandle C.uint16_t
 	valueHandle      C.uint16_t // may be 0 if the slot is empty
@@ -0,0 +1,153 @@
+//go:build !softdevice || s132v6 || s140v6 || s140v7
+
+package bluetooth
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// maximum number of received bytes that are buffered until they are read.
+const streamBufferSize = 4096
+
+var (
+	ErrStreamOverflow = errors.New("bluetooth: stream receive buffer overflow")
+)
+
+// CharacteristicStream is a byte stream over a pair of characteristics of a
+// peripheral: data is written to one characteristic using writes without
+// response, and received as notifications from the other, like the Nordic
+// UART Service does. It implements io.ReadWriteCloser.
+//
+// Writes are split into chunks that fit the MTU of the connection. Packet
+// boundaries are not preserved, so the protocol that runs over the stream
+// must not depend on them.
+type CharacteristicStream struct {
+	tx, rx streamCharacteristic
+	chunk  int
+
+	mu       sync.Mutex
+	buf      []byte
+	overflow bool
+	closed   bool
+
+	// ready is signalled when data has been received or the stream is closed.
+	ready chan struct{}
+}
+
+// streamCharacteristic is the part of DeviceCharacteristic used by
+// CharacteristicStream.
+type streamCharacteristic interface {
+	GetMTU() (uint16, error)
+	WriteWithoutResponse(p []byte) (n int, err error)
+	EnableNotifications(callback func(buf []byte)) error
+}
+
+// NewCharacteristicStream returns a stream that writes to tx and receives
+// notifications from rx. It enables notifications on rx.
+func NewCharacteristicStream(tx, rx DeviceCharacteristic) (*CharacteristicStream, error) {
+	return newCharacteristicStream(tx, rx)
+}
+
+func newCharacteristicStream(tx, rx streamCharacteristic) (*CharacteristicStream, error) {
+	mtu, err := tx.GetMTU()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &CharacteristicStream{
+		tx:    tx,
+		rx:    rx,
+		chunk: chunkSize(mtu),
+		ready: make(chan struct{}, 1),
+	}
+
+	if err := rx.EnableNotifications(s.receive); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// receive is the notification callback.
+func (s *CharacteristicStream) receive(b []byte) {
+	s.mu.Lock()
+	if len(s.buf)+len(b) > streamBufferSize {
+		s.overflow = true
+	} else {
+		s.buf = append(s.buf, b...)
+	}
+	s.mu.Unlock()
+
+	s.wake()
+}
+
+func (s *CharacteristicStream) wake() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Read reads received data, waiting for data to arrive if there is none. It
+// returns ErrStreamOverflow once if data was lost because it was not read
+// fast enough, and io.EOF after the stream has been closed.
+func (s *CharacteristicStream) Read(p []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		switch {
+		case s.overflow:
+			s.overflow = false
+			s.mu.Unlock()
+			return 0, ErrStreamOverflow
+
+		case len(s.buf) > 0:
+			n := copy(p, s.buf)
+			s.buf = s.buf[:copy(s.buf, s.buf[n:])]
+			s.mu.Unlock()
+			return n, nil
+
+		case s.closed:
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+		s.mu.Unlock()
+
+		<-s.ready
+	}
+}
+
+// Write writes p to the stream.
+func (s *CharacteristicStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	written := 0
+	err := writeChunks(p, s.chunk, s.tx.WriteWithoutResponse, func(n, total int) {
+		written = n
+	})
+
+	return written, err
+}
+
+// Close disables notifications and closes the stream. Pending reads return
+// io.EOF once all received data has been read.
+func (s *CharacteristicStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.wake()
+
+	return s.rx.EnableNotifications(nil)
+}
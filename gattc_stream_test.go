@@ -0,0 +1,149 @@
+//go:build !softdevice || s132v6 || s140v6 || s140v7
+
+package bluetooth
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// fakeCharacteristic records the writes and the notification callback of a
+// characteristic.
+type fakeCharacteristic struct {
+	mtu      uint16
+	writes   [][]byte
+	callback func(buf []byte)
+	disabled bool
+}
+
+func (c *fakeCharacteristic) GetMTU() (uint16, error) {
+	return c.mtu, nil
+}
+
+func (c *fakeCharacteristic) WriteWithoutResponse(p []byte) (int, error) {
+	c.writes = append(c.writes, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func (c *fakeCharacteristic) EnableNotifications(callback func(buf []byte)) error {
+	c.callback = callback
+	c.disabled = callback == nil
+	return nil
+}
+
+func TestCharacteristicStreamRead(t *testing.T) {
+	tx, rx := &fakeCharacteristic{mtu: 23}, &fakeCharacteristic{mtu: 23}
+	s, err := newCharacteristicStream(tx, rx)
+	if err != nil {
+		t.Fatalf("expected nil but got %v", err)
+	}
+	if rx.callback == nil {
+		t.Fatal("expected notifications to be enabled")
+	}
+
+	rx.callback([]byte("hello "))
+	rx.callback([]byte("world"))
+
+	buf := make([]byte, 8)
+	n, err := s.Read(buf)
+	if err != nil || string(buf[:n]) != "hello wo" {
+		t.Fatalf("expected \"hello wo\" but got %q, %v", buf[:n], err)
+	}
+	n, err = s.Read(buf)
+	if err != nil || string(buf[:n]) != "rld" {
+		t.Fatalf("expected \"rld\" but got %q, %v", buf[:n], err)
+	}
+}
+
+func TestCharacteristicStreamWrite(t *testing.T) {
+	tx, rx := &fakeCharacteristic{mtu: 23}, &fakeCharacteristic{mtu: 23}
+	s, err := newCharacteristicStream(tx, rx)
+	if err != nil {
+		t.Fatalf("expected nil but got %v", err)
+	}
+
+	payload := []byte("The quick brown fox jumps over the lazy dog")
+	n, err := s.Write(payload)
+	if err != nil || n != len(payload) {
+		t.Fatalf("expected %d, nil but got %d, %v", len(payload), n, err)
+	}
+
+	if len(tx.writes) != 3 {
+		t.Fatalf("expected 3 writes but got %d", len(tx.writes))
+	}
+	if got := bytes.Join(tx.writes, nil); !bytes.Equal(got, payload) {
+		t.Errorf("expected %q but got %q", payload, got)
+	}
+}
+
+func TestCharacteristicStreamOverflow(t *testing.T) {
+	tx, rx := &fakeCharacteristic{mtu: 23}, &fakeCharacteristic{mtu: 23}
+	s, err := newCharacteristicStream(tx, rx)
+	if err != nil {
+		t.Fatalf("expected nil but got %v", err)
+	}
+
+	rx.callback(make([]byte, streamBufferSize))
+	rx.callback([]byte{1})
+
+	if _, err := s.Read(make([]byte, 1)); err != ErrStreamOverflow {
+		t.Fatalf("expected ErrStreamOverflow but got %v", err)
+	}
+	if n, err := s.Read(make([]byte, streamBufferSize)); err != nil || n != streamBufferSize {
+		t.Fatalf("expected %d, nil but got %d, %v", streamBufferSize, n, err)
+	}
+}
+
+func TestCharacteristicStreamClose(t *testing.T) {
+	tx, rx := &fakeCharacteristic{mtu: 23}, &fakeCharacteristic{mtu: 23}
+	s, err := newCharacteristicStream(tx, rx)
+	if err != nil {
+		t.Fatalf("expected nil but got %v", err)
+	}
+
+	rx.callback([]byte("bye"))
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("expected nil but got %v", err)
+	}
+	if !rx.disabled {
+		t.Error("expected notifications to be disabled")
+	}
+
+	// received data can still be read after closing
+	buf := make([]byte, 8)
+	n, err := s.Read(buf)
+	if err != nil || string(buf[:n]) != "bye" {
+		t.Fatalf("expected \"bye\" but got %q, %v", buf[:n], err)
+	}
+	if _, err := s.Read(buf); err != io.EOF {
+		t.Errorf("expected io.EOF but got %v", err)
+	}
+
+	if _, err := s.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("expected io.ErrClosedPipe but got %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("expected nil on second Close but got %v", err)
+	}
+}
+
+func TestCharacteristicStreamCloseWakesRead(t *testing.T) {
+	tx, rx := &fakeCharacteristic{mtu: 23}, &fakeCharacteristic{mtu: 23}
+	s, err := newCharacteristicStream(tx, rx)
+	if err != nil {
+		t.Fatalf("expected nil but got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := s.Read(make([]byte, 1))
+		done <- err
+	}()
+
+	s.Close()
+	if err := <-done; err != io.EOF {
+		t.Errorf("expected io.EOF but got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package bluetooth
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned by GATT client operations, such as a discovery,
+	// a read, a write or a subscription, when the peripheral does not respond
+	// in time. The timeout can be changed with Adapter.SetATTTimeout.
+	ErrTimeout = errors.New("bluetooth: timeout")
+)
+
+// defaultATTTimeout is how long GATT client operations wait for the
+// peripheral by default.
+const defaultATTTimeout = 10 * time.Second
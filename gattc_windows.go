@@ -37,7 +37,7 @@ func (d Device) DiscoverServices(filterUUIDs []UUID) ([]DeviceService, error) {
 		return nil, err
 	}
 
-	if err := awaitAsyncOperation(getServicesOperation, genericattributeprofile.SignatureGattDeviceServicesResult); err != nil {
+	if err := awaitAsyncOperationTimeout(getServicesOperation, genericattributeprofile.SignatureGattDeviceServicesResult, d.timeout); err != nil {
 		return nil, err
 	}
 
@@ -157,7 +157,7 @@ func (s DeviceService) DiscoverCharacteristics(filterUUIDs []UUID) ([]DeviceChar
 	}
 
 	// IAsyncOperation<GattCharacteristicsResult>
-	if err := awaitAsyncOperation(getCharacteristicsOp, genericattributeprofile.SignatureGattCharacteristicsResult); err != nil {
+	if err := awaitAsyncOperationTimeout(getCharacteristicsOp, genericattributeprofile.SignatureGattCharacteristicsResult, s.device.timeout); err != nil {
 		return nil, err
 	}
 
@@ -246,6 +246,13 @@ func (c DeviceCharacteristic) Properties() uint32 {
 	return uint32(c.properties)
 }
 
+// Permissions returns the properties of the characteristic, as discovered by
+// DiscoverCharacteristics: the operations the peripheral allows on it.
+func (c DeviceCharacteristic) Permissions() CharacteristicPermissions {
+	// the first 8 bits match the properties of the characteristic declaration
+	return CharacteristicPermissions(c.properties & 0xff)
+}
+
 // GetMTU returns the MTU for the characteristic.
 func (c DeviceCharacteristic) GetMTU() (uint16, error) {
 	return c.service.device.session.GetMaxPduSize()
@@ -293,7 +300,7 @@ func (c DeviceCharacteristic) write(p []byte, mode genericattributeprofile.GattW
 	// IAsyncOperation<GattCommunicationStatus>
 	asyncOp, err := c.characteristic.WriteValueWithOptionAsync(value, mode)
 
-	if err := awaitAsyncOperation(asyncOp, genericattributeprofile.SignatureGattCommunicationStatus); err != nil {
+	if err := awaitAsyncOperationTimeout(asyncOp, genericattributeprofile.SignatureGattCommunicationStatus, c.service.device.timeout); err != nil {
 		return 0, err
 	}
 
@@ -325,7 +332,7 @@ func (c DeviceCharacteristic) Read(data []byte) (int, error) {
 	}
 
 	// IAsyncOperation<GattReadResult>
-	if err := awaitAsyncOperation(readOp, genericattributeprofile.SignatureGattReadResult); err != nil {
+	if err := awaitAsyncOperationTimeout(readOp, genericattributeprofile.SignatureGattReadResult, c.service.device.timeout); err != nil {
 		return 0, err
 	}
 
@@ -415,7 +422,7 @@ func (c DeviceCharacteristic) EnableNotifications(callback func(buf []byte)) err
 	}
 
 	// IAsyncOperation<GattCommunicationStatus>
-	if err := awaitAsyncOperation(writeOp, genericattributeprofile.SignatureGattCommunicationStatus); err != nil {
+	if err := awaitAsyncOperationTimeout(writeOp, genericattributeprofile.SignatureGattCommunicationStatus, c.service.device.timeout); err != nil {
 		return err
 	}
 
@@ -0,0 +1,34 @@
+//go:build !softdevice || s132v6 || s140v6 || s140v7
+
+package bluetooth
+
+// WriteAll writes the complete payload p to the characteristic, split into
+// chunks that each fit in a single write without response for the current
+// MTU. The optional progress callback is called after each chunk with the
+// number of bytes written so far.
+//
+// The peripheral receives every chunk as a separate write, so this is only
+// suitable for protocols that don't depend on packet boundaries. If the
+// characteristic only supports writes with a response, the payload is written
+// at once with a write request instead, which is a long write if it doesn't
+// fit in a single one, and the progress callback is called once it is done.
+func (c DeviceCharacteristic) WriteAll(p []byte, progress func(written, total int)) error {
+	if permissions := c.Permissions(); permissions.Write() && !permissions.WriteWithoutResponse() {
+		if err := c.writeRequest(p); err != nil {
+			return err
+		}
+
+		if progress != nil {
+			progress(len(p), len(p))
+		}
+
+		return nil
+	}
+
+	mtu, err := c.GetMTU()
+	if err != nil {
+		return err
+	}
+
+	return writeChunks(p, chunkSize(mtu), c.WriteWithoutResponse, progress)
+}
@@ -0,0 +1,10 @@
+//go:build hci || ninafw || cyw43439 || darwin || windows
+
+package bluetooth
+
+// writeRequest writes p with a write request, or a long write if it doesn't
+// fit in one.
+func (c DeviceCharacteristic) writeRequest(p []byte) error {
+	_, err := c.Write(p)
+	return err
+}
@@ -0,0 +1,35 @@
+//go:build hci || ninafw || cyw43439
+
+package gattdef
+
+import (
+	"encoding/hex"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// exportDescriptors discovers the descriptors of a characteristic and reads
+// their values. The Client Characteristic Configuration descriptor is skipped,
+// as it is added automatically on import.
+func exportDescriptors(c bluetooth.DeviceCharacteristic, buf []byte) ([]Descriptor, error) {
+	descriptors, err := c.DiscoverDescriptors()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Descriptor
+	for _, d := range descriptors {
+		if d.UUID() == bluetooth.New16BitUUID(0x2902) {
+			continue
+		}
+
+		descriptor := Descriptor{UUID: formatUUID(d.UUID())}
+		if n, err := d.Read(buf); err == nil {
+			descriptor.Value = hex.EncodeToString(buf[:n])
+		}
+
+		list = append(list, descriptor)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,11 @@
+//go:build !hci && !ninafw && !cyw43439
+
+package gattdef
+
+import "tinygo.org/x/bluetooth"
+
+// exportDescriptors returns no descriptors, as they can't be discovered on
+// this platform.
+func exportDescriptors(c bluetooth.DeviceCharacteristic, buf []byte) ([]Descriptor, error) {
+	return nil, nil
+}
@@ -0,0 +1,297 @@
+// Package gattdef reads and writes GATT databases in a declarative JSON
+// format. A document can be loaded into a list of services to pass to
+// AddService, and the database of a connected device can be exported to the
+// same format, for example to generate code or to compare against a golden
+// file in tests.
+//
+// A document looks like this:
+//
+//	{
+//		"services": [
+//			{
+//				"uuid": "180f",
+//				"characteristics": [
+//					{
+//						"uuid": "2a19",
+//						"flags": ["read", "notify"],
+//						"value": "64",
+//						"descriptors": [
+//							{"uuid": "2901", "value": "42617474657279"}
+//						]
+//					}
+//				]
+//			}
+//		]
+//	}
+//
+// UUIDs are either 16-bit UUIDs in 4 hexadecimal digits, or full UUIDs. Values
+// are encoded in hexadecimal. The Client Characteristic Configuration
+// descriptor is added automatically to characteristics that can notify or
+// indicate, so it must not be listed. Descriptors only use the read and write
+// flags, and a descriptor without flags can only be read. Documents with
+// fields or flags that can't be represented are refused.
+//
+// Descriptors are only exported on HCI, where they can be discovered, and
+// always without flags, as their permissions aren't discoverable.
+//
+// Only JSON is supported, not YAML, as that would make every user of the
+// package depend on a YAML parser. YAML definitions can be converted to JSON
+// with any YAML tool, and the documents written by this package are valid
+// YAML as well.
+package gattdef
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// Database is a GATT database.
+type Database struct {
+	Services []Service `json:"services"`
+}
+
+// Service is a GATT service with its characteristics.
+type Service struct {
+	UUID            string           `json:"uuid"`
+	Characteristics []Characteristic `json:"characteristics,omitempty"`
+}
+
+// Characteristic is a GATT characteristic.
+type Characteristic struct {
+	UUID        string       `json:"uuid"`
+	Flags       []string     `json:"flags,omitempty"`
+	Value       string       `json:"value,omitempty"`
+	Descriptors []Descriptor `json:"descriptors,omitempty"`
+}
+
+// Descriptor is a descriptor of a GATT characteristic.
+type Descriptor struct {
+	UUID  string   `json:"uuid"`
+	Flags []string `json:"flags,omitempty"`
+	Value string   `json:"value,omitempty"`
+}
+
+var flagNames = []struct {
+	name string
+	flag bluetooth.CharacteristicPermissions
+}{
+	{"broadcast", bluetooth.CharacteristicBroadcastPermission},
+	{"read", bluetooth.CharacteristicReadPermission},
+	{"writeWithoutResponse", bluetooth.CharacteristicWriteWithoutResponsePermission},
+	{"write", bluetooth.CharacteristicWritePermission},
+	{"notify", bluetooth.CharacteristicNotifyPermission},
+	{"indicate", bluetooth.CharacteristicIndicatePermission},
+}
+
+// Load reads a document and returns the services it defines.
+func Load(r io.Reader) ([]bluetooth.Service, error) {
+	var db Database
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&db); err != nil {
+		return nil, err
+	}
+
+	return db.ServiceList()
+}
+
+// ServiceList returns the services of the database, ready to be added to an
+// adapter using AddService.
+func (db *Database) ServiceList() ([]bluetooth.Service, error) {
+	services := make([]bluetooth.Service, 0, len(db.Services))
+	for _, s := range db.Services {
+		uuid, err := parseUUID(s.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("gattdef: service %q: %w", s.UUID, err)
+		}
+
+		service := bluetooth.Service{UUID: uuid}
+		for _, c := range s.Characteristics {
+			config, err := c.config()
+			if err != nil {
+				return nil, fmt.Errorf("gattdef: characteristic %q: %w", c.UUID, err)
+			}
+
+			service.Characteristics = append(service.Characteristics, config)
+		}
+
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (c Characteristic) config() (bluetooth.CharacteristicConfig, error) {
+	uuid, err := parseUUID(c.UUID)
+	if err != nil {
+		return bluetooth.CharacteristicConfig{}, err
+	}
+
+	flags, err := parseFlags(c.Flags)
+	if err != nil {
+		return bluetooth.CharacteristicConfig{}, err
+	}
+
+	value, err := hex.DecodeString(c.Value)
+	if err != nil {
+		return bluetooth.CharacteristicConfig{}, err
+	}
+
+	config := bluetooth.CharacteristicConfig{
+		UUID:  uuid,
+		Flags: flags,
+		Value: value,
+	}
+	for _, d := range c.Descriptors {
+		descriptor, err := d.config()
+		if err != nil {
+			return bluetooth.CharacteristicConfig{}, fmt.Errorf("descriptor %q: %w", d.UUID, err)
+		}
+
+		config.Descriptors = append(config.Descriptors, descriptor)
+	}
+
+	return config, nil
+}
+
+func (d Descriptor) config() (bluetooth.DescriptorConfig, error) {
+	uuid, err := parseUUID(d.UUID)
+	if err != nil {
+		return bluetooth.DescriptorConfig{}, err
+	}
+	if uuid == bluetooth.New16BitUUID(0x2902) {
+		return bluetooth.DescriptorConfig{}, errCCCD
+	}
+
+	flags, err := parseFlags(d.Flags)
+	if err != nil {
+		return bluetooth.DescriptorConfig{}, err
+	}
+	if flags&^(bluetooth.CharacteristicReadPermission|bluetooth.CharacteristicWritePermission) != 0 {
+		return bluetooth.DescriptorConfig{}, errDescriptorFlags
+	}
+
+	value, err := hex.DecodeString(d.Value)
+	if err != nil {
+		return bluetooth.DescriptorConfig{}, err
+	}
+
+	return bluetooth.DescriptorConfig{
+		UUID:  uuid,
+		Flags: flags,
+		Value: value,
+	}, nil
+}
+
+func parseFlags(names []string) (bluetooth.CharacteristicPermissions, error) {
+	var flags bluetooth.CharacteristicPermissions
+	for _, name := range names {
+		found := false
+		for _, f := range flagNames {
+			if f.name == name {
+				flags |= f.flag
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("unknown flag %q", name)
+		}
+	}
+
+	return flags, nil
+}
+
+func formatFlags(flags bluetooth.CharacteristicPermissions) []string {
+	var names []string
+	for _, f := range flagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+
+	return names
+}
+
+// Export discovers all services and characteristics of a connected device,
+// with their flags, and reads the values of the characteristics that can be
+// read. Descriptors are only exported on HCI, see the package documentation.
+func Export(device bluetooth.Device) (*Database, error) {
+	services, err := device.DiscoverServices(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{}
+	buf := make([]byte, 512)
+	for _, s := range services {
+		chars, err := s.DiscoverCharacteristics(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		service := Service{UUID: formatUUID(s.UUID())}
+		for _, c := range chars {
+			char := Characteristic{
+				UUID:  formatUUID(c.UUID()),
+				Flags: formatFlags(c.Permissions()),
+			}
+			if n, err := c.Read(buf); err == nil {
+				char.Value = hex.EncodeToString(buf[:n])
+			}
+
+			char.Descriptors, err = exportDescriptors(c, buf)
+			if err != nil {
+				return nil, err
+			}
+
+			service.Characteristics = append(service.Characteristics, char)
+		}
+
+		db.Services = append(db.Services, service)
+	}
+
+	return db, nil
+}
+
+// Write writes the database as an indented document.
+func (db *Database) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(db)
+}
+
+var (
+	errInvalidUUID     = errors.New("invalid UUID")
+	errCCCD            = errors.New("the Client Characteristic Configuration descriptor is added automatically")
+	errDescriptorFlags = errors.New("descriptors can only be read and written")
+)
+
+func parseUUID(s string) (bluetooth.UUID, error) {
+	if len(s) == 4 {
+		n, err := strconv.ParseUint(s, 16, 16)
+		if err != nil {
+			return bluetooth.UUID{}, errInvalidUUID
+		}
+
+		return bluetooth.New16BitUUID(uint16(n)), nil
+	}
+
+	return bluetooth.ParseUUID(s)
+}
+
+func formatUUID(uuid bluetooth.UUID) string {
+	if uuid.Is16Bit() {
+		return fmt.Sprintf("%04x", uuid.Get16Bit())
+	}
+
+	return uuid.String()
+}
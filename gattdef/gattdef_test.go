@@ -0,0 +1,128 @@
+package gattdef
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tinygo.org/x/bluetooth"
+)
+
+func TestLoad(t *testing.T) {
+	doc := `{
+		"services": [
+			{
+				"uuid": "180f",
+				"characteristics": [
+					{"uuid": "2a19", "flags": ["read", "notify"], "value": "64"}
+				]
+			},
+			{
+				"uuid": "6e400001-b5a3-f393-e0a9-e50e24dcca9e",
+				"characteristics": [
+					{"uuid": "6e400002-b5a3-f393-e0a9-e50e24dcca9e", "flags": ["write", "writeWithoutResponse"]}
+				]
+			}
+		]
+	}`
+
+	services, err := Load(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rx, _ := bluetooth.ParseUUID("6e400002-b5a3-f393-e0a9-e50e24dcca9e")
+	expected := []bluetooth.Service{
+		{
+			UUID: bluetooth.ServiceUUIDBattery,
+			Characteristics: []bluetooth.CharacteristicConfig{
+				{
+					UUID:  bluetooth.CharacteristicUUIDBatteryLevel,
+					Flags: bluetooth.CharacteristicReadPermission | bluetooth.CharacteristicNotifyPermission,
+					Value: []byte{0x64},
+				},
+			},
+		},
+		{
+			UUID: bluetooth.ServiceUUIDNordicUART,
+			Characteristics: []bluetooth.CharacteristicConfig{
+				{
+					UUID:  rx,
+					Flags: bluetooth.CharacteristicWritePermission | bluetooth.CharacteristicWriteWithoutResponsePermission,
+					Value: []byte{},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(services, expected) {
+		t.Errorf("unexpected services:\nexpected: %#v\nactual:   %#v", expected, services)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, doc := range []string{
+		`{"services": [{"uuid": "18"}]}`,
+		`{"services": [{"uuid": "180f", "characteristics": [{"uuid": "2a19", "flags": ["fly"]}]}]}`,
+		`{"services": [{"uuid": "180f", "characteristics": [{"uuid": "2a19", "value": "xyz"}]}]}`,
+		`{"services": [{"uuid": "180f", "characteristics": [{"uuid": "2a19", "descriptors": [{"uuid": "2902"}]}]}]}`,
+		`{"services": [{"uuid": "180f", "characteristics": [{"uuid": "2a19", "descriptors": [{"uuid": "2901", "flags": ["notify"]}]}]}]}`,
+		`{"services": [{"uuid": "180f", "characteristics": [{"uuid": "2a19", "permissions": ["read"]}]}]}`,
+	} {
+		if _, err := Load(strings.NewReader(doc)); err == nil {
+			t.Errorf("expected error for %s", doc)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	db := &Database{
+		Services: []Service{
+			{
+				UUID: formatUUID(bluetooth.ServiceUUIDBattery),
+				Characteristics: []Characteristic{
+					{
+						UUID:  formatUUID(bluetooth.CharacteristicUUIDBatteryLevel),
+						Flags: formatFlags(bluetooth.CharacteristicReadPermission | bluetooth.CharacteristicNotifyPermission),
+						Value: "64",
+						Descriptors: []Descriptor{
+							{UUID: "2901", Flags: []string{"read", "write"}, Value: "42"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := db.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []bluetooth.Service{
+		{
+			UUID: bluetooth.ServiceUUIDBattery,
+			Characteristics: []bluetooth.CharacteristicConfig{
+				{
+					UUID:  bluetooth.CharacteristicUUIDBatteryLevel,
+					Flags: bluetooth.CharacteristicReadPermission | bluetooth.CharacteristicNotifyPermission,
+					Value: []byte{0x64},
+					Descriptors: []bluetooth.DescriptorConfig{
+						{
+							UUID:  bluetooth.New16BitUUID(0x2901),
+							Flags: bluetooth.CharacteristicReadPermission | bluetooth.CharacteristicWritePermission,
+							Value: []byte{0x42},
+						},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(services, expected) {
+		t.Errorf("unexpected services after round trip:\nexpected: %#v\nactual:   %#v", expected, services)
+	}
+}
@@ -1,14 +1,98 @@
 package bluetooth
 
+import (
+	"errors"
+)
+
 // Service is a GATT service to be used in AddService.
 type Service struct {
 	handle uint16
 	UUID
 	Characteristics []CharacteristicConfig
+
+	// Includes lists the services included by this service, which must have
+	// been added before it. Only supported on HCI.
+	Includes []*Service
 }
 
 type WriteEvent = func(client Connection, offset int, value []byte)
 
+// WriteHandler is called when a client writes the value of a characteristic,
+// like WriteEvent, but can reject the write by returning an error, see
+// ATTError.
+type WriteHandler = func(client Connection, offset int, value []byte) error
+
+// ATTError is an ATT error code. A WriteHandler returns it to reject a write
+// with this error.
+type ATTError uint8
+
+// ATT error codes that may be returned by a WriteHandler or an
+// AuthorizeHandler. The codes from ATTErrorApplication to 0x9f are reserved
+// for the application.
+const (
+	ATTErrorWriteNotPermitted           ATTError = 0x03
+	ATTErrorInsufficientAuthentication  ATTError = 0x05
+	ATTErrorInvalidOffset               ATTError = 0x07
+	ATTErrorInsufficientAuthorization   ATTError = 0x08
+	ATTErrorInvalidAttributeValueLength ATTError = 0x0d
+	ATTErrorUnlikely                    ATTError = 0x0e
+	ATTErrorInsufficientEncryption      ATTError = 0x0f
+	ATTErrorApplication                 ATTError = 0x80
+)
+
+func (e ATTError) Error() string {
+	const digits = "0123456789abcdef"
+	return "bluetooth: ATT error 0x" + string([]byte{digits[e>>4], digits[e&0x0f]})
+}
+
+// attErrorCode returns the ATT error code to send for an error returned by a
+// WriteHandler. Errors other than ATTError are sent as Unlikely Error.
+func attErrorCode(err error) ATTError {
+	var e ATTError
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return ATTErrorUnlikely
+}
+
+// SecurityLevel is the security of a connection.
+type SecurityLevel uint8
+
+const (
+	// SecurityNone means the connection is not encrypted.
+	SecurityNone SecurityLevel = iota
+
+	// SecurityEncrypted means the connection is encrypted, with a key that
+	// was not authenticated against a man-in-the-middle attack.
+	SecurityEncrypted
+
+	// SecurityAuthenticated means the connection is encrypted with an
+	// authenticated key.
+	SecurityAuthenticated
+)
+
+// AuthorizeHandler is called before a client reads or, if write is set,
+// writes the value of a characteristic. It can deny the access by returning
+// an error, which is sent as Insufficient Authorization unless it is an
+// ATTError.
+type AuthorizeHandler = func(client Connection, security SecurityLevel, write bool) error
+
+// authorizeErrorCode returns the ATT error code to send for an error returned
+// by an AuthorizeHandler.
+func authorizeErrorCode(err error) ATTError {
+	var e ATTError
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return ATTErrorInsufficientAuthorization
+}
+
+// ReadEvent is called when a client reads the value of a characteristic, and
+// returns the current value.
+type ReadEvent = func(client Connection) []byte
+
 // CharacteristicConfig contains some parameters for the configuration of a
 // single characteristic.
 //
@@ -20,6 +104,38 @@ type CharacteristicConfig struct {
 	Value      []byte
 	Flags      CharacteristicPermissions
 	WriteEvent WriteEvent
+
+	// WriteHandler, if not nil, is called when a client writes the value,
+	// before it is updated, and can reject the write. It is not supported on
+	// the SoftDevice.
+	WriteHandler WriteHandler
+
+	// ReadEvent, if not nil, is called to compute the value when a client
+	// reads it, instead of sending Value. Values longer than the MTU are read
+	// in several parts, and ReadEvent is called for each of them. It is not
+	// supported on the SoftDevice.
+	ReadEvent ReadEvent
+
+	// Authorize, if not nil, is called before each read and write of the
+	// value by a client, whether or not the properties of the characteristic
+	// allow it, and can deny it. Only supported on HCI, which reports
+	// SecurityEncrypted at most as it can't tell whether the key of an
+	// encrypted link was authenticated.
+	Authorize AuthorizeHandler
+
+	// Descriptors lists extra descriptors of the characteristic, such as a
+	// User Description. The Client Characteristic Configuration descriptor is
+	// added automatically and must not be listed. Only supported on HCI.
+	Descriptors []DescriptorConfig
+}
+
+// DescriptorConfig contains the parameters of a descriptor of a local
+// characteristic. Only the Read and Write flags are used, and a descriptor
+// without flags can only be read.
+type DescriptorConfig struct {
+	UUID
+	Value []byte
+	Flags CharacteristicPermissions
 }
 
 // CharacteristicPermissions lists a number of basic permissions/capabilities
@@ -36,6 +152,8 @@ const (
 	CharacteristicWritePermission
 	CharacteristicNotifyPermission
 	CharacteristicIndicatePermission
+	CharacteristicAuthenticatedSignedWritesPermission
+	CharacteristicExtendedPropertiesPermission
 )
 
 // Broadcast returns whether broadcasting of the value is permitted.
@@ -68,3 +186,15 @@ func (p CharacteristicPermissions) Notify() bool {
 func (p CharacteristicPermissions) Indicate() bool {
 	return p&CharacteristicIndicatePermission != 0
 }
+
+// AuthenticatedSignedWrites returns whether writing of the value with Signed
+// Write Command is permitted.
+func (p CharacteristicPermissions) AuthenticatedSignedWrites() bool {
+	return p&CharacteristicAuthenticatedSignedWritesPermission != 0
+}
+
+// ExtendedProperties returns whether the characteristic has additional
+// properties in its Characteristic Extended Properties descriptor.
+func (p CharacteristicPermissions) ExtendedProperties() bool {
+	return p&CharacteristicExtendedPropertiesPermission != 0
+}
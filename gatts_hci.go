@@ -2,28 +2,71 @@
 
 package bluetooth
 
+import (
+	"encoding/binary"
+)
+
 type Characteristic struct {
 	adapter     *Adapter
 	handle      uint16
 	permissions CharacteristicPermissions
 	value       []byte
-	cccd        uint16
+	readEvent   ReadEvent
+
+	writeHandler WriteHandler
+	authorize    AuthorizeHandler
+
+	// CCCD of each connection that enabled notifications or indications
+	subscribers []subscription
+}
+
+type subscription struct {
+	connection uint16
+	cccd       uint16
 }
 
 // AddService creates a new service with the characteristics listed in the
 // Service struct.
 func (a *Adapter) AddService(service *Service) error {
 	uuid := service.UUID.Bytes()
-	serviceHandle := a.att.addLocalAttribute(attributeTypeService, 0, shortUUID(gattServiceUUID).UUID(), 0, uuid[:])
+	serviceHandle, err := a.att.addLocalAttribute(attributeTypeService, 0, shortUUID(gattServiceUUID).UUID(), 0, uuid[:])
+	if err != nil {
+		return err
+	}
+
 	valueHandle := serviceHandle
 	endHandle := serviceHandle
 
+	for _, included := range service.Includes {
+		start, end, ok := a.att.findLocalService(included.handle)
+		if !ok {
+			return errServiceNotFound
+		}
+
+		// add include declaration, with the UUID only if it is a 16-bit UUID
+		var value [6]byte
+		binary.LittleEndian.PutUint16(value[0:], start)
+		binary.LittleEndian.PutUint16(value[2:], end)
+		n := 4
+		if included.UUID.Is16Bit() {
+			binary.LittleEndian.PutUint16(value[4:], included.UUID.Get16Bit())
+			n = 6
+		}
+
+		endHandle, err = a.att.addLocalAttribute(attributeTypeInclude, serviceHandle, shortUUID(gattIncludeUUID).UUID(), CharacteristicReadPermission, value[:n])
+		if err != nil {
+			return err
+		}
+	}
+
 	for i := range service.Characteristics {
 		data := service.Characteristics[i].UUID.Bytes()
-		cuuid := append([]byte{}, data[:]...)
 
 		// add characteristic declaration
-		charHandle := a.att.addLocalAttribute(attributeTypeCharacteristic, serviceHandle, shortUUID(gattCharacteristicUUID).UUID(), CharacteristicReadPermission, cuuid[:])
+		charHandle, err := a.att.addLocalAttribute(attributeTypeCharacteristic, serviceHandle, shortUUID(gattCharacteristicUUID).UUID(), CharacteristicReadPermission, data[:])
+		if err != nil {
+			return err
+		}
 
 		// add characteristic value
 		vf := CharacteristicPermissions(0)
@@ -33,22 +76,47 @@ func (a *Adapter) AddService(service *Service) error {
 		if service.Characteristics[i].Flags.Write() {
 			vf |= CharacteristicWritePermission
 		}
-		valueHandle = a.att.addLocalAttribute(attributeTypeCharacteristicValue, charHandle, service.Characteristics[i].UUID, vf, service.Characteristics[i].Value)
+		valueHandle, err = a.att.addLocalAttribute(attributeTypeCharacteristicValue, charHandle, service.Characteristics[i].UUID, vf, service.Characteristics[i].Value)
+		if err != nil {
+			return err
+		}
 		endHandle = valueHandle
 
 		// add characteristic descriptor
 		if service.Characteristics[i].Flags.Notify() ||
 			service.Characteristics[i].Flags.Indicate() {
-			endHandle = a.att.addLocalAttribute(attributeTypeDescriptor, charHandle, shortUUID(gattClientCharacteristicConfigUUID).UUID(), CharacteristicReadPermission|CharacteristicWritePermission, []byte{0, 0})
+			endHandle, err = a.att.addLocalAttribute(attributeTypeDescriptor, charHandle, shortUUID(gattClientCharacteristicConfigUUID).UUID(), CharacteristicReadPermission|CharacteristicWritePermission, []byte{0, 0})
+			if err != nil {
+				return err
+			}
+		}
+
+		// add other descriptors
+		for _, desc := range service.Characteristics[i].Descriptors {
+			df := desc.Flags & (CharacteristicReadPermission | CharacteristicWritePermission)
+			if df == 0 {
+				df = CharacteristicReadPermission
+			}
+
+			endHandle, err = a.att.addLocalAttribute(attributeTypeDescriptor, charHandle, desc.UUID, df, desc.Value)
+			if err != nil {
+				return err
+			}
 		}
 
 		if service.Characteristics[i].Handle == nil {
+			if a.hci.static {
+				return ErrNoResources
+			}
 			service.Characteristics[i].Handle = &Characteristic{}
 		}
 
 		service.Characteristics[i].Handle.adapter = a
 		service.Characteristics[i].Handle.handle = valueHandle
 		service.Characteristics[i].Handle.permissions = service.Characteristics[i].Flags
+		service.Characteristics[i].Handle.readEvent = service.Characteristics[i].ReadEvent
+		service.Characteristics[i].Handle.writeHandler = service.Characteristics[i].WriteHandler
+		service.Characteristics[i].Handle.authorize = service.Characteristics[i].Authorize
 		if len(service.Characteristics[i].Value) > 0 {
 			service.Characteristics[i].Handle.value = service.Characteristics[i].Value
 		}
@@ -56,6 +124,10 @@ func (a *Adapter) AddService(service *Service) error {
 		if (service.Characteristics[i].Flags.Write() ||
 			service.Characteristics[i].Flags.WriteWithoutResponse()) &&
 			service.Characteristics[i].WriteEvent != nil {
+			if !a.hci.hasRoom(len(a.charWriteHandlers), cap(a.charWriteHandlers)) {
+				return ErrNoResources
+			}
+
 			handlers := append(a.charWriteHandlers, charWriteHandler{
 				handle:   valueHandle,
 				callback: service.Characteristics[i].WriteEvent,
@@ -67,14 +139,124 @@ func (a *Adapter) AddService(service *Service) error {
 			println("added characteristic", charHandle, valueHandle, service.Characteristics[i].UUID.String())
 		}
 
-		a.att.addLocalCharacteristic(charHandle, service.Characteristics[i].Flags, valueHandle, service.Characteristics[i].UUID, service.Characteristics[i].Handle)
+		if err := a.att.addLocalCharacteristic(charHandle, service.Characteristics[i].Flags, valueHandle, service.Characteristics[i].UUID, service.Characteristics[i].Handle); err != nil {
+			return err
+		}
 	}
 
 	if debug {
 		println("added service", serviceHandle, endHandle, service.UUID.String())
 	}
 
-	a.att.addLocalService(serviceHandle, endHandle, service.UUID)
+	if err := a.att.addLocalService(serviceHandle, endHandle, service.UUID); err != nil {
+		return err
+	}
+	service.handle = serviceHandle
+
+	return a.indicateServiceChanged(serviceHandle, endHandle)
+}
+
+// RemoveService removes a service that was added with AddService, so that
+// clients can no longer see it. Connected clients that enabled Service Changed
+// indications are told about the change. The service can be added again later
+// with AddService, which may give it other handles.
+//
+// The handles of the characteristics of the service must not be used after it
+// has been removed. In static allocation mode, the storage of the values of
+// the service is not reclaimed.
+func (a *Adapter) RemoveService(service *Service) error {
+	start, end, ok := a.att.removeLocalService(service.handle)
+	if !ok {
+		return errServiceNotFound
+	}
+	service.handle = 0
+
+	handlers := a.charWriteHandlers[:0]
+	for _, h := range a.charWriteHandlers {
+		if h.handle < start || h.handle > end {
+			handlers = append(handlers, h)
+		}
+	}
+	a.charWriteHandlers = handlers
+
+	if debug {
+		println("removed service", start, end, service.UUID.String())
+	}
+
+	return a.indicateServiceChanged(start, end)
+}
+
+// indicateServiceChanged sends a Service Changed indication for the range of
+// handles to each connected client that enabled the indications, once the
+// generic attribute service has been added. If no connected client has them
+// enabled, the range is kept and sent when a client enables the indications
+// again. As bonds aren't stored, this is also how clients that were
+// disconnected learn about the change.
+func (a *Adapter) indicateServiceChanged(start, end uint16) error {
+	c := &defaultAdvertisement.serviceChanged
+	if c.adapter == nil || !a.serviceChangedSubscribed {
+		// no client has seen the handles yet
+		return nil
+	}
+
+	if a.serviceChangedEnd == 0 {
+		a.serviceChangedStart, a.serviceChangedEnd = start, end
+	} else {
+		if start < a.serviceChangedStart {
+			a.serviceChangedStart = start
+		}
+		if end > a.serviceChangedEnd {
+			a.serviceChangedEnd = end
+		}
+	}
+
+	indicated := false
+	for _, s := range c.subscribers {
+		if s.cccd&0x02 != 0 {
+			indicated = true
+			break
+		}
+	}
+	if !indicated {
+		return nil
+	}
+
+	if err := c.Indicate(a.serviceChangedValue()); err != nil {
+		return err
+	}
+	a.serviceChangedStart, a.serviceChangedEnd = 0, 0
+
+	return nil
+}
+
+// serviceChangedValue returns the value of a Service Changed indication for
+// the range of handles that changed.
+func (a *Adapter) serviceChangedValue() []byte {
+	value := make([]byte, 4)
+	binary.LittleEndian.PutUint16(value[0:], a.serviceChangedStart)
+	binary.LittleEndian.PutUint16(value[2:], a.serviceChangedEnd)
+
+	return value
+}
+
+// cccdWritten is called from the event loop after a client wrote the CCCD of
+// the characteristic. Changes of the local handles that happened while no
+// client was connected are sent when Service Changed indications are enabled,
+// without waiting for the confirmation.
+func (c *Characteristic) cccdWritten(connection uint16) error {
+	if c != &defaultAdvertisement.serviceChanged || c.subscription(connection)&0x02 == 0 {
+		return nil
+	}
+
+	c.adapter.serviceChangedSubscribed = true
+	if c.adapter.serviceChangedEnd == 0 {
+		return nil
+	}
+
+	if err := c.adapter.att.sendIndicationNoWait(connection, c.handle, c.adapter.serviceChangedValue()); err != nil {
+		return err
+	}
+	c.adapter.serviceChangedStart, c.adapter.serviceChangedEnd = 0, 0
 
 	return nil
 }
@@ -91,38 +273,129 @@ func (c *Characteristic) Write(p []byte) (n int, err error) {
 		hdl.callback(Connection(c.handle), 0, p)
 	}
 
-	copy(c.value, p)
+	c.value = append(c.value[:0], p...)
 
-	if c.cccd&0x01 != 0 {
-		// send notification
-		c.adapter.att.sendNotification(c.handle, c.value)
+	for _, s := range c.subscribers {
+		if s.cccd&0x01 != 0 {
+			// send notification
+			c.adapter.att.sendNotificationTo(s.connection, c.handle, c.value)
+		}
 	}
 
 	return len(c.value), nil
 }
 
-func (c *Characteristic) readCCCD() (uint16, error) {
+// NotifyConnection sends a notification with the value to a single client,
+// if notifications are enabled. Unlike Write, the value of the characteristic
+// is left unchanged, so that each client can be sent different data.
+func (c *Characteristic) NotifyConnection(client Connection, p []byte) error {
 	if !c.permissions.Notify() {
+		return errNoNotify
+	}
+
+	if c.subscription(uint16(client))&0x01 == 0 {
+		return nil
+	}
+
+	return c.adapter.att.sendNotificationTo(uint16(client), c.handle, p)
+}
+
+// Indicate replaces the characteristic value with a new value, and sends it
+// as an indication to the clients that enabled indications. It returns once
+// each client has confirmed the indication.
+func (c *Characteristic) Indicate(p []byte) error {
+	if !c.permissions.Indicate() {
+		return errNoIndicate
+	}
+
+	c.value = append(c.value[:0], p...)
+
+	for i := 0; i < len(c.subscribers); i++ {
+		s := c.subscribers[i]
+		if s.cccd&0x02 == 0 {
+			continue
+		}
+
+		// the list may change while waiting for the confirmation
+		if err := c.adapter.att.sendIndicationTo(s.connection, c.handle, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readCCCD returns the CCCD of the characteristic for the connection.
+func (c *Characteristic) readCCCD(connection uint16) (uint16, error) {
+	if !c.permissions.Notify() && !c.permissions.Indicate() {
 		return 0, errNoNotify
 	}
 
-	return c.cccd, nil
+	return c.subscription(connection), nil
 }
 
-func (c *Characteristic) writeCCCD(val uint16) error {
-	if !c.permissions.Notify() {
+// writeCCCD sets the CCCD of the characteristic for the connection.
+func (c *Characteristic) writeCCCD(connection uint16, val uint16) error {
+	if !c.permissions.Notify() && !c.permissions.Indicate() {
 		return errNoNotify
 	}
 
-	c.cccd = val
+	c.removeSubscriber(connection)
+	if val&0x03 != 0 {
+		c.subscribers = append(c.subscribers, subscription{
+			connection: connection,
+			cccd:       val,
+		})
+	}
 
 	return nil
 }
 
-func (c *Characteristic) readValue() ([]byte, error) {
+// subscription returns the CCCD of the characteristic for the connection, or 0
+// if it didn't enable notifications or indications.
+func (c *Characteristic) subscription(connection uint16) uint16 {
+	for _, s := range c.subscribers {
+		if s.connection == connection {
+			return s.cccd
+		}
+	}
+
+	return 0
+}
+
+// Subscribers returns the connected clients that enabled notifications or
+// indications of the characteristic, so that the application can avoid
+// computing values that nobody receives.
+func (c *Characteristic) Subscribers() []Connection {
+	var connections []Connection
+	for _, s := range c.subscribers {
+		connections = append(connections, Connection(s.connection))
+	}
+
+	return connections
+}
+
+// removeSubscriber removes the connection from the subscribers, once it has
+// disabled notifications or has been disconnected.
+func (c *Characteristic) removeSubscriber(connection uint16) {
+	for i, s := range c.subscribers {
+		if s.connection == connection {
+			c.subscribers = append(c.subscribers[:i], c.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// readValue returns the value of the characteristic, as read by a client. It
+// is called from the event loop, so the read event must return quickly.
+func (c *Characteristic) readValue(client Connection) ([]byte, error) {
 	if !c.permissions.Read() {
 		return nil, errNoRead
 	}
 
+	if c.readEvent != nil {
+		return c.readEvent(client), nil
+	}
+
 	return c.value, nil
 }
@@ -50,17 +50,30 @@ func (om *objectManager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map
 type bluezChar struct {
 	props      *prop.Properties
 	writeEvent func(client Connection, offset int, value []byte)
+	readEvent  ReadEvent
+
+	writeHandler WriteHandler
 }
 
 func (c *bluezChar) ReadValue(options map[string]dbus.Variant) ([]byte, *dbus.Error) {
 	// TODO: should we use the offset value? The BlueZ documentation doesn't
 	// clearly specify this. The go-bluetooth library doesn't, but I believe it
 	// should be respected.
+	if c.readEvent != nil {
+		// BlueZ doesn't tell who did the read either.
+		return c.readEvent(Connection(0)), nil
+	}
 	value := c.props.GetMust("org.bluez.GattCharacteristic1", "Value").([]byte)
 	return value, nil
 }
 
 func (c *bluezChar) WriteValue(value []byte, options map[string]dbus.Variant) *dbus.Error {
+	if c.writeHandler != nil {
+		offset, _ := options["offset"].Value().(uint16)
+		if err := c.writeHandler(Connection(0), int(offset), value); err != nil {
+			return attDBusError(attErrorCode(err))
+		}
+	}
 	if c.writeEvent != nil {
 		// BlueZ doesn't seem to tell who did the write, so pass 0 always as the
 		// connection ID.
@@ -71,6 +84,22 @@ func (c *bluezChar) WriteValue(value []byte, options map[string]dbus.Variant) *d
 	return nil
 }
 
+// attDBusError returns the D-Bus error that BlueZ sends to the client as the
+// ATT error code.
+func attDBusError(code ATTError) *dbus.Error {
+	switch code {
+	case ATTErrorWriteNotPermitted:
+		return dbus.NewError("org.bluez.Error.NotPermitted", nil)
+	case ATTErrorInvalidOffset:
+		return dbus.NewError("org.bluez.Error.InvalidOffset", nil)
+	case ATTErrorInvalidAttributeValueLength:
+		return dbus.NewError("org.bluez.Error.InvalidValueLength", nil)
+	}
+
+	// BlueZ sends the application error code given in the message
+	return dbus.NewError("org.bluez.Error.Failed", []interface{}{fmt.Sprintf("0x%02x", uint8(code))})
+}
+
 // AddService creates a new service with the characteristics listed in the
 // Service struct.
 func (a *Adapter) AddService(s *Service) error {
@@ -127,6 +156,9 @@ func (a *Adapter) AddService(s *Service) error {
 		obj := &bluezChar{
 			props:      props,
 			writeEvent: char.WriteEvent,
+			readEvent:  char.ReadEvent,
+
+			writeHandler: char.WriteHandler,
 		}
 		err = a.bus.Export(obj, charPath, "org.bluez.GattCharacteristic1")
 		if err != nil {
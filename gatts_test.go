@@ -0,0 +1,30 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestATTErrorCode(t *testing.T) {
+	if s := (ATTErrorApplication + 1).Error(); s != "bluetooth: ATT error 0x81" {
+		t.Errorf("unexpected error string %q", s)
+	}
+
+	wrapped := fmt.Errorf("bad command: %w", ATTErrorInvalidAttributeValueLength)
+	if code := attErrorCode(wrapped); code != ATTErrorInvalidAttributeValueLength {
+		t.Errorf("expected wrapped code 0x0d, got %#x", uint8(code))
+	}
+
+	if code := attErrorCode(errors.New("other")); code != ATTErrorUnlikely {
+		t.Errorf("expected Unlikely Error for other errors, got %#x", uint8(code))
+	}
+
+	if code := authorizeErrorCode(errors.New("denied")); code != ATTErrorInsufficientAuthorization {
+		t.Errorf("expected Insufficient Authorization for other errors, got %#x", uint8(code))
+	}
+
+	if code := authorizeErrorCode(ATTErrorInsufficientEncryption); code != ATTErrorInsufficientEncryption {
+		t.Errorf("expected Insufficient Encryption, got %#x", uint8(code))
+	}
+}
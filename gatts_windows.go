@@ -19,6 +19,8 @@ import (
 type Characteristic struct {
 	wintCharacteristic *genericattributeprofile.GattLocalCharacteristic
 	writeEvent         WriteEvent
+	readEvent          ReadEvent
+	writeHandler       WriteHandler
 	flags              CharacteristicPermissions
 
 	valueMtx *sync.Mutex
@@ -106,9 +108,23 @@ func (a *Adapter) AddService(s *Service) error {
 			return
 		}
 
+		value := bufferToSlice(buf)
+		if goChar.writeHandler != nil {
+			// TODO: connection?
+			if err := goChar.writeHandler(0, int(offset), value); err != nil {
+				gattWriteRequest.RespondWithProtocolError(uint8(attErrorCode(err)))
+				return
+			}
+
+			option, err := gattWriteRequest.GetOption()
+			if err == nil && option == genericattributeprofile.GattWriteOptionWriteWithResponse {
+				gattWriteRequest.Respond()
+			}
+		}
+
 		if goChar.writeEvent != nil {
 			// TODO: connection?
-			goChar.writeEvent(0, int(offset), bufferToSlice(buf))
+			goChar.writeEvent(0, int(offset), value)
 		}
 	})
 
@@ -154,8 +170,13 @@ func (a *Adapter) AddService(s *Service) error {
 
 		goChar.valueMtx.Lock()
 		defer goChar.valueMtx.Unlock()
-		if len(goChar.value) > 0 {
-			if err = writer.WriteBytes(uint32(len(goChar.value)), goChar.value); err != nil {
+		value := goChar.value
+		if goChar.readEvent != nil {
+			// TODO: connection?
+			value = goChar.readEvent(0)
+		}
+		if len(value) > 0 {
+			if err = writer.WriteBytes(uint32(len(value)), value); err != nil {
 				return
 			}
 		}
@@ -217,6 +238,8 @@ func (a *Adapter) AddService(s *Service) error {
 			char.Handle.valueMtx = &sync.Mutex{}
 			char.Handle.flags = char.Flags
 			char.Handle.writeEvent = char.WriteEvent
+			char.Handle.readEvent = char.ReadEvent
+			char.Handle.writeHandler = char.WriteHandler
 			goChars[uuid] = char.Handle
 		}
 	}
@@ -0,0 +1,13 @@
+//go:build !darwin
+
+package bluetooth
+
+// WriteAll streams the payload p to subscribed centrals, split into chunks
+// that each fit in a single notification with the default MTU. Each chunk is
+// written with Write, so it replaces the value of the characteristic and is
+// notified on its own: once done, the value is the last chunk, not the whole
+// payload. The optional progress callback is called after each chunk with the
+// number of bytes written so far.
+func (c *Characteristic) WriteAll(p []byte, progress func(written, total int)) error {
+	return writeChunks(p, minChunkSize, c.Write, progress)
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,18 +35,40 @@ const (
 	ocfReadRSSI = 0x0005
 
 	// ogfLECtrl
-	ocfLEReadBufferSize           = 0x0002
-	ocfLESetRandomAddress         = 0x0005
-	ocfLESetAdvertisingParameters = 0x0006
-	ocfLESetAdvertisingData       = 0x0008
-	ocfLESetScanResponseData      = 0x0009
-	ocfLESetAdvertiseEnable       = 0x000a
-	ocfLESetScanParameters        = 0x000b
-	ocfLESetScanEnable            = 0x000c
-	ocfLECreateConn               = 0x000d
-	ocfLECancelConn               = 0x000e
-	ocfLEConnUpdate               = 0x0013
-	ocfLEParamRequestReply        = 0x0020
+	ocfLEReadBufferSize             = 0x0002
+	ocfLEReadLocalFeatures          = 0x0003
+	ocfLESetRandomAddress           = 0x0005
+	ocfLESetAdvertisingParameters   = 0x0006
+	ocfLEReadAdvChannelTxPower      = 0x0007
+	ocfLESetAdvertisingData         = 0x0008
+	ocfLESetScanResponseData        = 0x0009
+	ocfLESetAdvertiseEnable         = 0x000a
+	ocfLESetScanParameters          = 0x000b
+	ocfLESetScanEnable              = 0x000c
+	ocfLECreateConn                 = 0x000d
+	ocfLECancelConn                 = 0x000e
+	ocfLEClearFilterAcceptList      = 0x0010
+	ocfLEAddToFilterAcceptList      = 0x0011
+	ocfLERemoveFromFilterAcceptList = 0x0012
+	ocfLEConnUpdate                 = 0x0013
+	ocfLEStartEncryption            = 0x0019
+	ocfLELongTermKeyReply           = 0x001a
+	ocfLELongTermKeyNegReply        = 0x001b
+	ocfLEReadSupportedStates        = 0x001c
+	ocfLEParamRequestReply          = 0x0020
+	ocfLESetAdvSetRandomAddress     = 0x0035
+	ocfLESetExtAdvParameters        = 0x0036
+	ocfLESetExtAdvData              = 0x0037
+	ocfLESetExtScanResponseData     = 0x0038
+	ocfLESetExtAdvEnable            = 0x0039
+	ocfLESetPeriodicAdvParameters   = 0x003e
+	ocfLESetPeriodicAdvData         = 0x003f
+	ocfLESetPeriodicAdvEnable       = 0x0040
+	ocfLESetExtScanParameters       = 0x0041
+	ocfLESetExtScanEnable           = 0x0042
+	ocfLEPeriodicAdvCreateSync      = 0x0044
+	ocfLEPeriodicAdvCancelSync      = 0x0045
+	ocfLEPeriodicAdvTerminateSync   = 0x0046
 
 	leCommandEncrypt                  = 0x0017
 	leCommandRandom                   = 0x0018
@@ -65,6 +89,10 @@ const (
 	leMetaEventGenerateDHKeyComplete          = 0x09
 	leMetaEventEnhancedConnectionComplete     = 0x0A
 	leMetaEventDirectAdvertisingReport        = 0x0B
+	leMetaEventExtendedAdvertisingReport      = 0x0D
+	leMetaEventPeriodicAdvSyncEstablished     = 0x0E
+	leMetaEventPeriodicAdvReport              = 0x0F
+	leMetaEventPeriodicAdvSyncLost            = 0x10
 
 	hciCommandPkt         = 0x01
 	hciACLDataPkt         = 0x02
@@ -82,6 +110,7 @@ const (
 	evtLEMetaEvent      = 0x3e
 
 	hciOEUserEndedConnection = 0x13
+	hciOELowResources        = 0x14
 )
 
 const (
@@ -107,10 +136,73 @@ type leAdvertisingReport struct {
 	numReports, typ, peerBdaddrType uint8
 	peerBdaddr                      [6]uint8
 	eirLength                       uint8
-	eirData                         [31]uint8
+	eirData                         [maxEIRLength]uint8
 	rssi                            int8
+	extended                        bool
+	primaryPHY, secondaryPHY        uint8
+	sid                             uint8
+	timestamp                       time.Time
 }
 
+// isScanResponse returns whether the report is for a scan response, rather than
+// for an advertisement.
+func (r *leAdvertisingReport) isScanResponse() bool {
+	if r.extended {
+		return r.typ&0x08 != 0
+	}
+
+	return r.typ == 0x04
+}
+
+// isScannable returns whether the report is for an advertisement that accepts
+// scan requests.
+func (r *leAdvertisingReport) isScannable() bool {
+	if r.extended {
+		return r.typ&0x02 != 0 && r.typ&0x08 == 0
+	}
+
+	return r.typ == 0x00 || r.typ == 0x02
+}
+
+// advertisementType returns the kind of PDU the report is for.
+func (r *leAdvertisingReport) advertisementType() AdvertisementType {
+	if r.extended {
+		// event type bits: connectable, scannable, directed, scan response
+		switch {
+		case r.typ&0x08 != 0:
+			return AdvertisementTypeScanResponse
+		case r.typ&0x04 != 0:
+			return AdvertisementTypeDirectInd
+		case r.typ&0x01 != 0:
+			return AdvertisementTypeInd
+		case r.typ&0x02 != 0:
+			return AdvertisementTypeScanInd
+		default:
+			return AdvertisementTypeNonConnInd
+		}
+	}
+
+	switch r.typ {
+	case 0x00:
+		return AdvertisementTypeInd
+	case 0x01:
+		return AdvertisementTypeDirectInd
+	case 0x02:
+		return AdvertisementTypeScanInd
+	case 0x03:
+		return AdvertisementTypeNonConnInd
+	case 0x04:
+		return AdvertisementTypeScanResponse
+	}
+
+	return AdvertisementTypeUnknown
+}
+
+// maximum length of the advertising data in a report. Legacy advertising
+// reports carry up to 31 bytes, extended advertising reports up to 229 bytes
+// per event.
+const maxEIRLength = 229
+
 type leConnectData struct {
 	connected      bool
 	status         uint8
@@ -135,23 +227,130 @@ type hci struct {
 	transport         hciTransport
 	att               *att
 	l2cap             *l2cap
+	smp               *smp
 	buf               []byte
+	txbuf             []byte
+	pool              *bufferPool
+	notificationPool  *bufferPool
 	address           [6]byte
 	cmdCompleteOpcode uint16
 	cmdCompleteStatus uint8
 	cmdResponse       []byte
-	scanning          bool
+	cmdResponseBuf    [256]byte
+	scanning          atomic.Bool
 	advData           leAdvertisingReport
+	advReports        *advReportQueue
 	connectData       leConnectData
+	connectWaiter     chan leConnectData
+	connectWaiting    bool
 	maxPkt            uint16
-	pendingPkt        uint16
+
+	// number of ACL data packets sent that the controller hasn't reported as
+	// completed yet. It is incremented by the goroutines that send, and
+	// decremented by the event loop.
+	pendingPkt atomic.Uint32
+
+	// periodic advertising, see periodic_hci.go
+	syncWaiter      chan leSyncData
+	syncWaiting     bool
+	periodicData    periodicReport
+	periodicReports chan periodicReport
+
+	// syncs lost since the report goroutine last woke up on periodicLost
+	periodicLost      chan struct{}
+	periodicLostMu    sync.Mutex
+	periodicLostSyncs []uint16
+
+	// LE features supported by the controller, see readLeLocalFeatures
+	leFeatures uint64
+	leStates   uint64
+
+	// extendedScanning is set while scanning with the extended scan commands
+	extendedScanning bool
+
+	// extendedAdvertising is set when advertising with the extended
+	// advertising commands. Controllers reject the legacy advertising
+	// commands once the extended scan commands have been used, and the
+	// reverse, so they are used whenever the controller supports them.
+	extendedAdvertising bool
+
+	// scanMinRSSI drops advertising reports with a weaker signal during a
+	// scan, unless it is zero.
+	scanMinRSSI int8
+
+	// rxMu serializes polling, so the receive buffer is only used by one
+	// goroutine at a time. txMu does the same for the transmit buffer, and
+	// cmdMu makes sure only one command is waiting for completion at a time.
+	rxMu  sync.Mutex
+	txMu  sync.Mutex
+	cmdMu sync.Mutex
+
+	// commands waiting for the controller, see queueCommand
+	cmdQueue   cmdQueue
+	cmdWaiting uint16
+
+	// poll cadence, see pollWait. These are used by every goroutine that
+	// polls the controller, and set by SetAdaptivePollInterval, in
+	// nanoseconds.
+	pollMin      atomic.Int64
+	pollMax      atomic.Int64
+	pollInterval atomic.Int64
+	pollTraffic  atomic.Bool
+
+	// static is set when all tables have been allocated up front, see
+	// SetResourceLimits.
+	static bool
+
+	// advertising watchdog, see SetAdvertisingWatchdog. The event handlers
+	// can't send commands that wait for a response, so they only record why
+	// advertising has to be restarted.
+	advWatchdog      bool
+	advRestart       bool
+	advRestartReason AdvertisingRestartReason
+
+	// set while an advertisement with RestartOnDisconnect is running
+	advRestartOnDisconnect bool
+
+	// set when a central connected to the advertisement, which is reported
+	// by checkAdvertising
+	advConnected bool
+	advCentral   Address
+
+	// connections in the peripheral role, see SetMaxPeripheralConnections
+	peripheralConnections    []uint16
+	maxPeripheralConnections int
+
+	// own address of the advertisement, which a central connecting to it
+	// uses in the pairing, see smp_hci.go
+	advOwnAddress     [6]byte
+	advOwnAddressType uint8
 }
 
+const defaultPollInterval = 5 * time.Millisecond
+
 func newHCI(t hciTransport) *hci {
-	return &hci{
+	h := &hci{
 		transport: t,
 		buf:       make([]byte, 256),
+		txbuf:     make([]byte, 256),
+		pool:      newBufferPool(poolBufferCount, poolBufferSize),
+
+		notificationPool: newBufferPool(notificationBufferCount, poolBufferSize),
+
+		advReports: newAdvReportQueue(),
+
+		connectWaiter: make(chan leConnectData, 1),
+
+		syncWaiter:      make(chan leSyncData, 1),
+		periodicReports: make(chan periodicReport, periodicReportQueueSize),
+		periodicLost:    make(chan struct{}, 1),
+
+		// the controller can accept one command until it reports otherwise
+		cmdQueue: cmdQueue{credits: 1},
 	}
+	h.setPollInterval(defaultPollInterval, defaultPollInterval)
+
+	return h
 }
 
 func (h *hci) start() error {
@@ -184,7 +383,14 @@ func (h *hci) reset() error {
 	return h.sendCommand(ogfHostCtl<<10 | ocfReset)
 }
 
+// poll reads and processes any data received from the controller. It may be
+// called from any goroutine, calls are serialized. Event handlers that run as
+// part of a poll must not call poll again, so they may only send commands
+// without waiting for a response.
 func (h *hci) poll() error {
+	h.rxMu.Lock()
+	defer h.rxMu.Unlock()
+
 	h.transport.startRead()
 	defer h.transport.endRead()
 
@@ -192,11 +398,14 @@ func (h *hci) poll() error {
 	for h.transport.Buffered() > 0 {
 		sz := h.transport.Buffered()
 		c := sz + 4 - (sz % 4)
-		_, err := h.transport.Read(h.buf[i : i+c])
+		if i+c > len(h.buf) {
+			c = len(h.buf) - i
+		}
+		n, err := h.transport.Read(h.buf[i : i+c])
 		if err != nil {
 			return err
 		}
-		i += sz
+		i += n
 
 		done, err := h.processPacket(i)
 		switch {
@@ -209,6 +418,7 @@ func (h *hci) poll() error {
 		case err != nil:
 			return err
 		case done:
+			h.pollTraffic.Store(true)
 			return nil
 		case i+1 >= len(h.buf):
 			if debug {
@@ -224,6 +434,40 @@ func (h *hci) poll() error {
 	return nil
 }
 
+// setPollInterval sets the range of the interval used by pollWait. If min and
+// max are equal the interval is fixed.
+func (h *hci) setPollInterval(min, max time.Duration) {
+	if max < min {
+		max = min
+	}
+
+	h.pollMin.Store(int64(min))
+	h.pollMax.Store(int64(max))
+	h.pollInterval.Store(int64(min))
+}
+
+// pollWait waits for the next poll. When adaptive polling is enabled, the
+// interval tightens towards the minimum while packets are flowing and backs
+// off towards the maximum while idle.
+func (h *hci) pollWait() {
+	interval := h.pollInterval.Load()
+	switch {
+	case h.pollTraffic.Swap(false):
+		interval /= 2
+		if min := h.pollMin.Load(); interval < min {
+			interval = min
+		}
+	default:
+		interval *= 2
+		if max := h.pollMax.Load(); interval > max {
+			interval = max
+		}
+	}
+	h.pollInterval.Store(interval)
+
+	time.Sleep(time.Duration(interval))
+}
+
 func (h *hci) processPacket(i int) (bool, error) {
 	switch h.buf[0] {
 	case hciACLDataPkt:
@@ -276,11 +520,18 @@ func (h *hci) processPacket(i int) (bool, error) {
 }
 
 func (h *hci) readBdAddr() error {
-	if err := h.sendCommand(ogfInfoParam<<ogfCommandPos | ocfReadBDAddr); err != nil {
+	var rsp [11]byte
+	status, n, err := h.sendCommandWithResponse(ogfInfoParam<<ogfCommandPos|ocfReadBDAddr, nil, rsp[:])
+	if err != nil {
 		return err
 	}
 
-	copy(h.address[:], h.cmdResponse[:7])
+	// skip event length, number of commands, opcode and status
+	if n < 11 || status != 0x00 {
+		return ErrHCIInvalidPacket
+	}
+
+	copy(h.address[:], rsp[5:11])
 
 	return nil
 }
@@ -298,27 +549,164 @@ func (h *hci) setLeEventMask(eventMask uint64) error {
 }
 
 func (h *hci) readLeBufferSize() error {
-	if err := h.sendCommand(ogfLECtrl<<ogfCommandPos | ocfLEReadBufferSize); err != nil {
+	var rsp [8]byte
+	_, n, err := h.sendCommandWithResponse(ogfLECtrl<<ogfCommandPos|ocfLEReadBufferSize, nil, rsp[:])
+	if err != nil {
 		return err
 	}
 
-	pktLen := binary.LittleEndian.Uint16(h.buf[0:])
-	h.maxPkt = uint16(h.buf[2])
+	if n < 8 {
+		return ErrHCIInvalidPacket
+	}
+
+	// skip event length, number of commands, opcode and status
+	pktLen := binary.LittleEndian.Uint16(rsp[5:])
+	h.maxPkt = uint16(rsp[7])
 
 	// pkt len must be at least 27 bytes
 	if pktLen < 27 {
 		pktLen = 27
 	}
 
-	if err := h.att.setMaxMTU(pktLen); err != nil {
+	// ATT PDUs are not fragmented, so they must fit in a single ACL packet
+	// together with the L2CAP header.
+	if err := h.att.setMaxMTU(pktLen - 4); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LE features, see readLeLocalFeatures
+const (
+	leFeatureCodedPHY            = 1 << 11
+	leFeatureExtendedAdvertising = 1 << 12
+	leFeaturePeriodicAdvertising = 1 << 13
+)
+
+// readLeLocalFeatures reads the LE features supported by the controller.
+// Controllers that don't know the command are assumed to support no optional
+// features.
+func (h *hci) readLeLocalFeatures() error {
+	var rsp [13]byte
+	status, n, err := h.sendCommandWithResponse(ogfLECtrl<<ogfCommandPos|ocfLEReadLocalFeatures, nil, rsp[:])
+	if err != nil {
 		return err
 	}
 
+	// skip event length, number of commands and opcode
+	if n < 13 || status != 0x00 {
+		h.leFeatures = 0
+		return nil
+	}
+
+	h.leFeatures = binary.LittleEndian.Uint64(rsp[5:])
+
+	return nil
+}
+
+// LE states, see readLeSupportedStates
+const (
+	leStateNonConnAdvPeripheral = 1 << 20
+	leStateScanAdvPeripheral    = 1 << 21
+	leStateConnAdvPeripheral    = 1 << 38
+)
+
+// readLeSupportedStates reads the combinations of states supported by the
+// controller. Controllers that don't know the command are assumed to support
+// no combinations.
+func (h *hci) readLeSupportedStates() error {
+	var rsp [13]byte
+	status, n, err := h.sendCommandWithResponse(ogfLECtrl<<ogfCommandPos|ocfLEReadSupportedStates, nil, rsp[:])
+	if err != nil {
+		return err
+	}
+
+	// skip event length, number of commands and opcode
+	if n < 13 || status != 0x00 {
+		h.leStates = 0
+		return nil
+	}
+
+	h.leStates = binary.LittleEndian.Uint64(rsp[5:])
+
+	return nil
+}
+
+// readRSSI reads the RSSI of the connection, in dBm.
+func (h *hci) readRSSI(handle uint16) (int8, error) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], handle)
+	var rsp [8]byte
+	status, n, err := h.sendCommandWithResponse(ogfStatusParam<<ogfCommandPos|ocfReadRSSI, b[:], rsp[:])
+	if err != nil {
+		return 0, err
+	}
+
+	// skip event length, number of commands, opcode, status and handle
+	if n < 8 || status != 0x00 {
+		return 0, ErrReadRSSI
+	}
+
+	// 127 means that the RSSI can't be read
+	rssi := int8(rsp[7])
+	if rssi == 127 {
+		return 0, ErrReadRSSI
+	}
+
+	return rssi, nil
+}
+
+// hasCredits returns whether the controller has a free ACL data buffer, or
+// did not report its number of buffers.
+func (h *hci) hasCredits() bool {
+	return h.maxPkt == 0 || h.pendingPkt.Load() < uint32(h.maxPkt)
+}
+
+// completePackets releases the buffers of n packets that the controller
+// reported as completed, and returns the number of packets still pending.
+func (h *hci) completePackets(n uint16) uint32 {
+	for {
+		pending := h.pendingPkt.Load()
+		left := uint32(0)
+		if n > 0 && pending > uint32(n) {
+			left = pending - uint32(n)
+		}
+
+		if h.pendingPkt.CompareAndSwap(pending, left) {
+			return left
+		}
+	}
+}
+
+// waitForCredits waits until the controller has a free ACL data buffer, as
+// reported by the Number Of Completed Packets events. If the controller did
+// not report its number of buffers, it returns immediately.
+func (h *hci) waitForCredits() error {
+	if h.maxPkt == 0 {
+		return nil
+	}
+
+	start := time.Now().UnixNano()
+	for !h.hasCredits() {
+		if err := h.poll(); err != nil {
+			return err
+		}
+
+		if (time.Now().UnixNano()-start)/int64(time.Second) > 3 {
+			return ErrHCITimeout
+		}
+	}
+
 	return nil
 }
 
 func (h *hci) leSetScanEnable(enabled, duplicates bool) error {
-	h.scanning = enabled
+	h.scanning.Store(enabled)
+
+	if h.extendedScanning {
+		return h.leSetExtScanEnable(enabled, duplicates)
+	}
 
 	var data [2]byte
 	if enabled {
@@ -342,7 +730,44 @@ func (h *hci) leSetScanParameters(typ uint8, interval, window uint16, ownBdaddrT
 	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLESetScanParameters, data[:])
 }
 
+// leSetExtScanParameters sets the parameters of an extended scan. The PHYs must
+// be the 1M and the Coded PHY, in this order.
+func (h *hci) leSetExtScanParameters(typ, ownBdaddrType, filter uint8, phys []ScanPHY) error {
+	var data [13]byte
+	data[0] = ownBdaddrType
+	data[1] = filter
+
+	n := 3
+	for _, p := range phys {
+		data[2] |= 1 << (p.PHY - 1)
+		data[n] = typ
+		binary.LittleEndian.PutUint16(data[n+1:], uint16(p.Interval))
+		binary.LittleEndian.PutUint16(data[n+3:], uint16(p.Window))
+		n += 5
+	}
+
+	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLESetExtScanParameters, data[:n])
+}
+
+// leSetExtScanEnable enables or disables an extended scan, which runs until it
+// is disabled.
+func (h *hci) leSetExtScanEnable(enabled, duplicates bool) error {
+	var data [6]byte
+	if enabled {
+		data[0] = 1
+	}
+	if duplicates {
+		data[1] = 1
+	}
+
+	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLESetExtScanEnable, data[:])
+}
+
 func (h *hci) leSetAdvertiseEnable(enabled bool) error {
+	if h.extendedAdvertising {
+		return h.leSetExtAdvEnable(advHandle, enabled)
+	}
+
 	var data [1]byte
 	if enabled {
 		data[0] = 1
@@ -369,7 +794,28 @@ func (h *hci) leSetAdvertisingParameters(minInterval, maxInterval uint16,
 	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLESetAdvertisingParameters, b[:])
 }
 
+// leReadAdvChannelTxPower reads the transmit power of legacy advertising
+// packets in dBm.
+func (h *hci) leReadAdvChannelTxPower() (int8, error) {
+	var rsp [6]byte
+	status, n, err := h.sendCommandWithResponse(ogfLECtrl<<ogfCommandPos|ocfLEReadAdvChannelTxPower, nil, rsp[:])
+	if err != nil {
+		return 0, err
+	}
+
+	// skip event length, number of commands, opcode and status
+	if n < 6 || status != 0x00 {
+		return 0, ErrHCIInvalidPacket
+	}
+
+	return int8(rsp[5]), nil
+}
+
 func (h *hci) leSetAdvertisingData(data []byte) error {
+	if h.extendedAdvertising {
+		return h.leSetExtAdvData(advHandle, ocfLESetExtAdvData, data)
+	}
+
 	var b [32]byte
 	b[0] = byte(len(data))
 	copy(b[1:], data)
@@ -378,6 +824,10 @@ func (h *hci) leSetAdvertisingData(data []byte) error {
 }
 
 func (h *hci) leSetScanResponseData(data []byte) error {
+	if h.extendedAdvertising {
+		return h.leSetExtAdvData(advHandle, ocfLESetExtScanResponseData, data)
+	}
+
 	var b [32]byte
 	b[0] = byte(len(data))
 	copy(b[1:], data)
@@ -423,7 +873,31 @@ func (h *hci) leConnUpdate(handle uint16, minInterval, maxInterval,
 	binary.LittleEndian.PutUint16(b[10:], 0x0004)
 	binary.LittleEndian.PutUint16(b[12:], 0x0006)
 
-	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLEConnUpdate, b[:])
+	// the controller only answers with a command status, so don't wait for
+	// it. This also allows it to be called from an event handler.
+	return h.sendWithoutResponse(ogfLECtrl<<ogfCommandPos|ocfLEConnUpdate, b[:])
+}
+
+// leStartEncryption starts the encryption of a connection as central with the
+// key, which is a short term key with a zero random number and diversifier.
+func (h *hci) leStartEncryption(handle uint16, ltk [16]byte) error {
+	var b [28]byte
+	binary.LittleEndian.PutUint16(b[0:], handle)
+	copy(b[12:], ltk[:])
+
+	// only answered with a command status, and called from an event handler
+	return h.sendWithoutResponse(ogfLECtrl<<ogfCommandPos|ocfLEStartEncryption, b[:])
+}
+
+// removePeripheralConnection forgets the connection if it was in the
+// peripheral role.
+func (h *hci) removePeripheralConnection(handle uint16) {
+	for i, c := range h.peripheralConnections {
+		if c == handle {
+			h.peripheralConnections = append(h.peripheralConnections[:i], h.peripheralConnections[i+1:]...)
+			return
+		}
+	}
 }
 
 func (h *hci) disconnect(handle uint16) error {
@@ -439,34 +913,72 @@ func (h *hci) sendCommand(opcode uint16) error {
 }
 
 func (h *hci) sendCommandWithParams(opcode uint16, params []byte) error {
+	_, _, err := h.sendCommandWithResponse(opcode, params, nil)
+	return err
+}
+
+// sendCommandWithResponse sends a command and waits for it to complete. It
+// returns the status of the command, and copies as much of the response as
+// fits into response. They are copied before the next command can be sent,
+// as it overwrites them.
+func (h *hci) sendCommandWithResponse(opcode uint16, params, response []byte) (status uint8, n int, err error) {
 	if debug {
 		println("hci send command", opcode, hex.EncodeToString(params))
 	}
 
-	h.buf[0] = hciCommandPkt
-	binary.LittleEndian.PutUint16(h.buf[1:], opcode)
-	h.buf[3] = byte(len(params))
-	copy(h.buf[4:], params)
+	h.cmdMu.Lock()
+	defer h.cmdMu.Unlock()
 
-	if _, err := h.write(h.buf[:4+len(params)]); err != nil {
-		return err
+	// wait until the controller can accept the command, and until the commands
+	// queued before it have been sent.
+	start := time.Now().UnixNano()
+	for {
+		ok, err := h.reserveCommand()
+		if err != nil {
+			return 0, 0, err
+		}
+		if ok {
+			break
+		}
+
+		if err := h.poll(); err != nil {
+			return 0, 0, err
+		}
+
+		if (time.Now().UnixNano()-start)/int64(time.Second) > 3 {
+			return 0, 0, ErrHCITimeout
+		}
 	}
+	defer func() {
+		if rerr := h.releaseCommand(); err == nil {
+			err = rerr
+		}
+	}()
 
+	// reset before sending, the response may be received by another goroutine
+	// polling the controller.
+	h.cmdWaiting = opcode
 	h.cmdCompleteOpcode = 0xffff
 	h.cmdCompleteStatus = 0xff
 
-	start := time.Now().UnixNano()
+	if err := h.writeCommand(opcode, params); err != nil {
+		return 0, 0, err
+	}
+
 	for h.cmdCompleteOpcode != opcode {
 		if err := h.poll(); err != nil {
-			return err
+			return 0, 0, err
 		}
 
 		if (time.Now().UnixNano()-start)/int64(time.Second) > 3 {
-			return ErrHCITimeout
+			// the command is lost, don't wait for the controller to return
+			// its slot.
+			h.setCommandCredits(1)
+			return 0, 0, ErrHCITimeout
 		}
 	}
 
-	return nil
+	return h.cmdCompleteStatus, copy(response, h.cmdResponse), nil
 }
 
 func (h *hci) sendWithoutResponse(opcode uint16, params []byte) error {
@@ -474,39 +986,50 @@ func (h *hci) sendWithoutResponse(opcode uint16, params []byte) error {
 		println("hci send without response command", opcode, hex.EncodeToString(params))
 	}
 
-	h.buf[0] = hciCommandPkt
-	binary.LittleEndian.PutUint16(h.buf[1:], opcode)
-	h.buf[3] = byte(len(params))
-	copy(h.buf[4:], params)
+	return h.queueCommand(opcode, params)
+}
+
+func (h *hci) writeCommand(opcode uint16, params []byte) error {
+	h.txMu.Lock()
+	defer h.txMu.Unlock()
 
-	if _, err := h.write(h.buf[:4+len(params)]); err != nil {
+	h.txbuf[0] = hciCommandPkt
+	binary.LittleEndian.PutUint16(h.txbuf[1:], opcode)
+	h.txbuf[3] = byte(len(params))
+	copy(h.txbuf[4:], params)
+
+	if _, err := h.write(h.txbuf[:4+len(params)]); err != nil {
 		return err
 	}
 
-	h.cmdCompleteOpcode = 0xffff
-	h.cmdCompleteStatus = 0xff
-
 	return nil
 }
 
 func (h *hci) sendAclPkt(handle uint16, cid uint8, data []byte) error {
-	h.buf[0] = hciACLDataPkt
-	binary.LittleEndian.PutUint16(h.buf[1:], handle)
-	binary.LittleEndian.PutUint16(h.buf[3:], uint16(len(data)+4))
-	binary.LittleEndian.PutUint16(h.buf[5:], uint16(len(data)))
-	binary.LittleEndian.PutUint16(h.buf[7:], uint16(cid))
+	if 9+len(data) > len(h.txbuf) {
+		return ErrHCIPDUTooLarge
+	}
+
+	h.txMu.Lock()
+	defer h.txMu.Unlock()
 
-	copy(h.buf[9:], data)
+	h.txbuf[0] = hciACLDataPkt
+	binary.LittleEndian.PutUint16(h.txbuf[1:], handle)
+	binary.LittleEndian.PutUint16(h.txbuf[3:], uint16(len(data)+4))
+	binary.LittleEndian.PutUint16(h.txbuf[5:], uint16(len(data)))
+	binary.LittleEndian.PutUint16(h.txbuf[7:], uint16(cid))
+
+	copy(h.txbuf[9:], data)
 
 	if debug {
-		println("hci send acl data", handle, cid, hex.EncodeToString(h.buf[:9+len(data)]))
+		println("hci send acl data", handle, cid, hex.EncodeToString(h.txbuf[:9+len(data)]))
 	}
 
-	if _, err := h.write(h.buf[:9+len(data)]); err != nil {
+	if _, err := h.write(h.txbuf[:9+len(data)]); err != nil {
 		return err
 	}
 
-	h.pendingPkt++
+	h.pendingPkt.Add(1)
 
 	return nil
 }
@@ -553,6 +1076,9 @@ func (h *hci) handleACLData(buf []byte) error {
 
 		return h.l2cap.handleData(aclHdr.handle&0x0fff, buf[8:aclHdr.len+8])
 
+	case securityCID:
+		return h.smp.handleData(aclHdr.handle&0x0fff, buf[8:aclHdr.len+8])
+
 	default:
 		if debug {
 			println("unknown acl data cid", aclHdr.cid)
@@ -575,6 +1101,13 @@ func (h *hci) handleEventData(buf []byte) error {
 		handle := binary.LittleEndian.Uint16(buf[3:])
 		h.att.removeConnection(handle)
 		h.l2cap.removeConnection(handle)
+		h.smp.removeConnection(handle)
+		h.removePeripheralConnection(handle)
+
+		if h.advWatchdog || h.advRestartOnDisconnect {
+			h.requestAdvertisingRestart(AdvertisingRestartDisconnected)
+			return nil
+		}
 
 		return h.leSetAdvertiseEnable(true)
 
@@ -583,29 +1116,56 @@ func (h *hci) handleEventData(buf []byte) error {
 			println("evtEncryptionChange")
 		}
 
+		handle := binary.LittleEndian.Uint16(buf[3:])
+		encrypted := buf[2] == 0x00 && buf[5] != 0x00
+		if cd, err := h.att.findConnectionData(handle); err == nil {
+			cd.encrypted = encrypted
+		}
+		h.smp.encryptionChanged(handle, encrypted)
+
 	case evtCmdComplete:
-		h.cmdCompleteOpcode = binary.LittleEndian.Uint16(buf[3:])
+		opcode := binary.LittleEndian.Uint16(buf[3:])
+		if debug {
+			println("evtCmdComplete", opcode, buf[5])
+		}
+
+		if err := h.setCommandCredits(buf[2]); err != nil {
+			return err
+		}
+
+		if opcode != h.cmdWaiting {
+			// completion of a command sent without waiting for it
+			return nil
+		}
+
+		h.cmdCompleteOpcode = opcode
 		h.cmdCompleteStatus = buf[5]
 		if plen > 0 {
-			h.cmdResponse = buf[1 : plen+2]
+			// copy, as the receive buffer is reused by the next poll
+			h.cmdResponse = append(h.cmdResponseBuf[:0], buf[1:plen+2]...)
 		} else {
-			h.cmdResponse = buf[:0]
-		}
-
-		if debug {
-			println("evtCmdComplete", h.cmdCompleteOpcode, h.cmdCompleteStatus)
+			h.cmdResponse = h.cmdResponseBuf[:0]
 		}
 
 		return nil
 
 	case evtCmdStatus:
-		h.cmdCompleteStatus = buf[2]
-		h.cmdCompleteOpcode = binary.LittleEndian.Uint16(buf[4:])
+		opcode := binary.LittleEndian.Uint16(buf[4:])
 		if debug {
-			println("evtCmdStatus", h.cmdCompleteOpcode, h.cmdCompleteOpcode, h.cmdCompleteStatus)
+			println("evtCmdStatus", opcode, buf[2])
+		}
+
+		if err := h.setCommandCredits(buf[3]); err != nil {
+			return err
 		}
 
-		h.cmdResponse = buf[:0]
+		if opcode != h.cmdWaiting {
+			return nil
+		}
+
+		h.cmdCompleteStatus = buf[2]
+		h.cmdCompleteOpcode = opcode
+		h.cmdResponse = h.cmdResponseBuf[:0]
 
 		return nil
 
@@ -621,14 +1181,10 @@ func (h *hci) handleEventData(buf []byte) error {
 			pkts += binary.LittleEndian.Uint16(buf[5+i*4:])
 		}
 
-		if pkts > 0 && h.pendingPkt > pkts {
-			h.pendingPkt -= pkts
-		} else {
-			h.pendingPkt = 0
-		}
+		pending := h.completePackets(pkts)
 
 		if debug {
-			println("evtNumCompPkts", pkts, h.pendingPkt)
+			println("evtNumCompPkts", pkts, pending)
 		}
 
 		return nil
@@ -660,12 +1216,62 @@ func (h *hci) handleEventData(buf []byte) error {
 				h.connectData.timeout = binary.LittleEndian.Uint16(buf[28:])
 			}
 
-			h.att.addConnection(h.connectData.handle)
+			if h.connectWaiting && h.connectData.role == 0x00 {
+				// wake up the pending Connect call
+				h.connectWaiting = false
+				select {
+				case h.connectWaiter <- h.connectData:
+				default:
+				}
+			}
+
+			if h.connectData.status != 0x00 {
+				// connection attempt failed or was cancelled
+				return nil
+			}
+
+			if err := h.att.addConnection(h.connectData.handle); err != nil {
+				if debug {
+					println("could not add connection:", err.Error())
+				}
+			}
 			if err := h.l2cap.addConnection(h.connectData.handle, h.connectData.role,
 				h.connectData.interval, h.connectData.timeout); err != nil {
 				return err
 			}
 
+			ownAddressType, ownAddress := uint8(0x00), h.address
+			if h.connectData.role == 0x01 && h.advOwnAddressType != 0x00 {
+				ownAddressType, ownAddress = h.advOwnAddressType, h.advOwnAddress
+			}
+			h.smp.addConnection(h.connectData.handle, h.connectData.role, ownAddressType, ownAddress,
+				h.connectData.peerBdaddrType, h.connectData.peerBdaddr)
+
+			if h.connectData.role != 0x01 {
+				// a connection as central doesn't stop advertising
+				return nil
+			}
+
+			if h.maxPeripheralConnections > 0 &&
+				len(h.peripheralConnections) >= h.maxPeripheralConnections {
+				// advertising was still connectable when the limit was
+				// reached, refuse the connection
+				var b [3]byte
+				binary.LittleEndian.PutUint16(b[0:], h.connectData.handle)
+				b[2] = hciOELowResources
+
+				return h.sendWithoutResponse(ogfLinkCtl<<ogfCommandPos|ocfDisconnect, b[:])
+			}
+			h.peripheralConnections = append(h.peripheralConnections, h.connectData.handle)
+
+			h.advConnected = true
+			h.advCentral = Address{
+				MACAddress{
+					MAC:      makeAddress(h.connectData.peerBdaddr),
+					isRandom: h.connectData.peerBdaddrType&0x01 != 0,
+				},
+			}
+
 			return h.leSetAdvertiseEnable(false)
 
 		case leMetaEventAdvertisingReport:
@@ -676,6 +1282,8 @@ func (h *hci) handleEventData(buf []byte) error {
 			copy(h.advData.peerBdaddr[0:], buf[6:])
 			h.advData.eirLength = buf[12]
 			h.advData.rssi = 0
+			h.advData.primaryPHY = 0x01 // legacy advertising only uses the 1M PHY
+			h.advData.sid = 0xff        // no advertising set
 			if debug {
 				println("leMetaEventAdvertisingReport", plen, h.advData.numReports,
 					h.advData.typ, h.advData.peerBdaddrType, h.advData.eirLength)
@@ -694,13 +1302,34 @@ func (h *hci) handleEventData(buf []byte) error {
 				h.advData.rssi = int8(buf[int(13+h.advData.eirLength)])
 			}
 
+			h.reportAdvData()
+			h.clearAdvData()
+
 			return nil
 
+		case leMetaEventExtendedAdvertisingReport:
+			return h.handleExtendedAdvertisingReport(buf)
+
+		case leMetaEventPeriodicAdvSyncEstablished:
+			return h.handleSyncEstablished(buf)
+
+		case leMetaEventPeriodicAdvReport:
+			return h.handlePeriodicReport(buf)
+
+		case leMetaEventPeriodicAdvSyncLost:
+			return h.handleSyncLost(buf)
+
 		case leMetaEventLongTermKeyRequest:
 			if debug {
 				println("leMetaEventLongTermKeyRequest")
 			}
 
+			handle := binary.LittleEndian.Uint16(buf[3:])
+			random := binary.LittleEndian.Uint64(buf[5:])
+			ediv := binary.LittleEndian.Uint16(buf[13:])
+
+			return h.smp.longTermKeyRequest(handle, random, ediv)
+
 		case leMetaEventRemoteConnParamReq:
 			if debug {
 				println("leMetaEventRemoteConnParamReq")
@@ -756,12 +1385,90 @@ func (h *hci) handleEventData(buf []byte) error {
 			println("evtHardwareError", hex.EncodeToString(buf))
 		}
 
+		if h.advWatchdog {
+			h.requestAdvertisingRestart(AdvertisingRestartControllerReset)
+			return nil
+		}
+
 		return ErrHCIUnknownEvent
 	}
 
 	return nil
 }
 
+// handleExtendedAdvertisingReport handles an LE Extended Advertising Report
+// event. Advertising data that the controller delivers in several fragments is
+// collected in advData until it is complete, and then queued like a legacy
+// report. Data that doesn't fit in a report is truncated.
+func (h *hci) handleExtendedAdvertisingReport(buf []byte) error {
+	// TODO: handle multiple reports
+	if len(buf) < 28 {
+		return ErrHCIInvalidPacket
+	}
+
+	eventType := binary.LittleEndian.Uint16(buf[4:])
+	peerBdaddrType := buf[6]
+	var peerBdaddr [6]uint8
+	copy(peerBdaddr[:], buf[7:13])
+
+	dataLength := int(buf[27])
+	if 28+dataLength > len(buf) {
+		if debug {
+			println("invalid packet length", dataLength, len(buf))
+		}
+		return ErrHCIInvalidPacket
+	}
+
+	if h.advData.reported && (h.advData.peerBdaddr != peerBdaddr || h.advData.peerBdaddrType != peerBdaddrType) {
+		// the rest of the previous advertisement did not arrive
+		h.clearAdvData()
+	}
+
+	h.advData.reported = true
+	h.advData.numReports = buf[3]
+	h.advData.typ = uint8(eventType)
+	h.advData.extended = true
+	h.advData.peerBdaddrType = peerBdaddrType
+	h.advData.peerBdaddr = peerBdaddr
+	h.advData.primaryPHY = buf[13]
+	h.advData.secondaryPHY = buf[14]
+	h.advData.sid = buf[15]
+	h.advData.rssi = int8(buf[17])
+
+	n := copy(h.advData.eirData[h.advData.eirLength:], buf[28:28+dataLength])
+	h.advData.eirLength += uint8(n)
+
+	if debug {
+		println("leMetaEventExtendedAdvertisingReport", eventType, h.advData.peerBdaddrType, h.advData.eirLength)
+	}
+
+	// data status: incomplete, more data to come
+	if (eventType>>5)&0x03 == 0x01 {
+		return nil
+	}
+
+	h.reportAdvData()
+	h.clearAdvData()
+
+	return nil
+}
+
+// reportAdvData queues the complete report in advData for the scan, unless it
+// is below the RSSI threshold of the scan.
+func (h *hci) reportAdvData() {
+	if !h.scanning.Load() {
+		return
+	}
+
+	// 127 means that the RSSI is not available
+	if h.scanMinRSSI != 0 && h.advData.rssi < h.scanMinRSSI && h.advData.rssi != 127 {
+		return
+	}
+
+	h.advData.timestamp = time.Now()
+	h.advReports.push(&h.advData)
+}
+
 func (h *hci) clearAdvData() error {
 	h.advData.reported = false
 	h.advData.numReports = 0
@@ -769,12 +1476,36 @@ func (h *hci) clearAdvData() error {
 	h.advData.peerBdaddrType = 0
 	h.advData.peerBdaddr = [6]uint8{}
 	h.advData.eirLength = 0
-	h.advData.eirData = [31]uint8{}
+	h.advData.eirData = [maxEIRLength]uint8{}
 	h.advData.rssi = 0
+	h.advData.extended = false
+	h.advData.primaryPHY = 0
+	h.advData.secondaryPHY = 0
+	h.advData.sid = 0
+	h.advData.timestamp = time.Time{}
 
 	return nil
 }
 
+// waitForConnect registers a waiter that is woken up directly by the next LE
+// Connection Complete event for a connection in the central role.
+func (h *hci) waitForConnect() <-chan leConnectData {
+	// drain any stale event from a previous attempt
+	select {
+	case <-h.connectWaiter:
+	default:
+	}
+
+	h.connectWaiting = true
+
+	return h.connectWaiter
+}
+
+// stopWaitingForConnect unregisters the waiter registered by waitForConnect.
+func (h *hci) stopWaitingForConnect() {
+	h.connectWaiting = false
+}
+
 func (h *hci) clearConnectData() error {
 	h.connectData.connected = false
 	h.connectData.status = 0
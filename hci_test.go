@@ -0,0 +1,61 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// fakeTransport is a controller that answers commands with captured events.
+type fakeTransport struct {
+	responses map[uint16][]byte
+	rx        []byte
+}
+
+func (t *fakeTransport) startRead() {}
+func (t *fakeTransport) endRead()   {}
+
+func (t *fakeTransport) Buffered() int {
+	return len(t.rx)
+}
+
+func (t *fakeTransport) ReadByte() (byte, error) {
+	b := t.rx[0]
+	t.rx = t.rx[1:]
+	return b, nil
+}
+
+func (t *fakeTransport) Read(buf []byte) (int, error) {
+	n := copy(buf, t.rx)
+	t.rx = t.rx[n:]
+	return n, nil
+}
+
+func (t *fakeTransport) Write(buf []byte) (int, error) {
+	if buf[0] == hciCommandPkt {
+		t.rx = append(t.rx, t.responses[binary.LittleEndian.Uint16(buf[1:])]...)
+	}
+	return len(buf), nil
+}
+
+func TestReadBdAddr(t *testing.T) {
+	// Command Complete event of Read BD_ADDR, captured from a controller
+	// with the address 11:22:33:44:55:66
+	h := newHCI(&fakeTransport{
+		responses: map[uint16][]byte{
+			ogfInfoParam<<ogfCommandPos | ocfReadBDAddr: {
+				0x04, 0x0e, 0x0a, 0x01, 0x09, 0x10, 0x00,
+				0x66, 0x55, 0x44, 0x33, 0x22, 0x11,
+			},
+		},
+	})
+
+	if err := h.readBdAddr(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := makeAddress(h.address).String(); s != "11:22:33:44:55:66" {
+		t.Errorf("expected address 11:22:33:44:55:66, got %s", s)
+	}
+}
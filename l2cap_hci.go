@@ -5,6 +5,7 @@ package bluetooth
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"time"
 )
 
 const (
@@ -55,6 +56,15 @@ func (l *l2capConnectionParamResponsePkt) Read(p []byte) (int, error) {
 
 type l2cap struct {
 	hci *hci
+
+	// identifier of the last signaling request that was sent
+	identifier uint8
+
+	// state of the connection parameter update request that is waiting for
+	// its response, see connectionParamUpdateReq
+	paramUpdateIdentifier uint8
+	paramUpdateResponded  bool
+	paramUpdateResult     uint16
 }
 
 func newL2CAP(hci *hci) *l2cap {
@@ -68,18 +78,65 @@ func (l *l2cap) addConnection(handle uint16, role uint8, interval, timeout uint1
 		return nil
 	}
 
+	return l.sendParamUpdateReq(handle, l.nextIdentifier(), interval, interval, 0, timeout)
+}
+
+// nextIdentifier returns the identifier of a new signaling request, which
+// can't be 0.
+func (l *l2cap) nextIdentifier() uint8 {
+	l.identifier++
+	if l.identifier == 0 {
+		l.identifier = 1
+	}
+
+	return l.identifier
+}
+
+// sendParamUpdateReq sends a Connection Parameter Update request to the
+// central. The intervals are in units of 1.25ms and the timeout in units of
+// 10ms.
+func (l *l2cap) sendParamUpdateReq(handle uint16, identifier uint8, minInterval, maxInterval, latency, timeout uint16) error {
 	var b [12]byte
 	b[0] = connectionParamUpdateRequest
-	b[1] = 0x01
+	b[1] = identifier
 	binary.LittleEndian.PutUint16(b[2:], 8)
-	binary.LittleEndian.PutUint16(b[4:], interval)
-	binary.LittleEndian.PutUint16(b[6:], interval)
-	binary.LittleEndian.PutUint16(b[8:], 0)
+	binary.LittleEndian.PutUint16(b[4:], minInterval)
+	binary.LittleEndian.PutUint16(b[6:], maxInterval)
+	binary.LittleEndian.PutUint16(b[8:], latency)
 	binary.LittleEndian.PutUint16(b[10:], timeout)
 
 	return l.sendReq(handle, b[:])
 }
 
+// connectionParamUpdateReq asks the central to change the parameters of the
+// connection, and waits for its answer. It returns whether the central
+// accepted them.
+func (l *l2cap) connectionParamUpdateReq(handle, minInterval, maxInterval, latency, timeout uint16, wait time.Duration) (bool, error) {
+	l.paramUpdateIdentifier = l.nextIdentifier()
+	l.paramUpdateResponded = false
+
+	if err := l.sendParamUpdateReq(handle, l.paramUpdateIdentifier, minInterval, maxInterval, latency, timeout); err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	for !l.paramUpdateResponded {
+		if err := l.hci.poll(); err != nil && err != ErrATTOp {
+			return false, err
+		}
+
+		if time.Since(start) > wait {
+			return false, ErrTimeout
+		}
+
+		if !l.paramUpdateResponded {
+			l.hci.pollWait()
+		}
+	}
+
+	return l.paramUpdateResult == 0, nil
+}
+
 func (l *l2cap) removeConnection(handle uint16) error {
 	return nil
 }
@@ -143,7 +200,11 @@ func (l *l2cap) handleParameterUpdateResponse(connectionHandle uint16, identifie
 		println("l2cap.handleParameterUpdateResponse:", connectionHandle, "data:", hex.EncodeToString(data))
 	}
 
-	// for now do nothing
+	if identifier == l.paramUpdateIdentifier && len(data) >= 2 {
+		l.paramUpdateResult = binary.LittleEndian.Uint16(data)
+		l.paramUpdateResponded = true
+	}
+
 	return nil
 }
 
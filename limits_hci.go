@@ -0,0 +1,120 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import "errors"
+
+var (
+	ErrNoResources = errors.New("bluetooth: out of resources")
+)
+
+// ResourceLimits sets the size of the tables used by the HCI stack when
+// static allocation is enabled using SetResourceLimits.
+type ResourceLimits struct {
+	// Connections is the number of simultaneous connections.
+	Connections int
+
+	// NotificationsPerConnection is the number of characteristics that can
+	// have notifications enabled on each connection.
+	NotificationsPerConnection int
+
+	// Services, Characteristics and Attributes set the size of the local
+	// attribute table. Note that every characteristic uses two or three
+	// attributes, and every service one more.
+	Services        int
+	Characteristics int
+	Attributes      int
+
+	// AttributeValueSize is the total number of bytes available to store the
+	// initial values of the local attributes.
+	AttributeValueSize int
+
+	// Buffers is the number of packet buffers in the buffer pool. If zero, the
+	// default number of buffers is used.
+	Buffers int
+
+	// NotificationBuffers is the number of buffers for received notifications
+	// waiting for their callback. If zero, the default number of buffers is
+	// used.
+	NotificationBuffers int
+}
+
+// SetResourceLimits enables static allocation: all buffers, connection slots,
+// attribute tables and registrations are allocated with the given sizes when
+// the adapter is enabled, and operations that would need to grow one of them
+// afterwards fail with ErrNoResources instead of allocating. This makes memory
+// use deterministic on boards with little RAM.
+//
+// Local characteristics must have their Handle set before being added using
+// AddService, as allocating one is not allowed in this mode. Results of scans
+// and service discovery are returned to the caller and are not covered by the
+// limits.
+//
+// It must be called before Enable.
+func (a *hciAdapter) SetResourceLimits(limits ResourceLimits) {
+	a.limits = &limits
+}
+
+// allocateResources allocates all tables up front as configured by
+// SetResourceLimits.
+func (a *hciAdapter) allocateResources() {
+	l := a.limits
+	if l.Buffers > 0 {
+		a.hci.pool = newBufferPool(l.Buffers, poolBufferSize)
+	}
+	if l.NotificationBuffers > 0 {
+		a.hci.notificationPool = newBufferPool(l.NotificationBuffers, poolBufferSize)
+	}
+
+	a.connectedDevices = make([]Device, 0, l.Connections)
+	a.deviceSlots = make([]deviceInternal, l.Connections)
+	for i := range a.deviceSlots {
+		a.deviceSlots[i].notificationRegistrations = make([]notificationRegistration, 0, l.NotificationsPerConnection)
+	}
+	a.charWriteHandlers = make([]charWriteHandler, 0, l.Characteristics)
+
+	a.att.allocate(l)
+	a.hci.static = true
+}
+
+// newDeviceInternal returns the per-connection state for a new connection,
+// taken from the preallocated slots in static allocation mode.
+func (a *hciAdapter) newDeviceInternal() (*deviceInternal, error) {
+	if !a.hci.static {
+		return &deviceInternal{
+			notificationRegistrations: make([]notificationRegistration, 0),
+		}, nil
+	}
+
+	for i := range a.deviceSlots {
+		if !a.deviceSlots[i].used {
+			d := &a.deviceSlots[i]
+			d.used = true
+			d.serviceChangedEnabled = false
+			d.notificationRegistrations = d.notificationRegistrations[:0]
+			return d, nil
+		}
+	}
+
+	return nil, ErrNoResources
+}
+
+// allocate creates the attribute tables and connection slots with a fixed
+// capacity.
+func (a *att) allocate(l *ResourceLimits) {
+	a.attributes = make([]rawAttribute, 0, l.Attributes)
+	a.localServices = make([]rawService, 0, l.Services)
+	a.localCharacteristics = make([]rawCharacteristic, 0, l.Characteristics)
+	a.values = make([]byte, 0, l.AttributeValueSize)
+
+	a.connections = make([]uint16, 0, l.Connections)
+	a.connectionSlots = make([]connectData, l.Connections)
+	a.connectionsData = make(map[uint16]*connectData, l.Connections)
+}
+
+// hasRoom returns whether a table with the given length and capacity can get
+// another element without allocating. Outside of static allocation mode, tables
+// grow as needed.
+func (h *hci) hasRoom(length, capacity int) bool {
+	return !h.static || length < capacity
+}
@@ -0,0 +1,192 @@
+// Package metrics counts Bluetooth activity of an application and exposes the
+// counters in the Prometheus text format, for observability of BLE gateways
+// and other host programs.
+//
+// The adapters don't keep statistics themselves, so the counters are updated
+// by wrapping the calls and callbacks to be observed:
+//
+//	m := metrics.New()
+//	http.Handle("/metrics", m)
+//	adapter.SetConnectHandler(m.ConnectHandler(onConnect))
+//	adapter.Scan(m.ScanCallback(onScanResult))
+//	device, err := m.Connect(adapter, address, params)
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// Metrics holds the counters. It is safe for concurrent use, and implements
+// http.Handler to serve the counters to a Prometheus server.
+type Metrics struct {
+	mu          sync.Mutex
+	scanResults uint64
+	connects    uint64
+	disconnects uint64
+	connected   int64
+	errors      map[errorKey]uint64
+}
+
+type errorKey struct {
+	op     string
+	reason string
+}
+
+// New returns a new set of counters.
+func New() *Metrics {
+	return &Metrics{
+		errors: make(map[errorKey]uint64),
+	}
+}
+
+// ScanCallback wraps a scan callback to count the scan results.
+func (m *Metrics) ScanCallback(callback func(*bluetooth.Adapter, bluetooth.ScanResult)) func(*bluetooth.Adapter, bluetooth.ScanResult) {
+	return func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+		m.mu.Lock()
+		m.scanResults++
+		m.mu.Unlock()
+
+		callback(adapter, result)
+	}
+}
+
+// ConnectHandler wraps a connect handler to count the connections and
+// disconnections, including those initiated by the remote device or caused by
+// a supervision timeout. The callback may be nil.
+func (m *Metrics) ConnectHandler(callback func(device bluetooth.Device, connected bool)) func(device bluetooth.Device, connected bool) {
+	return func(device bluetooth.Device, connected bool) {
+		m.mu.Lock()
+		if connected {
+			m.connects++
+			m.connected++
+		} else {
+			m.disconnects++
+			m.connected--
+		}
+		m.mu.Unlock()
+
+		if callback != nil {
+			callback(device, connected)
+		}
+	}
+}
+
+// Connect connects to a device like Adapter.Connect, and counts the error.
+// The connection itself is counted by ConnectHandler.
+func (m *Metrics) Connect(adapter *bluetooth.Adapter, address bluetooth.Address, params bluetooth.ConnectionParams) (bluetooth.Device, error) {
+	device, err := adapter.Connect(address, params)
+	if err != nil {
+		m.Error("connect", err)
+	}
+
+	return device, err
+}
+
+// Disconnect disconnects from a device like Device.Disconnect, and counts the
+// error. The disconnection itself is counted by ConnectHandler.
+func (m *Metrics) Disconnect(device bluetooth.Device) error {
+	err := device.Disconnect()
+	if err != nil {
+		m.Error("disconnect", err)
+	}
+
+	return err
+}
+
+// Error counts an error of the given operation, such as "read" or "write". To
+// keep the number of series bounded, the error is counted under one of the
+// reasons "timeout", "canceled", "att" for ATT errors returned by the remote
+// device, or "other".
+func (m *Metrics) Error(op string, err error) {
+	m.mu.Lock()
+	m.errors[errorKey{op, errorReason(err)}]++
+	m.mu.Unlock()
+}
+
+// errorReason maps an error to one of a fixed set of reasons, see Error.
+func errorReason(err error) string {
+	var attErr bluetooth.ATTError
+	switch {
+	case errors.Is(err, bluetooth.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &attErr):
+		return "att"
+	default:
+		return "other"
+	}
+}
+
+// ServeHTTP serves the counters in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the counters in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+
+	metric(cw, "bluetooth_scan_results_total", "counter", "Number of scan results received.", m.scanResults)
+	metric(cw, "bluetooth_connects_total", "counter", "Number of connections established.", m.connects)
+	metric(cw, "bluetooth_disconnects_total", "counter", "Number of connections closed.", m.disconnects)
+	metric(cw, "bluetooth_connections", "gauge", "Number of open connections.", m.connected)
+
+	keys := make([]errorKey, 0, len(m.errors))
+	for k := range m.errors {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].op != keys[j].op {
+			return keys[i].op < keys[j].op
+		}
+		return keys[i].reason < keys[j].reason
+	})
+
+	fmt.Fprintf(cw, "# HELP bluetooth_errors_total Number of errors by operation and reason.\n")
+	fmt.Fprintf(cw, "# TYPE bluetooth_errors_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(cw, "bluetooth_errors_total{op=\"%s\",reason=\"%s\"} %d\n", labelEscaper.Replace(k.op), labelEscaper.Replace(k.reason), m.errors[k])
+	}
+
+	return cw.n, cw.err
+}
+
+// labelEscaper escapes label values as required by the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func metric(w io.Writer, name, typ, help string, value any) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, typ, name, value)
+}
+
+// countingWriter counts the bytes written and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+
+	return n, err
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"tinygo.org/x/bluetooth"
+)
+
+func TestWriteTo(t *testing.T) {
+	m := New()
+
+	callback := m.ScanCallback(func(*bluetooth.Adapter, bluetooth.ScanResult) {})
+	callback(nil, bluetooth.ScanResult{})
+	callback(nil, bluetooth.ScanResult{})
+
+	handler := m.ConnectHandler(nil)
+	handler(bluetooth.Device{}, true)
+	handler(bluetooth.Device{}, true)
+	handler(bluetooth.Device{}, false)
+
+	m.Error("read", bluetooth.ErrTimeout)
+	m.Error("read", fmt.Errorf("read: %w", bluetooth.ErrTimeout))
+	m.Error("write", bluetooth.ATTErrorWriteNotPermitted)
+	m.Error("connect", errors.New(`bad "address"`))
+	m.Error("connect", errors.New("another message"))
+
+	var sb strings.Builder
+	if _, err := m.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"bluetooth_scan_results_total 2\n",
+		"bluetooth_connects_total 2\n",
+		"bluetooth_disconnects_total 1\n",
+		"bluetooth_connections 1\n",
+		`bluetooth_errors_total{op="connect",reason="other"} 2` + "\n",
+		`bluetooth_errors_total{op="read",reason="timeout"} 2` + "\n",
+		`bluetooth_errors_total{op="write",reason="att"} 1` + "\n",
+	} {
+		if !strings.Contains(sb.String(), line) {
+			t.Errorf("missing %q in output:\n%s", line, sb.String())
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package nrfsniffer
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// link type of packets captured by the nRF Sniffer, see
+// https://www.tcpdump.org/linktypes.html
+const linkTypeNordicBLE = 272
+
+// PcapWriter writes captured packets to a pcap file.
+type PcapWriter struct {
+	w       io.Writer
+	boardID uint8
+}
+
+// NewPcapWriter writes the pcap file header to w and returns a writer for the
+// packets. The board ID distinguishes the captures of several sniffers in
+// the same file.
+func NewPcapWriter(w io.Writer, boardID uint8) (*PcapWriter, error) {
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4) // magic
+	binary.LittleEndian.PutUint16(header[4:], 2)          // major version
+	binary.LittleEndian.PutUint16(header[6:], 4)          // minor version
+	binary.LittleEndian.PutUint32(header[16:], 65535)     // snapshot length
+	binary.LittleEndian.PutUint32(header[20:], linkTypeNordicBLE)
+
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+
+	return &PcapWriter{
+		w:       w,
+		boardID: boardID,
+	}, nil
+}
+
+// WritePacket writes a packet received from the sniffer. The record contains
+// the board ID followed by the packet, including the sniffer header, as the
+// Wireshark dissector for the link type expects.
+func (w *PcapWriter) WritePacket(p Packet) error {
+	var header [17]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(p.Time.Unix()))
+	binary.LittleEndian.PutUint32(header[4:], uint32(p.Time.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(p.Raw)+1))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(p.Raw)+1))
+	header[16] = w.boardID
+
+	if _, err := w.w.Write(header[:]); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(p.Raw)
+
+	return err
+}
@@ -0,0 +1,228 @@
+// Package nrfsniffer talks to a board running the Nordic nRF Sniffer for
+// Bluetooth LE firmware over its UART protocol, and writes the captured
+// link-layer packets to a pcap file that Wireshark can open.
+//
+// The serial port is not opened by this package: pass any io.ReadWriter that
+// is connected to the sniffer board, configured as the firmware expects
+// (1000000 baud for recent firmware versions).
+//
+// The pcap records are timestamped with the host clock when they are
+// received, so they can be correlated with other logs of the same host.
+package nrfsniffer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"time"
+)
+
+// SLIP framing bytes used by the sniffer firmware.
+const (
+	slipStart     = 0xab
+	slipEnd       = 0xbc
+	slipEsc       = 0xcd
+	slipEscStart  = 0xac
+	slipEscEnd    = 0xbd
+	slipEscEscape = 0xce
+)
+
+// Packet IDs of the sniffer protocol.
+const (
+	reqFollow          = 0x00
+	eventFollow        = 0x01
+	eventPacketAdvPDU  = 0x02
+	eventConnect       = 0x05
+	eventPacketDataPDU = 0x06
+	reqScanCont        = 0x07
+	eventDisconnect    = 0x09
+	pingReq            = 0x0d
+	pingResp           = 0x0e
+)
+
+const (
+	headerLength    = 6
+	protocolVersion = 2
+
+	// maximum size of a packet, after removing the SLIP framing.
+	maxPacketSize = 512
+)
+
+var (
+	ErrPacketTooLarge = errors.New("nrfsniffer: packet too large")
+	ErrInvalidPacket  = errors.New("nrfsniffer: invalid packet")
+)
+
+// Packet is a packet received from the sniffer.
+type Packet struct {
+	// Time at which the packet was received by the host.
+	Time time.Time
+
+	// Raw packet as sent by the sniffer, including the sniffer header.
+	Raw []byte
+}
+
+// ID returns the packet ID from the sniffer header.
+func (p Packet) ID() uint8 {
+	return p.Raw[5]
+}
+
+// IsLinkLayer returns whether the packet is a captured link-layer packet, as
+// opposed to a status or reply of the sniffer itself.
+func (p Packet) IsLinkLayer() bool {
+	return p.ID() == eventPacketAdvPDU || p.ID() == eventPacketDataPDU
+}
+
+// Sniffer is a connection to a sniffer board.
+type Sniffer struct {
+	r       *bufio.Reader
+	w       io.Writer
+	counter uint16
+	buf     [maxPacketSize]byte
+}
+
+// New returns a sniffer that communicates over rw.
+func New(rw io.ReadWriter) *Sniffer {
+	return &Sniffer{
+		r: bufio.NewReader(rw),
+		w: rw,
+	}
+}
+
+// Scan makes the sniffer capture advertising packets of all devices.
+func (s *Sniffer) Scan() error {
+	return s.send(reqScanCont, nil)
+}
+
+// Follow makes the sniffer follow a single device, including the connections
+// it takes part in.
+func (s *Sniffer) Follow(address [6]byte, random bool) error {
+	var payload [8]byte
+	copy(payload[:6], address[:])
+	if random {
+		payload[6] = 1
+	}
+
+	return s.send(reqFollow, payload[:])
+}
+
+// Ping asks the sniffer to respond with a ping response packet, to check it
+// is alive.
+func (s *Sniffer) Ping() error {
+	return s.send(pingReq, nil)
+}
+
+// send sends a request to the sniffer.
+func (s *Sniffer) send(id uint8, payload []byte) error {
+	s.counter++
+
+	packet := make([]byte, 0, headerLength+len(payload))
+	packet = append(packet, headerLength, byte(len(payload)), protocolVersion,
+		byte(s.counter), byte(s.counter>>8), id)
+	packet = append(packet, payload...)
+
+	_, err := s.w.Write(slipEncode(packet))
+
+	return err
+}
+
+// Read reads the next packet from the sniffer.
+func (s *Sniffer) Read() (Packet, error) {
+	// wait for the start of a packet
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return Packet{}, err
+		}
+
+		if c == slipStart {
+			break
+		}
+	}
+
+	n := 0
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return Packet{}, err
+		}
+
+		switch c {
+		case slipEnd:
+			if n < headerLength {
+				return Packet{}, ErrInvalidPacket
+			}
+
+			raw := make([]byte, n)
+			copy(raw, s.buf[:n])
+
+			return Packet{Time: time.Now(), Raw: raw}, nil
+
+		case slipEsc:
+			c, err = s.r.ReadByte()
+			if err != nil {
+				return Packet{}, err
+			}
+
+			switch c {
+			case slipEscStart:
+				c = slipStart
+			case slipEscEnd:
+				c = slipEnd
+			case slipEscEscape:
+				c = slipEsc
+			default:
+				return Packet{}, ErrInvalidPacket
+			}
+		}
+
+		if n == len(s.buf) {
+			return Packet{}, ErrPacketTooLarge
+		}
+
+		s.buf[n] = c
+		n++
+	}
+}
+
+// Capture reads packets from the sniffer and writes the link-layer packets to
+// w, until reading fails.
+func (s *Sniffer) Capture(w *PcapWriter) error {
+	for {
+		p, err := s.Read()
+		if err == ErrInvalidPacket {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !p.IsLinkLayer() {
+			continue
+		}
+
+		if err := w.WritePacket(p); err != nil {
+			return err
+		}
+	}
+}
+
+// slipEncode returns the packet with SLIP framing.
+func slipEncode(packet []byte) []byte {
+	b := make([]byte, 0, len(packet)+2)
+	b = append(b, slipStart)
+	for _, c := range packet {
+		switch c {
+		case slipStart:
+			b = append(b, slipEsc, slipEscStart)
+		case slipEnd:
+			b = append(b, slipEsc, slipEscEnd)
+		case slipEsc:
+			b = append(b, slipEsc, slipEscEscape)
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return append(b, slipEnd)
+}
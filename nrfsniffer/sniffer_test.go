@@ -0,0 +1,75 @@
+package nrfsniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+type loopback struct {
+	bytes.Buffer
+}
+
+func TestReadWrite(t *testing.T) {
+	var rw loopback
+	s := New(&rw)
+
+	// the payload contains all special bytes, so they have to be escaped
+	if err := s.Follow([6]byte{slipStart, slipEnd, slipEsc, 4, 5, 6}, true); err != nil {
+		t.Fatal(err)
+	}
+	rw.Write([]byte{0x00, 0x11}) // garbage before the next packet
+	if err := s.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{headerLength, 8, protocolVersion, 1, 0, reqFollow, slipStart, slipEnd, slipEsc, 4, 5, 6, 1, 0}
+	if !bytes.Equal(p.Raw, expected) {
+		t.Errorf("unexpected packet:\nexpected: %x\nactual:   %x", expected, p.Raw)
+	}
+
+	p, err = s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID() != pingReq || p.IsLinkLayer() {
+		t.Errorf("unexpected packet: %x", p.Raw)
+	}
+
+	if _, err := s.Read(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestPcapWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewPcapWriter(&buf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := []byte{headerLength, 2, protocolVersion, 1, 0, eventPacketAdvPDU, 0xaa, 0xbb}
+	if err := w.WritePacket(Packet{Time: time.Unix(10, 5000), Raw: raw}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if len(b) != 24+16+1+len(raw) {
+		t.Fatalf("unexpected length %d", len(b))
+	}
+	if binary.LittleEndian.Uint32(b[20:]) != linkTypeNordicBLE {
+		t.Errorf("unexpected link type %d", binary.LittleEndian.Uint32(b[20:]))
+	}
+	if binary.LittleEndian.Uint32(b[24:]) != 10 || binary.LittleEndian.Uint32(b[28:]) != 5 {
+		t.Errorf("unexpected timestamp %x", b[24:32])
+	}
+	if b[40] != 3 || !bytes.Equal(b[41:], raw) {
+		t.Errorf("unexpected record %x", b[40:])
+	}
+}
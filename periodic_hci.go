@@ -0,0 +1,387 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// number of periodic advertising reports that can wait for their callback.
+const periodicReportQueueSize = 4
+
+// time to wait for the controller to confirm that a sync attempt has been
+// cancelled.
+const syncCancelTimeout = time.Second
+
+var (
+	ErrPeriodicSync = errors.New("bluetooth: could not synchronize with periodic advertising")
+)
+
+// leSyncData is the content of an LE Periodic Advertising Sync Established
+// event.
+type leSyncData struct {
+	status uint8
+	handle uint16
+}
+
+// periodicReport is a periodic advertising report.
+type periodicReport struct {
+	handle  uint16
+	txPower int8
+	rssi    int8
+	len     uint8
+	data    [maxEIRLength]byte
+}
+
+// PeriodicAdvertisingReport is the data of one periodic advertising event.
+type PeriodicAdvertisingReport struct {
+	// Transmit power in dBm, or 127 if the advertiser doesn't send it.
+	TxPower int8
+
+	// Signal strength of the advertisement.
+	RSSI int16
+
+	// Advertising data. It is only valid during the callback. Data that
+	// doesn't fit in a single report is truncated.
+	Data []byte
+}
+
+// PeriodicAdvertisingSync is a synchronization with a periodic advertiser.
+type PeriodicAdvertisingSync struct {
+	adapter  *Adapter
+	handle   uint16
+	callback func(PeriodicAdvertisingReport)
+	lost     chan struct{}
+}
+
+// SyncPeriodicAdvertising synchronizes with the periodic advertising of the
+// advertising set sid of a device, as found in the AdvertisingSID of its scan
+// results. The controller only synchronizes while scanning, so a scan must be
+// running until this call returns. It waits until the sync is established or
+// the context is done.
+//
+// The callback is called with each report from a dedicated goroutine. The sync
+// is lost if no report is received for the sync timeout, which must be between
+// 100ms and 163.84s.
+func (a *Adapter) SyncPeriodicAdvertising(ctx context.Context, address Address, sid uint8, syncTimeout time.Duration, callback func(PeriodicAdvertisingReport)) (*PeriodicAdvertisingSync, error) {
+	waiter := a.hci.waitForSync()
+	defer a.hci.stopWaitingForSync()
+
+	random := uint8(0)
+	if address.isRandom {
+		random = 1
+	}
+
+	// the sync timeout is in units of 10ms
+	if err := a.hci.lePeriodicAdvCreateSync(sid, random, makeNINAAddress(address.MAC),
+		uint16(syncTimeout/(10*time.Millisecond))); err != nil {
+		return nil, err
+	}
+
+	a.startPeriodicReports()
+
+	var timeout <-chan time.Time
+	done := ctx.Done()
+	for {
+		select {
+		case sd := <-waiter:
+			if sd.status != 0x00 {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, ErrPeriodicSync
+			}
+
+			if ctx.Err() != nil {
+				// established just before the caller gave up on it
+				a.hci.lePeriodicAdvTerminateSync(sd.handle)
+				return nil, ctx.Err()
+			}
+
+			s := &PeriodicAdvertisingSync{
+				adapter:  a,
+				handle:   sd.handle,
+				callback: callback,
+				lost:     make(chan struct{}),
+			}
+			a.periodicMu.Lock()
+			a.periodicSyncs = append(a.periodicSyncs, s)
+			a.periodicMu.Unlock()
+
+			return s, nil
+
+		case <-done:
+			// stop selecting on the closed channel
+			done = nil
+
+			if err := a.hci.lePeriodicAdvCancelSync(); err != nil {
+				return nil, err
+			}
+
+			// the controller confirms with a sync established event
+			timer := time.NewTimer(syncCancelTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+
+		case <-timeout:
+			// the controller never confirmed the cancellation
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Terminate ends the sync and closes Lost. The callback isn't called anymore
+// once Lost is closed. It doesn't wait for the callback, so it may be called
+// from it.
+func (s *PeriodicAdvertisingSync) Terminate() error {
+	if err := s.adapter.hci.lePeriodicAdvTerminateSync(s.handle); err != nil {
+		return err
+	}
+
+	if s.adapter.removePeriodicSync(s) {
+		close(s.lost)
+	}
+
+	return nil
+}
+
+// Lost returns a channel that is closed when the sync has been lost or
+// terminated.
+func (s *PeriodicAdvertisingSync) Lost() <-chan struct{} {
+	return s.lost
+}
+
+// startPeriodicReports starts the goroutine that calls the callbacks of the
+// syncs, and the event loop, unless they are already running.
+func (a *hciAdapter) startPeriodicReports() {
+	a.startEventLoop()
+
+	if a.periodicReportsStarted {
+		return
+	}
+	a.periodicReportsStarted = true
+
+	go func() {
+		for {
+			select {
+			case report := <-a.hci.periodicReports:
+				s := a.findPeriodicSync(report.handle, false)
+				if s != nil && s.callback != nil {
+					s.callback(PeriodicAdvertisingReport{
+						TxPower: report.txPower,
+						RSSI:    int16(report.rssi),
+						Data:    report.data[:report.len],
+					})
+				}
+
+			case <-a.hci.periodicLost:
+				for {
+					handle, ok := a.hci.nextLostSync()
+					if !ok {
+						break
+					}
+
+					// unless it was terminated in the meantime
+					if s := a.findPeriodicSync(handle, true); s != nil {
+						close(s.lost)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// findPeriodicSync returns the sync with the given handle, and removes it from
+// the list if remove is set.
+func (a *hciAdapter) findPeriodicSync(handle uint16, remove bool) *PeriodicAdvertisingSync {
+	a.periodicMu.Lock()
+	defer a.periodicMu.Unlock()
+
+	for i, s := range a.periodicSyncs {
+		if s.handle == handle {
+			if remove {
+				a.periodicSyncs = append(a.periodicSyncs[:i], a.periodicSyncs[i+1:]...)
+			}
+			return s
+		}
+	}
+
+	return nil
+}
+
+// removePeriodicSync removes the sync from the list, and returns whether it
+// was still there. Whoever removes a sync closes its Lost channel.
+func (a *hciAdapter) removePeriodicSync(sync *PeriodicAdvertisingSync) bool {
+	a.periodicMu.Lock()
+	defer a.periodicMu.Unlock()
+
+	for i, s := range a.periodicSyncs {
+		if s == sync {
+			a.periodicSyncs = append(a.periodicSyncs[:i], a.periodicSyncs[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *hci) lePeriodicAdvCreateSync(sid, peerBdaddrType uint8, peerBdaddr [6]byte, syncTimeout uint16) error {
+	var b [14]byte
+	b[0] = 0x00 // options: use the given advertiser, reporting enabled
+	b[1] = sid
+	b[2] = peerBdaddrType
+	copy(b[3:], peerBdaddr[:])
+	binary.LittleEndian.PutUint16(b[9:], 0) // skip
+	binary.LittleEndian.PutUint16(b[11:], syncTimeout)
+	b[13] = 0x00 // sync to packets with and without CTE
+
+	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLEPeriodicAdvCreateSync, b[:])
+}
+
+func (h *hci) lePeriodicAdvCancelSync() error {
+	return h.sendCommand(ogfLECtrl<<ogfCommandPos | ocfLEPeriodicAdvCancelSync)
+}
+
+func (h *hci) lePeriodicAdvTerminateSync(handle uint16) error {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], handle)
+
+	return h.sendCommandWithParams(ogfLECtrl<<ogfCommandPos|ocfLEPeriodicAdvTerminateSync, b[:])
+}
+
+// waitForSync registers a waiter that is woken up by the next LE Periodic
+// Advertising Sync Established event.
+func (h *hci) waitForSync() <-chan leSyncData {
+	// drain any stale event from a previous attempt
+	select {
+	case <-h.syncWaiter:
+	default:
+	}
+
+	h.syncWaiting = true
+
+	return h.syncWaiter
+}
+
+// stopWaitingForSync unregisters the waiter registered by waitForSync.
+func (h *hci) stopWaitingForSync() {
+	h.syncWaiting = false
+}
+
+func (h *hci) handleSyncEstablished(buf []byte) error {
+	if len(buf) < 6 {
+		return ErrHCIInvalidPacket
+	}
+
+	sd := leSyncData{
+		status: buf[3],
+		handle: binary.LittleEndian.Uint16(buf[4:]),
+	}
+
+	if debug {
+		println("leMetaEventPeriodicAdvSyncEstablished", sd.status, sd.handle)
+	}
+
+	if h.syncWaiting {
+		h.syncWaiting = false
+		select {
+		case h.syncWaiter <- sd:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// handlePeriodicReport collects the data of a periodic advertising report in
+// periodicData until it is complete, and then queues it for the callback.
+func (h *hci) handlePeriodicReport(buf []byte) error {
+	if len(buf) < 10 {
+		return ErrHCIInvalidPacket
+	}
+
+	handle := binary.LittleEndian.Uint16(buf[3:])
+	dataStatus := buf[8]
+	dataLength := int(buf[9])
+	if 10+dataLength > len(buf) {
+		return ErrHCIInvalidPacket
+	}
+
+	if h.periodicData.handle != handle {
+		// the rest of the previous report did not arrive
+		h.periodicData.len = 0
+	}
+
+	h.periodicData.handle = handle
+	h.periodicData.txPower = int8(buf[5])
+	h.periodicData.rssi = int8(buf[6])
+	n := copy(h.periodicData.data[h.periodicData.len:], buf[10:10+dataLength])
+	h.periodicData.len += uint8(n)
+
+	if debug {
+		println("leMetaEventPeriodicAdvReport", handle, dataStatus, h.periodicData.len)
+	}
+
+	switch dataStatus {
+	case 0x01:
+		// incomplete, more data to come
+		return nil
+	case 0x00:
+		select {
+		case h.periodicReports <- h.periodicData:
+		default:
+			if debug {
+				println("periodic advertising report dropped")
+			}
+		}
+	}
+
+	// complete, or truncated by the controller and dropped
+	h.periodicData.len = 0
+
+	return nil
+}
+
+func (h *hci) handleSyncLost(buf []byte) error {
+	if len(buf) < 5 {
+		return ErrHCIInvalidPacket
+	}
+
+	handle := binary.LittleEndian.Uint16(buf[3:])
+	if debug {
+		println("leMetaEventPeriodicAdvSyncLost", handle)
+	}
+
+	// unlike reports, the loss of a sync must not be dropped, so it is kept
+	// in a list that the report goroutine is woken up to empty
+	h.periodicLostMu.Lock()
+	h.periodicLostSyncs = append(h.periodicLostSyncs, handle)
+	h.periodicLostMu.Unlock()
+
+	select {
+	case h.periodicLost <- struct{}{}:
+	default:
+		// already woken up
+	}
+
+	return nil
+}
+
+// nextLostSync returns the handle of a sync that has been lost, if any, and
+// removes it from the list.
+func (h *hci) nextLostSync() (uint16, bool) {
+	h.periodicLostMu.Lock()
+	defer h.periodicLostMu.Unlock()
+
+	if len(h.periodicLostSyncs) == 0 {
+		return 0, false
+	}
+
+	handle := h.periodicLostSyncs[0]
+	h.periodicLostSyncs = append(h.periodicLostSyncs[:0], h.periodicLostSyncs[1:]...)
+
+	return handle, true
+}
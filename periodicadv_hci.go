@@ -0,0 +1,179 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPeriodicAdvertising = errors.New("bluetooth: could not start periodic advertising")
+)
+
+// PeriodicAdvertisingOptions configures a periodic advertisement.
+type PeriodicAdvertisingOptions struct {
+	// SID identifies the advertising set, between 0 and 15. Observers find it
+	// in the AdvertisingSID of their scan results, and pass it to
+	// SyncPeriodicAdvertising.
+	SID uint8
+
+	// Interval of the periodic advertising, in BLE-specific units. Create an
+	// interval by using NewDuration. It must be at least 7.5ms, and is 100ms
+	// if zero.
+	Interval Duration
+
+	// LocalName, if not empty, is advertised in the extended advertisements
+	// that tell observers how to synchronize, so that they can find the
+	// device.
+	LocalName string
+
+	// Data is the periodic advertising data, a sequence of AD structures of
+	// up to 248 bytes.
+	Data []byte
+}
+
+// PeriodicAdvertisement is a periodic advertising set, which broadcasts its
+// data at a fixed interval to the observers synchronized with it, without
+// connections. It is advertised alongside the default advertisement.
+type PeriodicAdvertisement struct {
+	adapter *Adapter
+}
+
+// StartPeriodicAdvertising starts periodic advertising, with its own
+// non-connectable advertising set. The controller must support extended and
+// periodic advertising, otherwise ErrPeriodicAdvertising is returned. Only one
+// periodic advertisement can run at a time.
+func (a *Adapter) StartPeriodicAdvertising(options PeriodicAdvertisingOptions) (*PeriodicAdvertisement, error) {
+	const required = leFeatureExtendedAdvertising | leFeaturePeriodicAdvertising
+	if a.hci.leFeatures&required != required || options.SID > 0x0f {
+		return nil, ErrPeriodicAdvertising
+	}
+	if len(options.Data) > maxExtAdvDataLength {
+		return nil, errAdvertisementPacketTooBig
+	}
+
+	// the legacy advertising commands can't be used anymore
+	a.hci.extendedAdvertising = true
+
+	ownAddress := a.advAddress
+	ownBdaddrType := uint8(0x00) // public
+	if ownAddress.isRandom {
+		ownBdaddrType = 0x01
+	}
+
+	// non-connectable and non-scannable, as required for periodic advertising
+	interval := uint32(a.powerSettings().advInterval)
+	_, status, err := a.hci.leSetExtAdvParameters(periodicAdvHandle, 0x0000, interval, interval,
+		uint8(AdvertisingChannelsAll), ownBdaddrType, options.SID, txPowerNoPreference)
+	if err != nil {
+		return nil, err
+	}
+	if status != 0x00 {
+		return nil, ErrPeriodicAdvertising
+	}
+
+	if ownAddress.isRandom {
+		if err := a.hci.leSetAdvSetRandomAddress(periodicAdvHandle, makeNINAAddress(ownAddress.MAC)); err != nil {
+			return nil, err
+		}
+	}
+
+	var payload advertisingPayload
+	payload.addLocalName([]byte(options.LocalName))
+	if err := a.hci.leSetExtAdvData(periodicAdvHandle, ocfLESetExtAdvData, payload.Bytes()); err != nil {
+		return nil, err
+	}
+
+	periodicInterval := options.Interval
+	if periodicInterval == 0 {
+		periodicInterval = NewDuration(100 * time.Millisecond)
+	}
+	// in units of 1.25ms
+	if err := a.hci.leSetPeriodicAdvParameters(uint16(periodicInterval / 2)); err != nil {
+		return nil, err
+	}
+
+	if err := a.hci.leSetPeriodicAdvData(options.Data); err != nil {
+		return nil, err
+	}
+
+	if err := a.hci.leSetPeriodicAdvEnable(true); err != nil {
+		return nil, err
+	}
+
+	if err := a.hci.leSetExtAdvEnable(periodicAdvHandle, true); err != nil {
+		return nil, err
+	}
+
+	return &PeriodicAdvertisement{adapter: a}, nil
+}
+
+// SetData replaces the periodic advertising data, without stopping the
+// periodic advertisement.
+func (p *PeriodicAdvertisement) SetData(data []byte) error {
+	return p.adapter.hci.leSetPeriodicAdvData(data)
+}
+
+// Stop stops the periodic advertisement and its advertising set.
+func (p *PeriodicAdvertisement) Stop() error {
+	if err := p.adapter.hci.leSetPeriodicAdvEnable(false); err != nil {
+		return err
+	}
+
+	return p.adapter.hci.leSetExtAdvEnable(periodicAdvHandle, false)
+}
+
+// leSetPeriodicAdvParameters sets the interval of the periodic advertising, in
+// units of 1.25ms.
+func (h *hci) leSetPeriodicAdvParameters(interval uint16) error {
+	var b [7]byte
+	b[0] = periodicAdvHandle
+	binary.LittleEndian.PutUint16(b[1:], interval)
+	binary.LittleEndian.PutUint16(b[3:], interval)
+	binary.LittleEndian.PutUint16(b[5:], 0x0000) // don't include the TX power
+
+	return h.sendPeriodicAdvCommand(ocfLESetPeriodicAdvParameters, b[:])
+}
+
+// leSetPeriodicAdvData sets the periodic advertising data in a single
+// operation.
+func (h *hci) leSetPeriodicAdvData(data []byte) error {
+	if len(data) > maxExtAdvDataLength {
+		return errAdvertisementPacketTooBig
+	}
+
+	var b [3 + maxExtAdvDataLength]byte
+	b[0] = periodicAdvHandle
+	b[1] = 0x03 // operation: complete data
+	b[2] = byte(len(data))
+	n := copy(b[3:], data)
+
+	return h.sendPeriodicAdvCommand(ocfLESetPeriodicAdvData, b[:3+n])
+}
+
+func (h *hci) leSetPeriodicAdvEnable(enabled bool) error {
+	var b [2]byte
+	if enabled {
+		b[0] = 1
+	}
+	b[1] = periodicAdvHandle
+
+	return h.sendPeriodicAdvCommand(ocfLESetPeriodicAdvEnable, b[:])
+}
+
+// sendPeriodicAdvCommand sends a periodic advertising command, and returns
+// ErrPeriodicAdvertising if the controller rejects it.
+func (h *hci) sendPeriodicAdvCommand(ocf uint16, params []byte) error {
+	status, _, err := h.sendCommandWithResponse(ogfLECtrl<<ogfCommandPos|ocf, params, nil)
+	if err != nil {
+		return err
+	}
+
+	if status != 0x00 {
+		return ErrPeriodicAdvertising
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import "errors"
+
+const (
+	// size of each buffer in the pool, large enough for an ACL packet
+	// carrying an ATT PDU of the maximum supported MTU.
+	poolBufferSize = 256
+
+	// number of buffers in the pool.
+	poolBufferCount = 8
+
+	// number of buffers for received notifications waiting for their
+	// callback, which are kept apart so that they can't starve the
+	// requests.
+	notificationBufferCount = 8
+)
+
+var (
+	ErrHCINoBuffers   = errors.New("bluetooth: HCI out of buffers")
+	ErrHCIPDUTooLarge = errors.New("bluetooth: HCI PDU too large")
+)
+
+// bufferPool is a fixed-size pool of packet buffers used to assemble and
+// parse ACL/ATT PDUs. All buffers are allocated up front, so getting and
+// putting buffers does not allocate.
+type bufferPool struct {
+	free chan []byte
+}
+
+func newBufferPool(count, size int) *bufferPool {
+	p := &bufferPool{
+		free: make(chan []byte, count),
+	}
+
+	backing := make([]byte, count*size)
+	for i := 0; i < count; i++ {
+		p.free <- backing[i*size : (i+1)*size : (i+1)*size]
+	}
+
+	return p
+}
+
+// get returns a free buffer from the pool, or ErrHCINoBuffers if all of them
+// are in use.
+func (p *bufferPool) get() ([]byte, error) {
+	select {
+	case buf := <-p.free:
+		return buf[:cap(buf)], nil
+	default:
+		return nil, ErrHCINoBuffers
+	}
+}
+
+// put returns a buffer to the pool. It must have been obtained using get.
+func (p *bufferPool) put(buf []byte) {
+	select {
+	case p.free <- buf[:cap(buf)]:
+	default:
+		// not one of ours, drop it
+	}
+}
+
+// size returns the number of buffers in the pool.
+func (p *bufferPool) size() int {
+	return cap(p.free)
+}
+
+// available returns the number of free buffers in the pool.
+func (p *bufferPool) available() int {
+	return len(p.free)
+}
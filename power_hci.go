@@ -0,0 +1,86 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"time"
+)
+
+// PowerProfile trades latency against power use, see SetPowerProfile.
+type PowerProfile uint8
+
+const (
+	// PowerProfileBalanced is the default profile.
+	PowerProfileBalanced PowerProfile = iota
+
+	// PowerProfileLatency favors responsiveness over power use.
+	PowerProfileLatency
+
+	// PowerProfileBattery favors power use over responsiveness, for battery
+	// powered devices.
+	PowerProfileBattery
+)
+
+// powerSettings are the settings of a power profile. Intervals are in units of
+// 0.625ms, connection intervals in units of 1.25ms.
+type powerSettings struct {
+	pollMin, pollMax time.Duration
+
+	scanInterval, scanWindow uint16
+	advInterval              uint16
+	connMinInterval          uint16
+	connMaxInterval          uint16
+}
+
+var powerProfiles = [...]powerSettings{
+	PowerProfileBalanced: {
+		pollMin:         defaultPollInterval,
+		pollMax:         defaultPollInterval,
+		scanInterval:    0x0080, // 80ms
+		scanWindow:      0x0030, // 30ms
+		advInterval:     0x00a0, // 100ms
+		connMinInterval: 0x0006, // 7.5ms
+		connMaxInterval: 0x000c, // 15ms
+	},
+	PowerProfileLatency: {
+		pollMin:         time.Millisecond,
+		pollMax:         time.Millisecond,
+		scanInterval:    0x0060, // 60ms
+		scanWindow:      0x0060, // continuous
+		advInterval:     0x0030, // 30ms
+		connMinInterval: 0x0006, // 7.5ms
+		connMaxInterval: 0x0006, // 7.5ms
+	},
+	PowerProfileBattery: {
+		pollMin:         defaultPollInterval,
+		pollMax:         100 * time.Millisecond,
+		scanInterval:    0x0640, // 1s
+		scanWindow:      0x0030, // 30ms
+		advInterval:     0x0640, // 1s
+		connMinInterval: 0x0018, // 30ms
+		connMaxInterval: 0x0050, // 100ms
+	},
+}
+
+// SetPowerProfile tunes the stack for latency or for power use: the poll
+// cadence of the controller, the scan duty cycle, and the advertising and
+// connection intervals that are used when none are given in the options or
+// parameters. It overrides the poll interval set with SetPollInterval or
+// SetAdaptivePollInterval, which may be called afterwards to fine-tune it.
+//
+// It should be called before scanning, advertising or connecting.
+func (a *hciAdapter) SetPowerProfile(profile PowerProfile) {
+	if int(profile) >= len(powerProfiles) {
+		profile = PowerProfileBalanced
+	}
+
+	a.powerProfile = profile
+
+	settings := &powerProfiles[profile]
+	a.SetAdaptivePollInterval(settings.pollMin, settings.pollMax)
+}
+
+// powerSettings returns the settings of the current power profile.
+func (a *hciAdapter) powerSettings() *powerSettings {
+	return &powerProfiles[a.powerProfile]
+}
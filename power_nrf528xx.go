@@ -0,0 +1,24 @@
+//go:build (softdevice && s113v7) || (softdevice && s132v6) || (softdevice && s140v6) || (softdevice && s140v7)
+
+package bluetooth
+
+/*
+#include "ble_gap.h"
+*/
+import "C"
+
+// SetTxPower sets the transmit power of the advertisement in dBm. The
+// SoftDevice only accepts the values supported by the radio, such as -40, -20,
+// -16, -12, -8, -4, 0, +3 and +4 on the nRF52832. May only be called after
+// the advertisement has been configured.
+func (a *Advertisement) SetTxPower(dBm int8) error {
+	errCode := C.sd_ble_gap_tx_power_set(C.BLE_GAP_TX_POWER_ROLE_ADV, C.uint16_t(a.handle), C.int8_t(dBm))
+	return makeError(errCode)
+}
+
+// SetTxPower sets the transmit power of the connection in dBm. See
+// Advertisement.SetTxPower for the supported values.
+func (d Device) SetTxPower(dBm int8) error {
+	errCode := C.sd_ble_gap_tx_power_set(C.BLE_GAP_TX_POWER_ROLE_CONN, d.connectionHandle, C.int8_t(dBm))
+	return makeError(errCode)
+}
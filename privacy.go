@@ -0,0 +1,74 @@
+package bluetooth
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+)
+
+// NewStaticRandomAddress returns a new static random address. A device may
+// keep using it for as long as it is powered, or store it to use it for its
+// lifetime.
+func NewStaticRandomAddress() (MAC, error) {
+	var mac MAC
+	for {
+		if _, err := rand.Read(mac[:]); err != nil {
+			return MAC{}, err
+		}
+
+		// the two most significant bits are set
+		mac[5] |= 0xc0
+
+		// the random part may not be all zeros or all ones
+		if !isAllBits(mac, 0x00) && !isAllBits(mac, 0xff) {
+			return mac, nil
+		}
+	}
+}
+
+// NewResolvablePrivateAddress returns a new resolvable private address, which
+// peers that know the identity resolving key can resolve to the device. The
+// key is given most significant byte first, as it is usually written. Devices
+// are expected to change their resolvable private address every 15 minutes.
+func NewResolvablePrivateAddress(irk [16]byte) (MAC, error) {
+	var prand [3]byte
+	for {
+		if _, err := rand.Read(prand[:]); err != nil {
+			return MAC{}, err
+		}
+
+		// the two most significant bits are 0b01
+		prand[0] = prand[0]&0x3f | 0x40
+
+		// the random part may not be all zeros or all ones
+		random := prand[0]&0x3f != 0 || prand[1] != 0 || prand[2] != 0
+		ones := prand[0]&0x3f == 0x3f && prand[1] == 0xff && prand[2] == 0xff
+		if random && !ones {
+			return resolvablePrivateAddress(irk, prand), nil
+		}
+	}
+}
+
+// resolvablePrivateAddress returns the resolvable private address for the
+// random part prand, most significant byte first. Its lower half is the hash of
+// prand computed with the random address hash function ah.
+func resolvablePrivateAddress(irk [16]byte, prand [3]byte) MAC {
+	block, _ := aes.NewCipher(irk[:]) // only fails for invalid key sizes
+
+	var plaintext, hash [16]byte
+	copy(plaintext[13:], prand[:])
+	block.Encrypt(hash[:], plaintext[:])
+
+	return MAC{hash[15], hash[14], hash[13], prand[2], prand[1], prand[0]}
+}
+
+// isAllBits returns whether the random part of a static random address, all
+// but the two most significant bits, only has the given bits.
+func isAllBits(mac MAC, bits byte) bool {
+	for i := 0; i < 5; i++ {
+		if mac[i] != bits {
+			return false
+		}
+	}
+
+	return mac[5]&0x3f == bits&0x3f
+}
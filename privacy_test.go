@@ -0,0 +1,27 @@
+package bluetooth
+
+import (
+	"testing"
+)
+
+func TestResolvablePrivateAddress(t *testing.T) {
+	// sample data from the Bluetooth Core specification, Vol 3, Part H,
+	// Appendix D.7
+	irk := [16]byte{0xec, 0x02, 0x34, 0xa3, 0x57, 0xc8, 0xad, 0x05, 0x34, 0x10, 0x10, 0xa6, 0x0a, 0x39, 0x7d, 0x9b}
+	mac := resolvablePrivateAddress(irk, [3]byte{0x70, 0x81, 0x94})
+
+	if s := mac.String(); s != "70:81:94:0D:FB:AA" {
+		t.Errorf("expected 70:81:94:0D:FB:AA, got %s", s)
+	}
+}
+
+func TestNewStaticRandomAddress(t *testing.T) {
+	mac, err := NewStaticRandomAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mac[5]&0xc0 != 0xc0 {
+		t.Errorf("%s is not a static random address", mac)
+	}
+}
@@ -0,0 +1,130 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	ErrReadMultipleNotSupported = errors.New("bluetooth: read multiple not supported by the device")
+
+	errReadMultipleHandles = errors.New("bluetooth: read multiple needs at least 2 characteristics that fit in a request")
+)
+
+// ReadMultiple reads the values of several characteristics in a single
+// request, and stores them one after the other in data. The device doesn't
+// tell where each value ends, so all the values except the last one must have
+// a fixed length known to the caller. The values are cut off at MTU-1 bytes in
+// total.
+//
+// ErrReadMultipleNotSupported is returned if the device doesn't support the
+// request.
+func (d Device) ReadMultiple(characteristics []DeviceCharacteristic, data []byte) (int, error) {
+	if err := d.readMultiple(attOpReadMultiReq, characteristics); err != nil {
+		return 0, err
+	}
+
+	cd, err := d.adapter.att.findConnectionData(d.handle)
+	if err != nil {
+		return 0, err
+	}
+
+	return copy(data, cd.value), nil
+}
+
+// ReadMultipleVariable reads the values of several characteristics of any
+// length in a single request, and returns them in the same order. The values
+// are cut off at MTU-1 bytes in total, including a 2 byte length for each of
+// them, so that some of the last values may be incomplete or missing.
+//
+// The request was added in Bluetooth 5.2, ErrReadMultipleNotSupported is
+// returned if the device doesn't support it.
+func (d Device) ReadMultipleVariable(characteristics []DeviceCharacteristic) ([][]byte, error) {
+	if err := d.readMultiple(attOpReadMultiVarReq, characteristics); err != nil {
+		return nil, err
+	}
+
+	cd, err := d.adapter.att.findConnectionData(d.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, 0, len(characteristics))
+	for b := cd.value; len(b) >= 2; {
+		length := int(binary.LittleEndian.Uint16(b))
+		b = b[2:]
+		if length > len(b) {
+			// truncated by the MTU
+			length = len(b)
+		}
+
+		values = append(values, append([]byte(nil), b[:length]...))
+		b = b[length:]
+	}
+
+	return values, nil
+}
+
+// readMultiple sends a Read Multiple request for the characteristics, and
+// leaves the response in the connection data.
+func (d Device) readMultiple(opcode uint8, characteristics []DeviceCharacteristic) error {
+	if len(characteristics) < 2 || 1+2*len(characteristics) > int(d.MTU()) {
+		return errReadMultipleHandles
+	}
+
+	handles := make([]uint16, len(characteristics))
+	for i, c := range characteristics {
+		if !c.permissions.Read() {
+			return errNoRead
+		}
+		handles[i] = c.handle
+	}
+
+	d.requests.acquire()
+	defer d.requests.release()
+
+	err := d.withSecurityRetry(func() error {
+		return d.adapter.att.readMultipleReq(d.handle, opcode, handles)
+	})
+	if err == ErrATTOp {
+		if _, _, code := d.adapter.att.lastError(d.handle); code == attErrorRequestNotSupported {
+			return ErrReadMultipleNotSupported
+		}
+	}
+
+	return err
+}
+
+// readMultipleReq reads the values of several attributes, with a Read Multiple
+// or Read Multiple Variable request.
+func (a *att) readMultipleReq(connectionHandle uint16, opcode uint8, handles []uint16) error {
+	if debug {
+		println("att.readMultipleReq:", connectionHandle, opcode, len(handles))
+	}
+
+	a.busy.Lock()
+	defer a.busy.Unlock()
+
+	b, err := a.hci.pool.get()
+	if err != nil {
+		return err
+	}
+	defer a.hci.pool.put(b)
+
+	if 1+2*len(handles) > len(b) {
+		return ErrHCIPDUTooLarge
+	}
+
+	b[0] = opcode
+	for i, handle := range handles {
+		binary.LittleEndian.PutUint16(b[1+2*i:], handle)
+	}
+
+	if err := a.sendReq(connectionHandle, b[:1+2*len(handles)]); err != nil {
+		return err
+	}
+
+	return a.waitUntilResponse(connectionHandle, 0)
+}
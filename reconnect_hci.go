@@ -0,0 +1,473 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"bytes"
+)
+
+const (
+	gattServiceChangedUUID = 0x2a05
+	gattDatabaseHashUUID   = 0x2b2a
+)
+
+// gattCache holds the discovered services and characteristics of a peer and
+// the notifications that were enabled on it, so they can be reused when
+// reconnecting to it. See SetFastReconnect.
+type gattCache struct {
+	address Address
+
+	services        []DeviceService
+	allServices     bool
+	characteristics []cachedCharacteristic
+
+	// start handles of the services of which all characteristics are cached
+	allCharacteristics []uint16
+
+	subscriptions []notificationRegistration
+
+	// value handle of the Service Changed characteristic, or 0 if unknown
+	serviceChanged uint16
+
+	// Database Hash of the peer when the cache was filled, or nil if the peer
+	// doesn't have one
+	databaseHash []byte
+}
+
+// invalidate drops everything that was discovered on the peer, after its GATT
+// database has changed.
+func (c *gattCache) invalidate() {
+	if debug {
+		println("GATT database changed, dropping cache")
+	}
+
+	c.services = nil
+	c.allServices = false
+	c.characteristics = nil
+	c.allCharacteristics = nil
+	c.subscriptions = nil
+	c.databaseHash = nil
+}
+
+type cachedCharacteristic struct {
+	serviceHandle uint16
+	uuid          UUID
+	handle        uint16
+	endHandle     uint16
+	properties    uint8
+}
+
+// SetFastReconnect sets whether to remember the services and characteristics
+// discovered on a peer, and the notifications enabled on it. When connecting
+// to the same peer again, discovery is answered from the cache without any
+// radio traffic, and the notifications are enabled again automatically, with
+// the same callbacks.
+//
+// The cache is dropped when the GATT database of the peer changes: when it
+// sends a Service Changed indication, which is enabled as soon as the Service
+// Changed characteristic has been discovered, or when its Database Hash
+// differs when connecting again. Peers that support neither must not change
+// their database, or ForgetDevice must be used to drop their cache. Fast
+// reconnect is not available in static allocation mode.
+//
+// Peers are recognized by their address and its type, so the cache of a peer
+// that uses resolvable private addresses is only used until its address
+// changes.
+func (a *hciAdapter) SetFastReconnect(enabled bool) {
+	a.gattCacheMu.Lock()
+	defer a.gattCacheMu.Unlock()
+
+	a.fastReconnect = enabled
+	if !enabled {
+		a.gattCaches = nil
+	}
+}
+
+// ForgetDevice drops everything that was cached about a peer for fast
+// reconnect.
+func (a *hciAdapter) ForgetDevice(address Address) {
+	a.gattCacheMu.Lock()
+	defer a.gattCacheMu.Unlock()
+
+	for i := range a.gattCaches {
+		if a.gattCaches[i].address == address {
+			a.gattCaches = append(a.gattCaches[:i], a.gattCaches[i+1:]...)
+			return
+		}
+	}
+}
+
+// findGATTCache returns the cache for the peer, or nil if fast reconnect is
+// disabled. If create is set, a new cache is created if there is none yet. The
+// cache may only be used while holding gattCacheMu.
+func (a *hciAdapter) findGATTCache(address Address, create bool) *gattCache {
+	if !a.fastReconnect || a.hci.static {
+		return nil
+	}
+
+	for i := range a.gattCaches {
+		if a.gattCaches[i].address == address {
+			return a.gattCaches[i]
+		}
+	}
+
+	if !create {
+		return nil
+	}
+
+	c := &gattCache{address: address}
+	a.gattCaches = append(a.gattCaches, c)
+
+	return c
+}
+
+// cachedServices returns the requested services from the cache. It returns
+// false if they are not all cached.
+func (d Device) cachedServices(uuids []UUID) ([]DeviceService, bool) {
+	d.adapter.gattCacheMu.Lock()
+	defer d.adapter.gattCacheMu.Unlock()
+
+	c := d.adapter.findGATTCache(d.Address, false)
+	if c == nil {
+		return nil, false
+	}
+
+	if len(uuids) == 0 {
+		if !c.allServices {
+			return nil, false
+		}
+
+		services := make([]DeviceService, len(c.services))
+		for i, s := range c.services {
+			s.device = d
+			services[i] = s
+		}
+
+		return services, true
+	}
+
+	services := make([]DeviceService, 0, len(uuids))
+	for _, uuid := range uuids {
+		found := false
+		for _, s := range c.services {
+			if s.uuid == uuid {
+				s.device = d
+				services = append(services, s)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, false
+		}
+	}
+
+	return services, true
+}
+
+// cacheServices adds discovered services to the cache. all is set if they
+// are all services of the peer.
+func (d Device) cacheServices(services []DeviceService, all bool) {
+	d.adapter.gattCacheMu.Lock()
+	defer d.adapter.gattCacheMu.Unlock()
+
+	c := d.adapter.findGATTCache(d.Address, true)
+	if c == nil {
+		return
+	}
+
+	for _, s := range services {
+		found := false
+		for _, cs := range c.services {
+			if cs.startHandle == s.startHandle {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			s.device = Device{}
+			c.services = append(c.services, s)
+		}
+	}
+
+	c.allServices = c.allServices || all
+}
+
+// cachedCharacteristics returns the requested characteristics from the cache.
+// It returns false if they are not all cached.
+func (s *DeviceService) cachedCharacteristics(uuids []UUID) ([]DeviceCharacteristic, bool) {
+	s.device.adapter.gattCacheMu.Lock()
+	defer s.device.adapter.gattCacheMu.Unlock()
+
+	c := s.device.adapter.findGATTCache(s.device.Address, false)
+	if c == nil {
+		return nil, false
+	}
+
+	characteristic := func(cc cachedCharacteristic) DeviceCharacteristic {
+		return DeviceCharacteristic{
+			service:     s,
+			uuid:        cc.uuid,
+			handle:      cc.handle,
+			endHandle:   cc.endHandle,
+			properties:  cc.properties,
+			permissions: CharacteristicPermissions(cc.properties),
+		}
+	}
+
+	if len(uuids) == 0 {
+		all := false
+		for _, h := range c.allCharacteristics {
+			if h == s.startHandle {
+				all = true
+				break
+			}
+		}
+
+		if !all {
+			return nil, false
+		}
+
+		var characteristics []DeviceCharacteristic
+		for _, cc := range c.characteristics {
+			if cc.serviceHandle == s.startHandle {
+				characteristics = append(characteristics, characteristic(cc))
+			}
+		}
+
+		return characteristics, true
+	}
+
+	characteristics := make([]DeviceCharacteristic, 0, len(uuids))
+	for _, uuid := range uuids {
+		found := false
+		for _, cc := range c.characteristics {
+			if cc.serviceHandle == s.startHandle && cc.uuid == uuid {
+				characteristics = append(characteristics, characteristic(cc))
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, false
+		}
+	}
+
+	return characteristics, true
+}
+
+// cacheCharacteristics adds discovered characteristics of the service to the
+// cache. all is set if they are all characteristics of the service.
+func (s *DeviceService) cacheCharacteristics(characteristics []DeviceCharacteristic, all bool) {
+	s.device.adapter.gattCacheMu.Lock()
+	defer s.device.adapter.gattCacheMu.Unlock()
+
+	c := s.device.adapter.findGATTCache(s.device.Address, true)
+	if c == nil {
+		return
+	}
+
+	for _, dc := range characteristics {
+		found := false
+		for _, cc := range c.characteristics {
+			if cc.handle == dc.handle {
+				found = true
+				break
+			}
+		}
+
+		if dc.uuid == New16BitUUID(gattServiceChangedUUID) {
+			c.serviceChanged = dc.handle
+		}
+
+		if !found {
+			c.characteristics = append(c.characteristics, cachedCharacteristic{
+				serviceHandle: s.startHandle,
+				uuid:          dc.uuid,
+				handle:        dc.handle,
+				endHandle:     dc.endHandle,
+				properties:    dc.properties,
+			})
+		}
+	}
+
+	if all {
+		c.allCharacteristics = append(c.allCharacteristics, s.startHandle)
+	}
+}
+
+// cacheSubscription records that notifications, or indications if indicate is
+// set, have been enabled or, if the callback is nil, disabled for the
+// characteristic value handle.
+func (d Device) cacheSubscription(handle uint16, callback func([]byte), indicate bool) {
+	d.adapter.gattCacheMu.Lock()
+	defer d.adapter.gattCacheMu.Unlock()
+
+	c := d.adapter.findGATTCache(d.Address, callback != nil)
+	if c == nil {
+		return
+	}
+
+	for i := range c.subscriptions {
+		if c.subscriptions[i].handle == handle {
+			if callback == nil {
+				c.subscriptions = append(c.subscriptions[:i], c.subscriptions[i+1:]...)
+			} else {
+				c.subscriptions[i].callback = callback
+				c.subscriptions[i].indicate = indicate
+			}
+
+			return
+		}
+	}
+
+	if callback != nil {
+		c.subscriptions = append(c.subscriptions, notificationRegistration{
+			handle:   handle,
+			callback: callback,
+			indicate: indicate,
+		})
+	}
+}
+
+// restoreSubscriptions enables the notifications that were enabled on the
+// peer during a previous connection again, as well as the Service Changed
+// indications.
+func (d Device) restoreSubscriptions() error {
+	// copied, as the cache can't be held during the requests
+	d.adapter.gattCacheMu.Lock()
+	c := d.adapter.findGATTCache(d.Address, false)
+	var subscriptions []notificationRegistration
+	if c != nil {
+		subscriptions = append(subscriptions, c.subscriptions...)
+	}
+	d.adapter.gattCacheMu.Unlock()
+
+	if c == nil {
+		return nil
+	}
+
+	d.requests.acquire()
+	defer d.requests.release()
+
+	if err := d.enableServiceChanged(); err != nil {
+		return err
+	}
+
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	if debug {
+		println("restoring", len(subscriptions), "subscriptions")
+	}
+
+	d.startNotifications()
+
+	for _, n := range subscriptions {
+		value := []byte{0x01, 0x00}
+		if n.indicate {
+			value[0] = 0x02
+		}
+
+		err := d.withSecurityRetry(func() error {
+			return d.adapter.att.writeReq(d.handle, n.handle+1, value, 0)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := d.addNotificationRegistration(n.handle, n.callback); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkGATTCache reads the Database Hash of the peer after connecting to it,
+// and drops its cache if the hash has changed since the cache was filled.
+func (d Device) checkGATTCache() error {
+	d.adapter.gattCacheMu.Lock()
+	c := d.adapter.findGATTCache(d.Address, true)
+	d.adapter.gattCacheMu.Unlock()
+
+	if c == nil {
+		return nil
+	}
+
+	cd, err := d.adapter.att.findConnectionData(d.handle)
+	if err != nil {
+		return err
+	}
+
+	d.requests.acquire()
+	defer d.requests.release()
+
+	err = d.adapter.att.readByTypeReq(d.handle, 0x0001, 0xffff, gattDatabaseHashUUID, 0)
+	cd.characteristics = cd.characteristics[:0]
+	switch {
+	case err == ErrATTOp:
+		// no Database Hash, rely on Service Changed indications
+		return nil
+	case err != nil:
+		return err
+	}
+
+	// length of the handle-value pair, handle and 128-bit hash
+	if len(cd.value) < 19 || cd.value[0] != 18 {
+		return nil
+	}
+	hash := cd.value[3:19]
+
+	d.adapter.gattCacheMu.Lock()
+	defer d.adapter.gattCacheMu.Unlock()
+
+	if c.databaseHash != nil && !bytes.Equal(c.databaseHash, hash) {
+		c.invalidate()
+	}
+	c.databaseHash = append(c.databaseHash[:0], hash...)
+
+	return nil
+}
+
+// enableServiceChanged enables the Service Changed indications of the peer,
+// once its Service Changed characteristic has been discovered, so that its
+// cache can be dropped when its GATT database changes. It must be called while
+// holding the request queue of the device.
+func (d Device) enableServiceChanged() error {
+	d.adapter.gattCacheMu.Lock()
+	var serviceChanged uint16
+	if c := d.adapter.findGATTCache(d.Address, false); c != nil {
+		serviceChanged = c.serviceChanged
+	}
+	d.adapter.gattCacheMu.Unlock()
+
+	if serviceChanged == 0 || d.serviceChangedEnabled {
+		return nil
+	}
+
+	d.startNotifications()
+
+	if err := d.adapter.att.writeReq(d.handle, serviceChanged+1, []byte{0x02, 0x00}, 0); err != nil {
+		return err
+	}
+	d.serviceChangedEnabled = true
+
+	return nil
+}
+
+// checkServiceChanged drops the cache of the peer if the notification or
+// indication received on the handle is a Service Changed indication.
+func (d Device) checkServiceChanged(handle uint16) {
+	d.adapter.gattCacheMu.Lock()
+	defer d.adapter.gattCacheMu.Unlock()
+
+	c := d.adapter.findGATTCache(d.Address, false)
+	if c != nil && c.serviceChanged != 0 && c.serviceChanged == handle {
+		c.invalidate()
+	}
+}
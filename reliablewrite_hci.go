@@ -0,0 +1,87 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"errors"
+)
+
+var (
+	ErrReliableWriteDone = errors.New("bluetooth: reliable write already executed or cancelled")
+)
+
+// ReliableWrite is a reliable write transaction, which writes the values of
+// one or more characteristics of a device together. Each value is queued by
+// the device and echoed back, and the transaction fails if the echo differs.
+// Nothing is written until Execute is called, and nothing at all if a write
+// fails.
+//
+// Other writes to the device must not be made while a transaction is open, as
+// they would be mixed up with its queue.
+type ReliableWrite struct {
+	device Device
+	done   bool
+}
+
+// BeginReliableWrite starts a reliable write transaction with the device.
+func (d Device) BeginReliableWrite() *ReliableWrite {
+	return &ReliableWrite{device: d}
+}
+
+// Write queues the new value of a characteristic of the device. If it fails,
+// the queue is discarded and the transaction is over.
+func (w *ReliableWrite) Write(c DeviceCharacteristic, p []byte) error {
+	if w.done {
+		return ErrReliableWriteDone
+	}
+
+	if !c.permissions.Write() {
+		return errNoWrite
+	}
+
+	d := w.device
+	d.requests.acquire()
+	defer d.requests.release()
+
+	if err := d.withSecurityRetry(func() error {
+		return d.adapter.att.prepWrite(d.handle, c.handle, p, 0)
+	}); err != nil {
+		w.done = true
+		return err
+	}
+
+	return nil
+}
+
+// Execute writes all the queued values, and ends the transaction.
+func (w *ReliableWrite) Execute() error {
+	return w.end(true)
+}
+
+// Cancel discards all the queued values, and ends the transaction.
+func (w *ReliableWrite) Cancel() error {
+	return w.end(false)
+}
+
+func (w *ReliableWrite) end(execute bool) error {
+	if w.done {
+		return ErrReliableWriteDone
+	}
+	w.done = true
+
+	w.device.requests.acquire()
+	defer w.device.requests.release()
+
+	return w.device.adapter.att.execWriteReq(w.device.handle, execute, 0)
+}
+
+// ReliableWrite writes the value of the characteristic in a reliable write
+// transaction of its own, see ReliableWrite.
+func (c DeviceCharacteristic) ReliableWrite(p []byte) error {
+	w := c.service.device.BeginReliableWrite()
+	if err := w.Write(c, p); err != nil {
+		return err
+	}
+
+	return w.Execute()
+}
@@ -0,0 +1,58 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"sync"
+)
+
+// requestQueue serializes the GATT operations on a connection. ATT allows a
+// single outstanding request, and operations such as a long read or a service
+// discovery are made of several requests whose responses share the connection
+// data, so each operation must run to completion before the next one starts.
+// Waiting operations are run in the order in which they were queued.
+type requestQueue struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	next    uint32 // ticket of the next operation to be queued
+	serving uint32 // ticket of the operation that is running
+}
+
+// acquire waits until all the operations queued before have completed.
+func (q *requestQueue) acquire() {
+	q.wait(q.reserve())
+}
+
+// reserve queues an operation, and returns its ticket to pass to wait. Each
+// reserved ticket must be waited for and released, or the queue stalls.
+func (q *requestQueue) reserve() uint32 {
+	q.mu.Lock()
+	ticket := q.next
+	q.next++
+	q.mu.Unlock()
+
+	return ticket
+}
+
+// wait waits until all the operations queued before the ticket have completed.
+func (q *requestQueue) wait(ticket uint32) {
+	q.mu.Lock()
+	if q.cond.L == nil {
+		q.cond.L = &q.mu
+	}
+
+	for ticket != q.serving {
+		q.cond.Wait()
+	}
+	q.mu.Unlock()
+}
+
+// release lets the next queued operation run.
+func (q *requestQueue) release() {
+	q.mu.Lock()
+	q.serving++
+	if q.cond.L != nil {
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+}
@@ -0,0 +1,100 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import "sync"
+
+// number of advertising reports that can be queued while the scan callback is
+// busy.
+const advReportQueueSize = 16
+
+// advReportQueue is a bounded ring buffer of advertising reports. It decouples
+// receiving reports from the controller from calling the scan callback, so a
+// slow callback doesn't cause reports to be lost without notice: when the
+// queue is full new reports are dropped and counted instead.
+type advReportQueue struct {
+	mu      sync.Mutex
+	reports [advReportQueueSize]leAdvertisingReport
+	head    int
+	count   int
+	dropped uint32
+
+	// ready is signalled when a report has been queued.
+	ready chan struct{}
+}
+
+func newAdvReportQueue() *advReportQueue {
+	return &advReportQueue{
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// push adds a copy of the report to the queue. It returns false if the queue
+// is full, in which case the report is dropped.
+func (q *advReportQueue) push(r *leAdvertisingReport) bool {
+	q.mu.Lock()
+	if q.count == len(q.reports) {
+		q.dropped++
+		q.mu.Unlock()
+		return false
+	}
+
+	q.reports[(q.head+q.count)%len(q.reports)] = *r
+	q.count++
+	q.mu.Unlock()
+
+	q.wake()
+
+	return true
+}
+
+// pop removes the oldest report from the queue and copies it into r. It
+// returns false if the queue is empty.
+func (q *advReportQueue) pop(r *leAdvertisingReport) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.count == 0 {
+		return false
+	}
+
+	*r = q.reports[q.head]
+	q.head = (q.head + 1) % len(q.reports)
+	q.count--
+
+	return true
+}
+
+// wake wakes up a consumer waiting on the ready channel.
+func (q *advReportQueue) wake() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// reset empties the queue and clears the overflow counter.
+func (q *advReportQueue) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.head = 0
+	q.count = 0
+	q.dropped = 0
+}
+
+// drop counts a report that was dropped after it left the queue.
+func (q *advReportQueue) drop() {
+	q.mu.Lock()
+	q.dropped++
+	q.mu.Unlock()
+}
+
+// droppedReports returns the number of reports dropped because the queue was
+// full.
+func (q *advReportQueue) droppedReports() uint32 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.dropped
+}
@@ -0,0 +1,147 @@
+// Package scanlog records scan results to a file and replays them later, so
+// code that processes advertisements, such as beacon parsers, can be developed
+// and tested without a radio.
+//
+// The log is a text file with one scan result per line: the time since the
+// start of the recording in nanoseconds, the address, the RSSI and the raw
+// advertising data in hexadecimal, separated by spaces. Results of which the
+// raw advertising data is not available on the platform are recorded without
+// data.
+package scanlog
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// Recorder writes scan results to a log.
+type Recorder struct {
+	w     io.Writer
+	start time.Time
+}
+
+// NewRecorder returns a recorder that writes to w. The timestamps in the log
+// are relative to the time it is created.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		w:     w,
+		start: time.Now(),
+	}
+}
+
+// Record writes a scan result to the log. It is meant to be called from the
+// scan callback.
+func (r *Recorder) Record(result bluetooth.ScanResult) error {
+	_, err := fmt.Fprintf(r.w, "%d %s %d %s\n", time.Since(r.start).Nanoseconds(),
+		result.Address.String(), result.RSSI, hex.EncodeToString(result.Bytes()))
+
+	return err
+}
+
+// Replay reads scan results from a log and passes them to the callback, like
+// Adapter.Scan does, with the same timing as when they were recorded. The
+// adapter is passed to the callback as is, and may be nil.
+func Replay(r io.Reader, adapter *bluetooth.Adapter, callback func(*bluetooth.Adapter, bluetooth.ScanResult)) error {
+	start := time.Now()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		offset, result, err := parse(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("scanlog: line %d: %w", line, err)
+		}
+
+		time.Sleep(time.Until(start.Add(offset)))
+		callback(adapter, result)
+	}
+
+	return scanner.Err()
+}
+
+// parse parses a line of the log.
+func parse(line string) (time.Duration, bluetooth.ScanResult, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields) > 4 {
+		return 0, bluetooth.ScanResult{}, fmt.Errorf("expected 3 or 4 fields, got %d", len(fields))
+	}
+
+	offset, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, bluetooth.ScanResult{}, err
+	}
+
+	rssi, err := strconv.ParseInt(fields[2], 10, 16)
+	if err != nil {
+		return 0, bluetooth.ScanResult{}, err
+	}
+
+	var data []byte
+	if len(fields) == 4 {
+		data, err = hex.DecodeString(fields[3])
+		if err != nil {
+			return 0, bluetooth.ScanResult{}, err
+		}
+	}
+
+	// malformed advertising data is replayed as far as it can be parsed, like
+	// it was received.
+	adf, _ := bluetooth.ParseAdvertisingData(data)
+
+	result := bluetooth.ScanResult{
+		RSSI:                 int16(rssi),
+		AdvertisementPayload: &payload{fields: adf, raw: data},
+	}
+	result.Address.Set(fields[1])
+
+	return time.Duration(offset), result, nil
+}
+
+// payload is a replayed advertisement payload.
+type payload struct {
+	fields bluetooth.AdvertisementFields
+	raw    []byte
+}
+
+func (p *payload) LocalName() string {
+	return p.fields.LocalName
+}
+
+func (p *payload) HasServiceUUID(uuid bluetooth.UUID) bool {
+	for _, u := range p.fields.ServiceUUIDs {
+		if u == uuid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *payload) Bytes() []byte {
+	return p.raw
+}
+
+func (p *payload) ManufacturerData() []bluetooth.ManufacturerDataElement {
+	return p.fields.ManufacturerData
+}
+
+func (p *payload) ServiceData() []bluetooth.ServiceDataElement {
+	return p.fields.ServiceData
+}
+
+func (p *payload) TxPowerLevel() (int8, bool) {
+	return p.fields.TxPower, p.fields.HasTxPower
+}
+
+func (p *payload) Appearance() uint16 {
+	return p.fields.Appearance
+}
@@ -0,0 +1,56 @@
+package scanlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"tinygo.org/x/bluetooth"
+)
+
+func TestReplay(t *testing.T) {
+	log := "0 EE:74:7D:C9:2A:68 -60 0201060709666f6f626172\n" +
+		"\n" +
+		"1000 11:22:33:44:55:66 -72\n"
+
+	var results []bluetooth.ScanResult
+	err := Replay(strings.NewReader(log), nil, func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+		results = append(results, result)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Address.String() != "EE:74:7D:C9:2A:68" || results[0].RSSI != -60 || results[0].LocalName() != "foobar" {
+		t.Errorf("unexpected first result: %s %d %q", results[0].Address.String(), results[0].RSSI, results[0].LocalName())
+	}
+	if results[1].Address.String() != "11:22:33:44:55:66" || results[1].Bytes() != nil {
+		t.Errorf("unexpected second result: %s %x", results[1].Address.String(), results[1].Bytes())
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	err := Replay(strings.NewReader("5 EE:74:7D:C9:2A:68 -60 0303 0f18\n"), nil, nil)
+	if err == nil {
+		t.Error("expected error for a line with too many fields")
+	}
+
+	err = Replay(strings.NewReader("5 EE:74:7D:C9:2A:68 -60 03030f18\n"), nil, func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+		if err := r.Record(result); err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := strings.Fields(buf.String())
+	if len(fields) != 4 || fields[1] != "EE:74:7D:C9:2A:68" || fields[2] != "-60" || fields[3] != "03030f18" {
+		t.Errorf("unexpected recording: %q", buf.String())
+	}
+}
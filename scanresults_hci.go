@@ -0,0 +1,97 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"context"
+)
+
+// ScanOverflowPolicy sets what happens to a scan result that arrives while the
+// channel returned by ScanResults is full.
+type ScanOverflowPolicy uint8
+
+const (
+	// ScanDropNewest drops the new result.
+	ScanDropNewest ScanOverflowPolicy = iota
+
+	// ScanDropOldest drops the oldest result in the channel to make room for
+	// the new one.
+	ScanDropOldest
+
+	// ScanBlock waits until there is room in the channel. Meanwhile reports
+	// are queued, and dropped once the queue is full too.
+	ScanBlock
+)
+
+// ScanResults starts a scan like ScanWithOptions, but returns the results on a
+// channel that is buffered with room for size results, as an alternative to a
+// callback. Unlike the results passed to a scan callback, the results stay
+// valid after they have been received. Dropped results are counted by
+// DroppedScanReports.
+//
+// The channel is closed when the scan stops, because the context is done or
+// StopScan was called. With ScanBlock, keep receiving until then, or cancel
+// the context, as the scan waits for the channel.
+func (a *Adapter) ScanResults(ctx context.Context, options ScanOptions, size int, policy ScanOverflowPolicy) (<-chan ScanResult, error) {
+	if err := a.startScan(options); err != nil {
+		return nil, err
+	}
+
+	results := make(chan ScanResult, size)
+	go func() {
+		defer close(results)
+
+		err := a.receiveScanResults(ctx, options, func(a *Adapter, result ScanResult) {
+			result = copyScanResult(result)
+
+			switch policy {
+			case ScanBlock:
+				select {
+				case results <- result:
+				case <-ctx.Done():
+				}
+				return
+			case ScanDropOldest:
+				select {
+				case results <- result:
+					return
+				default:
+				}
+
+				// make room, the consumer may have made room already
+				select {
+				case <-results:
+					a.hci.advReports.drop()
+				default:
+				}
+			}
+
+			select {
+			case results <- result:
+			default:
+				a.hci.advReports.drop()
+			}
+		})
+		if err != nil && debug {
+			println("scan stopped:", err.Error())
+		}
+	}()
+
+	return results, nil
+}
+
+// copyScanResult returns a copy of the result that doesn't share memory with
+// the report it was made from.
+func copyScanResult(result ScanResult) ScanResult {
+	raw := append([]byte{}, result.Bytes()...)
+	adf, _ := ParseAdvertisingData(raw)
+
+	result.AdvertisementPayload = &parsedAdvertisementPayload{
+		advertisementFields: advertisementFields{
+			AdvertisementFields: adf,
+		},
+		raw: raw,
+	}
+
+	return result
+}
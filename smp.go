@@ -0,0 +1,68 @@
+package bluetooth
+
+import (
+	"crypto/aes"
+)
+
+// smpEncrypt is the security function e of the Security Manager, AES-128 with
+// the key, the plaintext and the result least significant byte first, as they
+// are sent over the air.
+func smpEncrypt(key, plaintext [16]byte) [16]byte {
+	var k, p, c [16]byte
+	for i := range key {
+		k[i] = key[15-i]
+		p[i] = plaintext[15-i]
+	}
+
+	block, _ := aes.NewCipher(k[:]) // only fails for invalid key sizes
+	block.Encrypt(c[:], p[:])
+
+	var result [16]byte
+	for i := range c {
+		result[i] = c[15-i]
+	}
+
+	return result
+}
+
+// smpConfirm is the confirm value generation function c1 of LE legacy
+// pairing, for the temporary key tk and the random value r. preq and pres are
+// the Pairing Request and Response commands, ia and ra the addresses of the
+// initiator and the responder, and iat and rat their address types.
+func smpConfirm(tk, r [16]byte, preq, pres [7]byte, iat, rat uint8, ia, ra [6]byte) [16]byte {
+	var p1, p2 [16]byte
+	p1[0] = iat
+	p1[1] = rat
+	copy(p1[2:], preq[:])
+	copy(p1[9:], pres[:])
+	copy(p2[0:], ra[:])
+	copy(p2[6:], ia[:])
+
+	for i := range r {
+		r[i] ^= p1[i]
+	}
+	r = smpEncrypt(tk, r)
+
+	for i := range r {
+		r[i] ^= p2[i]
+	}
+
+	return smpEncrypt(tk, r)
+}
+
+// smpSTK is the key generation function s1 of LE legacy pairing, which gives
+// the short term key from the temporary key tk and the random values of the
+// responder, r1, and of the initiator, r2. The key is shortened to keySize
+// bytes.
+func smpSTK(tk, r1, r2 [16]byte, keySize uint8) [16]byte {
+	var r [16]byte
+	copy(r[0:], r2[:8])
+	copy(r[8:], r1[:8])
+
+	stk := smpEncrypt(tk, r)
+	for i := int(keySize); i < len(stk); i++ {
+		stk[i] = 0
+	}
+
+	return stk
+}
@@ -0,0 +1,338 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	smpPairingRequest  = 0x01
+	smpPairingResponse = 0x02
+	smpPairingConfirm  = 0x03
+	smpPairingRandom   = 0x04
+	smpPairingFailed   = 0x05
+	smpSecurityRequest = 0x0b
+
+	smpErrorConfirmValueFailed  = 0x04
+	smpErrorEncryptionKeySize   = 0x06
+	smpErrorCommandNotSupported = 0x07
+	smpErrorUnspecifiedReason   = 0x08
+
+	smpIOCapabilityNoInputOutput = 0x03
+	smpMinKeySize                = 7
+	smpMaxKeySize                = 16
+
+	// length of the Pairing Request and Response commands, and of the Pairing
+	// Confirm and Random commands
+	smpPairingCommandLength       = 7
+	smpPairingConfirmRandomLength = 17
+)
+
+// time to complete a pairing, after which it fails
+const smpPairingTimeout = 30 * time.Second
+
+var (
+	ErrPairingFailed = errors.New("bluetooth: pairing failed")
+)
+
+// smpPairing is the state of the pairing on a connection. Only LE legacy
+// pairing with Just Works is supported: the temporary key is zero, and no keys
+// are distributed, so the link has to be paired again on each connection.
+type smpPairing struct {
+	handle uint16
+
+	// set if the local device is the central, which initiates the pairing
+	initiator bool
+
+	// addresses and address types of the initiator and the responder
+	ia, ra   [6]byte
+	iat, rat uint8
+
+	preq, pres  [7]byte
+	random      [16]byte
+	peerConfirm [16]byte
+	keySize     uint8
+
+	// short term key, kept by the responder until the central starts the
+	// encryption
+	stk    [16]byte
+	hasSTK bool
+
+	// set when the pairing has ended
+	done   bool
+	failed bool
+}
+
+type smp struct {
+	hci      *hci
+	pairings []smpPairing
+}
+
+func newSMP(hci *hci) *smp {
+	return &smp{
+		hci: hci,
+	}
+}
+
+// addConnection records the addresses used on a new connection, which are part
+// of the confirm values.
+func (s *smp) addConnection(handle uint16, role uint8, ownAddressType uint8, ownAddress [6]byte,
+	peerAddressType uint8, peerAddress [6]byte) {
+	p := smpPairing{
+		handle:    handle,
+		initiator: role == 0x00,
+	}
+
+	if p.initiator {
+		p.iat, p.ia = ownAddressType, ownAddress
+		p.rat, p.ra = peerAddressType&0x01, peerAddress
+	} else {
+		p.iat, p.ia = peerAddressType&0x01, peerAddress
+		p.rat, p.ra = ownAddressType, ownAddress
+	}
+
+	s.pairings = append(s.pairings, p)
+}
+
+func (s *smp) removeConnection(handle uint16) {
+	for i := range s.pairings {
+		if s.pairings[i].handle == handle {
+			s.pairings = append(s.pairings[:i], s.pairings[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *smp) findPairing(handle uint16) *smpPairing {
+	for i := range s.pairings {
+		if s.pairings[i].handle == handle {
+			return &s.pairings[i]
+		}
+	}
+
+	return nil
+}
+
+// pair pairs with the peripheral of the connection and starts the encryption
+// of the link, and waits until the link is encrypted.
+func (s *smp) pair(handle uint16) error {
+	p := s.findPairing(handle)
+	if p == nil || !p.initiator {
+		return ErrPairingFailed
+	}
+
+	p.done, p.failed, p.hasSTK = false, false, false
+	p.preq = [7]byte{smpPairingRequest, smpIOCapabilityNoInputOutput, 0x00, 0x00, smpMaxKeySize, 0x00, 0x00}
+	if err := s.send(handle, p.preq[:]); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	for !p.done && !p.failed {
+		if err := s.hci.poll(); err != nil && err != ErrATTOp {
+			return err
+		}
+
+		if time.Since(start) > smpPairingTimeout {
+			return ErrTimeout
+		}
+
+		if !p.done && !p.failed {
+			s.hci.pollWait()
+		}
+
+		// the connection may have ended
+		if p = s.findPairing(handle); p == nil {
+			return ErrPairingFailed
+		}
+	}
+
+	if p.failed {
+		return ErrPairingFailed
+	}
+
+	return nil
+}
+
+func (s *smp) handleData(handle uint16, buf []byte) error {
+	if debug {
+		println("smp.handleData:", handle, "data:", hex.EncodeToString(buf))
+	}
+
+	p := s.findPairing(handle)
+	if p == nil || len(buf) == 0 {
+		return nil
+	}
+
+	switch buf[0] {
+	case smpPairingRequest:
+		if p.initiator || len(buf) < smpPairingCommandLength {
+			return s.fail(p, smpErrorCommandNotSupported)
+		}
+
+		p.done, p.failed, p.hasSTK = false, false, false
+		copy(p.preq[:], buf)
+		p.pres = [7]byte{smpPairingResponse, smpIOCapabilityNoInputOutput, 0x00, 0x00, smpMaxKeySize, 0x00, 0x00}
+		if !p.setKeySize(buf[4]) {
+			return s.fail(p, smpErrorEncryptionKeySize)
+		}
+
+		return s.send(handle, p.pres[:])
+
+	case smpPairingResponse:
+		if !p.initiator || len(buf) < smpPairingCommandLength {
+			return s.fail(p, smpErrorCommandNotSupported)
+		}
+
+		copy(p.pres[:], buf)
+		if !p.setKeySize(buf[4]) {
+			return s.fail(p, smpErrorEncryptionKeySize)
+		}
+
+		return s.sendConfirm(p)
+
+	case smpPairingConfirm:
+		if len(buf) < smpPairingConfirmRandomLength {
+			return s.fail(p, smpErrorUnspecifiedReason)
+		}
+
+		copy(p.peerConfirm[:], buf[1:])
+		if p.initiator {
+			return s.sendRandom(p)
+		}
+
+		return s.sendConfirm(p)
+
+	case smpPairingRandom:
+		if len(buf) < smpPairingConfirmRandomLength {
+			return s.fail(p, smpErrorUnspecifiedReason)
+		}
+
+		var peerRandom [16]byte
+		copy(peerRandom[:], buf[1:])
+		if smpConfirm([16]byte{}, peerRandom, p.preq, p.pres, p.iat, p.rat, p.ia, p.ra) != p.peerConfirm {
+			return s.fail(p, smpErrorConfirmValueFailed)
+		}
+
+		if p.initiator {
+			stk := smpSTK([16]byte{}, peerRandom, p.random, p.keySize)
+			return s.hci.leStartEncryption(handle, stk)
+		}
+
+		p.stk = smpSTK([16]byte{}, p.random, peerRandom, p.keySize)
+		p.hasSTK = true
+
+		return s.sendRandom(p)
+
+	case smpPairingFailed:
+		if debug && len(buf) > 1 {
+			println("smp: pairing failed", buf[1])
+		}
+		p.failed = true
+
+	case smpSecurityRequest:
+		// the central starts pairing with Device.Pair or automatic pairing,
+		// see SetAutoPair
+		if debug {
+			println("smp: security request")
+		}
+
+	default:
+		return s.fail(p, smpErrorCommandNotSupported)
+	}
+
+	return nil
+}
+
+// setKeySize sets the size of the key from the maximum key size of the peer.
+// It returns false if the key would be too short.
+func (p *smpPairing) setKeySize(peerMaxKeySize uint8) bool {
+	p.keySize = smpMaxKeySize
+	if peerMaxKeySize < p.keySize {
+		p.keySize = peerMaxKeySize
+	}
+
+	return p.keySize >= smpMinKeySize
+}
+
+// sendConfirm picks the random value of the local device and sends its
+// confirm value.
+func (s *smp) sendConfirm(p *smpPairing) error {
+	if _, err := rand.Read(p.random[:]); err != nil {
+		return s.fail(p, smpErrorUnspecifiedReason)
+	}
+
+	confirm := smpConfirm([16]byte{}, p.random, p.preq, p.pres, p.iat, p.rat, p.ia, p.ra)
+
+	var b [smpPairingConfirmRandomLength]byte
+	b[0] = smpPairingConfirm
+	copy(b[1:], confirm[:])
+
+	return s.send(p.handle, b[:])
+}
+
+// sendRandom sends the random value of the local device.
+func (s *smp) sendRandom(p *smpPairing) error {
+	var b [smpPairingConfirmRandomLength]byte
+	b[0] = smpPairingRandom
+	copy(b[1:], p.random[:])
+
+	return s.send(p.handle, b[:])
+}
+
+// fail ends the pairing with the reason.
+func (s *smp) fail(p *smpPairing, reason uint8) error {
+	p.failed = true
+	p.hasSTK = false
+
+	return s.send(p.handle, []byte{smpPairingFailed, reason})
+}
+
+// encryptionChanged ends the pairing once the encryption of the link has
+// started or failed.
+func (s *smp) encryptionChanged(handle uint16, encrypted bool) {
+	p := s.findPairing(handle)
+	if p == nil {
+		return
+	}
+
+	p.hasSTK = false
+	if encrypted {
+		p.done = true
+	} else {
+		p.failed = true
+	}
+}
+
+// longTermKeyRequest answers the request of the controller for the key to
+// encrypt the link with, when the central starts the encryption. Only the
+// short term key of a pairing that just completed is known. It is called from
+// the event handler.
+func (s *smp) longTermKeyRequest(handle uint16, random uint64, ediv uint16) error {
+	p := s.findPairing(handle)
+	if p == nil || !p.hasSTK || random != 0 || ediv != 0 {
+		var b [2]byte
+		binary.LittleEndian.PutUint16(b[:], handle)
+
+		return s.hci.sendWithoutResponse(ogfLECtrl<<ogfCommandPos|ocfLELongTermKeyNegReply, b[:])
+	}
+
+	var b [18]byte
+	binary.LittleEndian.PutUint16(b[0:], handle)
+	copy(b[2:], p.stk[:])
+
+	return s.hci.sendWithoutResponse(ogfLECtrl<<ogfCommandPos|ocfLELongTermKeyReply, b[:])
+}
+
+func (s *smp) send(handle uint16, data []byte) error {
+	if debug {
+		println("smp.send:", handle, "data:", hex.EncodeToString(data))
+	}
+
+	return s.hci.sendAclPkt(handle, securityCID, data)
+}
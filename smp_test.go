@@ -0,0 +1,60 @@
+package bluetooth
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// lsbFirst decodes a number written most significant byte first, as in the
+// Bluetooth Core specification, into b least significant byte first.
+func lsbFirst(t *testing.T, s string, b []byte) {
+	t.Helper()
+
+	decoded, err := hex.DecodeString(s)
+	if err != nil || len(decoded) != len(b) {
+		t.Fatalf("invalid test value %s", s)
+	}
+
+	for i := range decoded {
+		b[i] = decoded[len(decoded)-1-i]
+	}
+}
+
+func TestSMPConfirm(t *testing.T) {
+	// sample data from the Bluetooth Core specification, Vol 3, Part H,
+	// 2.2.3
+	var tk, r, expected [16]byte
+	var preq, pres [7]byte
+	var ia, ra [6]byte
+	lsbFirst(t, "5783d52156ad6f0e6388274ec6702ee0", r[:])
+	lsbFirst(t, "07071000000101", preq[:])
+	lsbFirst(t, "05000800000302", pres[:])
+	lsbFirst(t, "a1a2a3a4a5a6", ia[:])
+	lsbFirst(t, "b1b2b3b4b5b6", ra[:])
+	lsbFirst(t, "1e1e3fef878988ead2a74dc5bef13b86", expected[:])
+
+	if c := smpConfirm(tk, r, preq, pres, 0x01, 0x00, ia, ra); c != expected {
+		t.Errorf("expected %x, got %x", expected, c)
+	}
+}
+
+func TestSMPSTK(t *testing.T) {
+	// sample data from the Bluetooth Core specification, Vol 3, Part H,
+	// 2.2.4
+	var tk, r1, r2, expected [16]byte
+	lsbFirst(t, "000f0e0d0c0b0a091122334455667788", r1[:])
+	lsbFirst(t, "010203040506070899aabbccddeeff00", r2[:])
+	lsbFirst(t, "9a1fe1f0e8b0f49b5b4216ae796da062", expected[:])
+
+	if stk := smpSTK(tk, r1, r2, 16); stk != expected {
+		t.Errorf("expected %x, got %x", expected, stk)
+	}
+
+	// a shorter key keeps its least significant bytes
+	stk := smpSTK(tk, r1, r2, 7)
+	for i := 7; i < 16; i++ {
+		if stk[i] != 0 {
+			t.Fatalf("expected a 7 byte key, got %x", stk)
+		}
+	}
+}
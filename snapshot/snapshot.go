@@ -0,0 +1,203 @@
+// Package snapshot provides stable JSON representations of scan results,
+// advertisement fields and discovered GATT databases, to send them to other
+// processes or to store them.
+//
+// Every snapshot carries a format version. Decoding a snapshot with a newer
+// version than this package knows about fails with ErrUnsupportedVersion, so
+// consumers notice when producers have been upgraded. New fields may be added
+// without changing the version.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+	"tinygo.org/x/bluetooth/gattdef"
+)
+
+// Version is the version of the snapshot format written by this package.
+const Version = 1
+
+var ErrUnsupportedVersion = errors.New("snapshot: unsupported version")
+
+// ScanResult is a snapshot of a scan result.
+type ScanResult struct {
+	Version int `json:"version"`
+
+	// Time at which the snapshot was taken.
+	Time time.Time `json:"time"`
+
+	Address string `json:"address"`
+	RSSI    int16  `json:"rssi"`
+
+	AdvertisementFields
+
+	// Raw advertising data, if available on the platform.
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// AdvertisementFields is a snapshot of advertisement fields.
+type AdvertisementFields struct {
+	LocalName        string             `json:"localName,omitempty"`
+	ServiceUUIDs     []string           `json:"serviceUUIDs,omitempty"`
+	ManufacturerData []ManufacturerData `json:"manufacturerData,omitempty"`
+	ServiceData      []ServiceData      `json:"serviceData,omitempty"`
+}
+
+// ManufacturerData is a manufacturer data element of an advertisement.
+type ManufacturerData struct {
+	CompanyID uint16 `json:"companyID"`
+	Data      []byte `json:"data"`
+}
+
+// ServiceData is a service data element of an advertisement.
+type ServiceData struct {
+	UUID string `json:"uuid"`
+	Data []byte `json:"data"`
+}
+
+// Services is a snapshot of the GATT database of a device, in the format of
+// the gattdef package.
+type Services struct {
+	Version int `json:"version"`
+	gattdef.Database
+}
+
+// NewScanResult takes a snapshot of a scan result. The service UUIDs are only
+// included on platforms that provide the raw advertising data.
+func NewScanResult(result bluetooth.ScanResult) ScanResult {
+	s := ScanResult{
+		Version: Version,
+		Time:    time.Now(),
+		Address: result.Address.String(),
+		RSSI:    result.RSSI,
+	}
+
+	if raw := result.Bytes(); raw != nil {
+		s.Raw = append([]byte{}, raw...)
+
+		// use the raw data if available, as the payload interface doesn't
+		// allow listing the service UUIDs.
+		adf, _ := bluetooth.ParseAdvertisingData(s.Raw)
+		s.AdvertisementFields = NewAdvertisementFields(adf)
+	} else {
+		s.AdvertisementFields = NewAdvertisementFields(bluetooth.AdvertisementFields{
+			LocalName:        result.LocalName(),
+			ManufacturerData: result.ManufacturerData(),
+			ServiceData:      result.ServiceData(),
+		})
+	}
+
+	return s
+}
+
+// NewAdvertisementFields takes a snapshot of advertisement fields.
+func NewAdvertisementFields(adf bluetooth.AdvertisementFields) AdvertisementFields {
+	s := AdvertisementFields{
+		LocalName: adf.LocalName,
+	}
+
+	for _, uuid := range adf.ServiceUUIDs {
+		s.ServiceUUIDs = append(s.ServiceUUIDs, uuid.String())
+	}
+
+	for _, m := range adf.ManufacturerData {
+		s.ManufacturerData = append(s.ManufacturerData, ManufacturerData{
+			CompanyID: m.CompanyID,
+			Data:      append([]byte{}, m.Data...),
+		})
+	}
+
+	for _, d := range adf.ServiceData {
+		s.ServiceData = append(s.ServiceData, ServiceData{
+			UUID: d.UUID.String(),
+			Data: append([]byte{}, d.Data...),
+		})
+	}
+
+	return s
+}
+
+// Fields returns the advertisement fields of the snapshot.
+func (s AdvertisementFields) Fields() (bluetooth.AdvertisementFields, error) {
+	adf := bluetooth.AdvertisementFields{
+		LocalName: s.LocalName,
+	}
+
+	for _, u := range s.ServiceUUIDs {
+		uuid, err := bluetooth.ParseUUID(u)
+		if err != nil {
+			return bluetooth.AdvertisementFields{}, fmt.Errorf("snapshot: service UUID %q: %w", u, err)
+		}
+		adf.ServiceUUIDs = append(adf.ServiceUUIDs, uuid)
+	}
+
+	for _, m := range s.ManufacturerData {
+		adf.ManufacturerData = append(adf.ManufacturerData, bluetooth.ManufacturerDataElement{
+			CompanyID: m.CompanyID,
+			Data:      m.Data,
+		})
+	}
+
+	for _, d := range s.ServiceData {
+		uuid, err := bluetooth.ParseUUID(d.UUID)
+		if err != nil {
+			return bluetooth.AdvertisementFields{}, fmt.Errorf("snapshot: service data UUID %q: %w", d.UUID, err)
+		}
+		adf.ServiceData = append(adf.ServiceData, bluetooth.ServiceDataElement{
+			UUID: uuid,
+			Data: d.Data,
+		})
+	}
+
+	return adf, nil
+}
+
+// NewServices takes a snapshot of the GATT database of a connected device.
+// See gattdef.Export.
+func NewServices(device bluetooth.Device) (*Services, error) {
+	db, err := gattdef.Export(device)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Services{
+		Version:  Version,
+		Database: *db,
+	}, nil
+}
+
+// DecodeScanResult decodes a scan result snapshot.
+func DecodeScanResult(data []byte) (ScanResult, error) {
+	var s ScanResult
+	if err := decode(data, &s, &s.Version); err != nil {
+		return ScanResult{}, err
+	}
+
+	return s, nil
+}
+
+// DecodeServices decodes a GATT database snapshot.
+func DecodeServices(data []byte) (*Services, error) {
+	s := &Services{}
+	if err := decode(data, s, &s.Version); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func decode(data []byte, v any, version *int) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	if *version < 1 || *version > Version {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, *version)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"tinygo.org/x/bluetooth"
+)
+
+func TestScanResultRoundTrip(t *testing.T) {
+	adf := bluetooth.AdvertisementFields{
+		LocalName:    "Heart rate",
+		ServiceUUIDs: []bluetooth.UUID{bluetooth.ServiceUUIDHeartRate},
+		ManufacturerData: []bluetooth.ManufacturerDataElement{
+			{CompanyID: 0x1234, Data: []byte{1, 2}},
+		},
+		ServiceData: []bluetooth.ServiceDataElement{
+			{UUID: bluetooth.New16BitUUID(0xfcd2), Data: []byte{0x40}},
+		},
+	}
+
+	s := ScanResult{
+		Version:             Version,
+		Address:             "EE:74:7D:C9:2A:68",
+		RSSI:                -60,
+		AdvertisementFields: NewAdvertisementFields(adf),
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeScanResult(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields, err := decoded.Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Address != s.Address || decoded.RSSI != s.RSSI || !reflect.DeepEqual(fields, adf) {
+		t.Errorf("unexpected result after round trip:\nexpected: %#v\nactual:   %#v", adf, fields)
+	}
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	for _, data := range []string{
+		`{"address": "EE:74:7D:C9:2A:68"}`,
+		`{"version": 2, "address": "EE:74:7D:C9:2A:68"}`,
+	} {
+		if _, err := DecodeScanResult([]byte(data)); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("expected ErrUnsupportedVersion for %s, got %v", data, err)
+		}
+	}
+
+	if _, err := DecodeServices([]byte(`{"version": 1, "services": [{"uuid": "180f"}]}`)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Package timesync keeps track of the clock of a peer that implements the
+// Current Time Service, for sensor networks that timestamp readings across
+// devices.
+//
+// A Clock periodically reads the Current Time characteristic of the peer,
+// estimates the offset and the drift of the peer clock against the local
+// monotonic clock, and returns the corrected peer time from Now:
+//
+//	chars, err := service.DiscoverCharacteristics([]bluetooth.UUID{bluetooth.CharacteristicUUIDCurrentTime})
+//	...
+//	clock := timesync.New(chars[0])
+//	go clock.Run(time.Minute, done)
+//	...
+//	timestamp := clock.Now()
+package timesync
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// number of samples used to estimate the drift.
+const maxSamples = 8
+
+var (
+	ErrInvalidCurrentTime = errors.New("timesync: invalid current time value")
+	ErrNotSynced          = errors.New("timesync: not synchronized")
+)
+
+// ParseCurrentTime parses the value of a Current Time characteristic. The
+// peer sends its local time without time zone, so it is interpreted in loc.
+func ParseCurrentTime(value []byte, loc *time.Location) (time.Time, error) {
+	if len(value) < 9 {
+		return time.Time{}, ErrInvalidCurrentTime
+	}
+
+	year := int(binary.LittleEndian.Uint16(value[0:]))
+	month, day := int(value[2]), int(value[3])
+	hour, min, sec := int(value[4]), int(value[5]), int(value[6])
+	if year == 0 || month == 0 || day == 0 || month > 12 || day > 31 ||
+		hour > 23 || min > 59 || sec > 59 {
+		// zero means unknown, which is not useful to synchronize with
+		return time.Time{}, ErrInvalidCurrentTime
+	}
+
+	// value[7] is the day of the week, value[8] the fractions of a second
+	nsec := int(value[8]) * int(time.Second) / 256
+
+	return time.Date(year, time.Month(month), day, hour, min, sec, nsec, loc), nil
+}
+
+// A sample is the offset of the peer clock at a local time.
+type sample struct {
+	local  time.Duration // since the start of the clock
+	offset time.Duration
+}
+
+// Clock is an estimate of the clock of a peer. It is safe for concurrent use.
+type Clock struct {
+	// Location of the peer time, time.Local if nil.
+	Location *time.Location
+
+	r     io.Reader
+	start time.Time
+
+	mu      sync.Mutex
+	samples []sample
+	offset  time.Duration // at the time of the last sample
+	drift   float64       // peer seconds gained per local second
+	last    time.Duration
+}
+
+// New returns a clock that reads the peer time from r, normally the Current
+// Time characteristic of the peer.
+func New(r io.Reader) *Clock {
+	return &Clock{
+		r:     r,
+		start: time.Now(),
+	}
+}
+
+// Sync reads the peer time and updates the estimate of the offset and drift.
+// The read is assumed to happen halfway between sending the request and
+// receiving the response.
+func (c *Clock) Sync() error {
+	var buf [10]byte
+
+	before := time.Since(c.start)
+	n, err := c.r.Read(buf[:])
+	after := time.Since(c.start)
+	if err != nil {
+		return err
+	}
+
+	loc := c.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	peer, err := ParseCurrentTime(buf[:n], loc)
+	if err != nil {
+		return err
+	}
+
+	local := before + (after-before)/2
+	c.addSample(sample{local: local, offset: peer.Sub(c.start.Add(local))})
+
+	return nil
+}
+
+// addSample adds a sample and fits the offset and drift to the samples.
+func (c *Clock) addSample(s sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.samples) == maxSamples {
+		c.samples = append(c.samples[:0], c.samples[1:]...)
+	}
+	c.samples = append(c.samples, s)
+
+	c.last = s.local
+	c.offset = s.offset
+	c.drift = 0
+	if len(c.samples) < 2 {
+		return
+	}
+
+	// least squares fit of the offset against the local time
+	var meanX, meanY float64
+	for _, s := range c.samples {
+		meanX += s.local.Seconds()
+		meanY += s.offset.Seconds()
+	}
+	meanX /= float64(len(c.samples))
+	meanY /= float64(len(c.samples))
+
+	var sxx, sxy float64
+	for _, s := range c.samples {
+		dx := s.local.Seconds() - meanX
+		sxx += dx * dx
+		sxy += dx * (s.offset.Seconds() - meanY)
+	}
+	if sxx == 0 {
+		return
+	}
+
+	c.drift = sxy / sxx
+	c.offset = time.Duration((meanY + c.drift*(s.local.Seconds()-meanX)) * float64(time.Second))
+}
+
+// Run calls Sync every interval until done is closed, or until Sync fails, in
+// which case it returns the error.
+func (c *Clock) Run(interval time.Duration, done <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Sync(); err != nil {
+			return err
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Now returns the current time of the peer, corrected for the drift since the
+// last synchronization, or the zero time if the clock was never synchronized.
+func (c *Clock) Now() time.Time {
+	now := time.Since(c.start)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.samples) == 0 {
+		return time.Time{}
+	}
+
+	offset := c.offset + time.Duration(c.drift*float64(now-c.last))
+
+	return c.start.Add(now + offset)
+}
+
+// Offset returns the estimated offset of the peer clock against the local
+// clock, as of the last synchronization.
+func (c *Clock) Offset() (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.samples) == 0 {
+		return 0, ErrNotSynced
+	}
+
+	return c.offset, nil
+}
+
+// Drift returns the estimated drift of the peer clock against the local
+// clock, as a fraction: 1e-6 means the peer clock gains a microsecond per
+// second.
+func (c *Clock) Drift() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.drift
+}
@@ -0,0 +1,56 @@
+package timesync
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseCurrentTime(t *testing.T) {
+	value := []byte{0xea, 0x07, 10, 15, 13, 45, 30, 4, 128, 0}
+	got, err := ParseCurrentTime(value, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := time.Date(2026, time.October, 15, 13, 45, 30, int(time.Second/2), time.UTC)
+	if !got.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if _, err := ParseCurrentTime(value[:5], time.UTC); err != ErrInvalidCurrentTime {
+		t.Errorf("expected ErrInvalidCurrentTime for a short value, got %v", err)
+	}
+	if _, err := ParseCurrentTime(make([]byte, 10), time.UTC); err != ErrInvalidCurrentTime {
+		t.Errorf("expected ErrInvalidCurrentTime for an unknown time, got %v", err)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	c := New(nil)
+	if _, err := c.Offset(); err != ErrNotSynced {
+		t.Errorf("expected ErrNotSynced, got %v", err)
+	}
+
+	// the peer is 2 seconds ahead and gains 100µs per second
+	for i := 0; i < 4; i++ {
+		local := time.Duration(i) * time.Minute
+		c.addSample(sample{
+			local:  local,
+			offset: 2*time.Second + time.Duration(1e-4*float64(local)),
+		})
+	}
+
+	if drift := c.Drift(); math.Abs(drift-1e-4) > 1e-9 {
+		t.Errorf("expected drift of 1e-4, got %v", drift)
+	}
+
+	offset, err := c.Offset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := 2*time.Second + 18*time.Millisecond
+	if d := offset - expected; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("expected offset %v, got %v", expected, offset)
+	}
+}
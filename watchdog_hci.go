@@ -0,0 +1,169 @@
+//go:build hci || ninafw || cyw43439
+
+package bluetooth
+
+import (
+	"time"
+)
+
+// time to wait before retrying a failed advertising restart.
+const advRetryInterval = time.Second
+
+// AdvertisingRestartReason is the reason the advertising watchdog restarted
+// advertising.
+type AdvertisingRestartReason uint8
+
+const (
+	// AdvertisingRestartDisconnected means the controller stopped
+	// advertising for a connection, which has now ended.
+	AdvertisingRestartDisconnected AdvertisingRestartReason = iota
+
+	// AdvertisingRestartControllerReset means the controller reported a
+	// hardware error, and was reset before restarting advertising.
+	AdvertisingRestartControllerReset
+
+	// AdvertisingRestartError means a previous restart failed, and is being
+	// retried.
+	AdvertisingRestartError
+)
+
+// SetAdvertisingWatchdog sets whether the adapter keeps advertising going by
+// itself: when a connection that stopped advertising ends, when the
+// controller reports a hardware error, or when a previous restart failed, the
+// advertisement that was last started is started again. The controller is
+// reset after a hardware error, which ends all connections: the handler set by
+// SetConnectHandler is called for each device that was connected.
+//
+// The handler, if not nil, is called from the event loop after each restart
+// with its reason, and with the error if the restart failed, in which case it
+// is retried a second later. Advertising stays off after Advertisement.Stop.
+//
+// It must be called before Enable.
+func (a *hciAdapter) SetAdvertisingWatchdog(enabled bool, handler func(reason AdvertisingRestartReason, err error)) {
+	a.advWatchdog = enabled
+	a.advWatchdogHandler = handler
+}
+
+// requestAdvertisingRestart records that advertising has to be restarted. It is
+// called from the event handlers, the restart itself is done by
+// checkAdvertising.
+func (h *hci) requestAdvertisingRestart(reason AdvertisingRestartReason) {
+	if h.advRestart && h.advRestartReason == AdvertisingRestartControllerReset {
+		// the pending reset restarts advertising as well
+		return
+	}
+
+	h.advRestart = true
+	h.advRestartReason = reason
+}
+
+// checkAdvertising reports a connection to the advertisement, restarts
+// advertising if an event handler requested it, sends the advertising data
+// again if it changed, and stops the advertisement when its timeout is
+// reached. It is called by the event loop between polls, so
+// it can wait for the responses of the controller.
+func (a *hciAdapter) checkAdvertising() {
+	if a.hci.advConnected {
+		a.hci.advConnected = false
+
+		// advertising stopped for the connection, so it doesn't time out
+		a.advStopAt = time.Time{}
+
+		if adv := a.advertisement; adv != nil {
+			adv.event(AdvertisingEventConnected, Device{Address: a.hci.advCentral})
+
+			if adv.keepAdvertising {
+				if err := adv.Start(); err != nil && debug {
+					println("could not advertise while connected:", err.Error())
+				}
+			}
+		}
+	}
+
+	if !a.advStopAt.IsZero() && a.advertisement != nil && time.Now().After(a.advStopAt) {
+		adv := a.advertisement
+		if err := adv.stop(); err != nil && debug {
+			println("could not stop advertising:", err.Error())
+		}
+
+		adv.event(AdvertisingEventTimedOut, Device{})
+		if adv.onStopped != nil {
+			adv.onStopped()
+		}
+	}
+
+	if a.advDataChanged {
+		a.advDataChanged = false
+
+		if a.advertisement != nil {
+			if err := a.advertisement.updateAdvertisingData(); err != nil && debug {
+				println("could not update advertising data:", err.Error())
+			}
+		}
+	}
+
+	if !a.hci.advRestart || time.Now().Before(a.advRetryAt) {
+		return
+	}
+
+	reason := a.hci.advRestartReason
+	a.hci.advRestart = false
+
+	var err error
+	if reason == AdvertisingRestartControllerReset {
+		err = a.recoverController()
+	}
+
+	if err == nil && a.advertisement == nil {
+		// nothing to restart
+		return
+	}
+
+	if err == nil {
+		err = a.advertisement.Start()
+		if err != nil {
+			reason = AdvertisingRestartError
+		}
+	}
+
+	if err != nil {
+		if debug {
+			println("could not restart advertising:", err.Error())
+		}
+
+		a.hci.requestAdvertisingRestart(reason)
+		a.advRetryAt = time.Now().Add(advRetryInterval)
+	}
+
+	if a.advWatchdogHandler != nil {
+		a.advWatchdogHandler(reason, err)
+	}
+}
+
+// recoverController resets the controller after a hardware error. The
+// connections didn't survive the reset, so they are removed as if they had
+// been disconnected, and the connect handler is called for the devices that
+// were connected as central.
+func (a *hciAdapter) recoverController() error {
+	for _, handle := range append([]uint16{}, a.att.connections...) {
+		a.att.removeConnection(handle)
+		a.hci.l2cap.removeConnection(handle)
+	}
+	a.hci.smp.pairings = a.hci.smp.pairings[:0]
+	a.hci.peripheralConnections = a.hci.peripheralConnections[:0]
+	a.hci.pendingPkt.Store(0)
+
+	err := a.resetController()
+
+	for len(a.connectedDevices) > 0 {
+		// also releases the slot of the device in static allocation mode
+		d := a.connectedDevices[len(a.connectedDevices)-1]
+		a.removeConnection(d)
+
+		if a.connectHandler != nil {
+			a.connectHandler(d, false)
+		}
+	}
+
+	return err
+}